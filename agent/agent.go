@@ -0,0 +1,695 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/kzg-demo/controlplane"
+	"example.com/kzg-demo/diagnose"
+	"example.com/kzg-demo/keystore"
+	"example.com/kzg-demo/policy"
+	"example.com/kzg-demo/replay"
+	"example.com/kzg-demo/types"
+	"example.com/kzg-demo/utils"
+	gozkg "github.com/protolambda/go-kzg"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+type flowState struct {
+	params types.FlowParams
+	node   types.Node
+}
+
+type epochState struct {
+	params types.EpochParams
+	flows  map[string][]*flowState // one state per visit of this node, ordered by visit
+}
+
+// Agent is the node daemon. It pulls its parameters from the controller and
+// proves/verifies hops for the data plane.
+type Agent struct {
+	Name          string
+	ControllerURL string
+	PollInterval  time.Duration
+	// Keystore, if set, caches the downloaded parameters encrypted at rest, so the node can keep
+	// serving across restarts while the controller is unreachable.
+	Keystore *keystore.Keystore
+	// ControllerKey is the pinned public key of the controller. Parameters that are not signed
+	// with it are refused, so the node never proves or verifies against a forged commitment.
+	ControllerKey ed25519.PublicKey
+	// Replay, if set, makes VerifyBound refuse proofs whose sequence number was already accepted
+	// or fell behind the flow's window. Verify leaves it alone, since only the chain link
+	// authenticates the number; see package replay.
+	Replay *replay.Detector
+	// Policy, if set, decides what happens to packets whose proof failed; see Decide.
+	Policy *policy.Engine
+	// Credential authenticates the node to the controller; the controller issues it on the first
+	// registration. If CredentialPath is set, the credential is read from and saved to that file,
+	// so the node can register again after a restart.
+	Credential     string
+	CredentialPath string
+	// HopKey signs the chain links of this node's proofs, see types.Proof.Bind. The node sends its
+	// public half with every registration and the controller vouches for it to the other nodes.
+	// New draws an ephemeral one.
+	HopKey ed25519.PrivateKey
+
+	client   *http.Client
+	mu       sync.RWMutex
+	settings *gozkg.KZGSettings
+	epochs   map[uint64]*epochState
+	revoked  map[string]bool
+	hopKeys  map[string]ed25519.PublicKey // of every node, as signed by the controller
+	treeHead *types.TreeHead
+	// cached is the digest of the parameters last saved to the keystore; sealing derives a key
+	// with scrypt, so unchanged parameters are not sealed again
+	cached [sha256.Size]byte
+
+	seqMu sync.Mutex
+	seqs  map[string]uint64 // last sequence number issued per flow and epoch, as the ingress
+}
+
+func New(name string, controllerURL string) *Agent {
+	_, hopKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		panic(err)
+	}
+	a := &Agent{
+		Name:          name,
+		ControllerURL: controllerURL,
+		PollInterval:  5 * time.Second,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		epochs:        make(map[uint64]*epochState),
+		revoked:       make(map[string]bool),
+		HopKey:        hopKey,
+		hopKeys:       make(map[string]ed25519.PublicKey),
+		Replay:        replay.NewDetector(replay.DefaultWindow),
+		seqs:          make(map[string]uint64),
+		Policy:        policy.NewEngine(policy.Policy{Action: policy.Drop}),
+	}
+	a.Policy.Alert = a.sendAlert
+	return a
+}
+
+// Register registers the node with the controller, and keeps the credential it is issued.
+func (a *Agent) Register() error {
+	if a.Credential == "" && a.CredentialPath != "" {
+		data, err := os.ReadFile(a.CredentialPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		a.Credential = strings.TrimSpace(string(data))
+	}
+	body, err := json.Marshal(controlplane.RegisterRequest{Node: a.Name, HopKey: a.HopKey.Public().(ed25519.PublicKey)})
+	if err != nil {
+		return err
+	}
+	resp, err := a.do(http.MethodPost, "/register", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("register %v: controller returned %v", a.Name, resp.Status)
+	}
+	var registered controlplane.RegisterResponse
+	if err := json.NewDecoder(resp.Body).Decode(&registered); err != nil {
+		return err
+	}
+	if registered.Credential == "" {
+		return nil
+	}
+	a.Credential = registered.Credential
+	if a.CredentialPath != "" {
+		if err := utils.WriteFileAtomic(a.CredentialPath, []byte(a.Credential+"\n")); err != nil {
+			return fmt.Errorf("save credential: %w", err)
+		}
+	}
+	return nil
+}
+
+// do sends a request to the controller on behalf of the node, with its credential.
+func (a *Agent) do(method string, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, a.ControllerURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if a.Credential != "" {
+		req.Header.Set("Authorization", "Bearer "+a.Credential)
+	}
+	return a.client.Do(req)
+}
+
+// Sync downloads the current parameters, picking up published epochs and re-committed flows.
+func (a *Agent) Sync() error {
+	resp, err := a.do(http.MethodGet, "/params?node="+url.QueryEscape(a.Name), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusForbidden {
+		a.mu.Lock()
+		a.epochs = make(map[uint64]*epochState)
+		a.mu.Unlock()
+		return fmt.Errorf("node %v has been revoked by the controller", a.Name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch parameters of %v: controller returned %v", a.Name, resp.Status)
+	}
+
+	var params types.NodeParams
+	if err := json.NewDecoder(resp.Body).Decode(&params); err != nil {
+		return err
+	}
+	if err := a.apply(&params); err != nil {
+		return err
+	}
+	if a.Keystore != nil {
+		if err := a.cache(&params); err != nil {
+			return fmt.Errorf("cache parameters: %w", err)
+		}
+	}
+	return nil
+}
+
+// cache saves the parameters to the keystore unless they are the ones saved last.
+func (a *Agent) cache(params *types.NodeParams) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(data)
+	if digest == a.cached {
+		return nil
+	}
+	if err := a.Keystore.Save(params); err != nil {
+		return err
+	}
+	a.cached = digest
+	return nil
+}
+
+// loadCached applies the parameters cached in the keystore.
+func (a *Agent) loadCached() error {
+	if a.Keystore == nil {
+		return fmt.Errorf("no keystore configured")
+	}
+	var params types.NodeParams
+	if err := a.Keystore.Load(&params); err != nil {
+		return err
+	}
+	if params.Node != a.Name {
+		return fmt.Errorf("cached parameters belong to node %v", params.Node)
+	}
+	if err := a.apply(&params); err != nil {
+		return err
+	}
+	if data, err := json.Marshal(&params); err == nil {
+		a.cached = sha256.Sum256(data)
+	}
+	return nil
+}
+
+func (a *Agent) apply(params *types.NodeParams) error {
+	if len(params.Setup.SecretG1) < 16+1 || len(params.Setup.SecretG1) != len(params.Setup.SecretG2) {
+		return fmt.Errorf("malformed setup parameters")
+	}
+	if len(a.ControllerKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("no controller key pinned, refusing unauthenticated parameters")
+	}
+	setupHash := types.SetupHash(params.Setup.SecretG1, params.Setup.SecretG2)
+
+	if err := a.checkTreeHead(params); err != nil {
+		return err
+	}
+	hopKeys := make(map[string]ed25519.PublicKey)
+	for _, hopKey := range params.HopKeys {
+		if !hopKey.Verify(a.ControllerKey) {
+			return fmt.Errorf("hop key of %v is not signed by the controller", hopKey.Node)
+		}
+		hopKeys[hopKey.Node] = hopKey.Key
+	}
+
+	var settings *gozkg.KZGSettings // built for the first flow in Lagrange form
+	epochs := make(map[uint64]*epochState)
+	for _, epochParams := range params.Epochs {
+		epoch := &epochState{
+			params: epochParams,
+			flows:  make(map[string][]*flowState),
+		}
+		for _, flow := range epochParams.Flows {
+			if !types.VerifyParams(a.ControllerKey, flow.Signature, flow.FlowID, epochParams.Epoch, flow.Version, flow.Commitment, setupHash) {
+				return fmt.Errorf("epoch %v: flow %v: parameters are not signed by the controller", epochParams.Epoch, flow.FlowID)
+			}
+			polynomial, err := types.PolynomialFromStrings(flow.Polynomial)
+			if err != nil {
+				return fmt.Errorf("epoch %v: flow %v: %w", epochParams.Epoch, flow.FlowID, err)
+			}
+			if flow.Visit != len(epoch.flows[flow.FlowID]) {
+				return fmt.Errorf("epoch %v: flow %v: visit %v is out of order", epochParams.Epoch, flow.FlowID, flow.Visit)
+			}
+			secret := types.VisitSecret(epochParams.Secret, flow.Visit)
+			secretFr := new(bls.Fr)
+			bls.AsFr(secretFr, secret)
+			if flow.Width > 0 {
+				if settings == nil {
+					settings = types.KzgSettingsFromSetup(params.Setup.SecretG1, params.Setup.SecretG2)
+				}
+				if err := checkOpening(settings, flow, secretFr); err != nil {
+					return fmt.Errorf("epoch %v: flow %v: %w", epochParams.Epoch, flow.FlowID, err)
+				}
+			}
+
+			epoch.flows[flow.FlowID] = append(epoch.flows[flow.FlowID], &flowState{
+				params: flow,
+				node: types.Node{
+					Secret:     secret,
+					SecretFr:   secretFr,
+					Polynomial: polynomial,
+				},
+			})
+		}
+		epochs[epochParams.Epoch] = epoch
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.settings == nil || len(a.settings.SecretG1) != len(params.Setup.SecretG1) {
+		a.settings = types.KzgSettingsFromSetup(params.Setup.SecretG1, params.Setup.SecretG2)
+	}
+	for id, epoch := range epochs {
+		old, ok := a.epochs[id]
+		if !ok {
+			log.Printf("[%v] epoch %v published, active from %v", a.Name, id, epoch.params.NotBefore.Format(time.RFC3339))
+			continue
+		}
+		for flowID, visits := range epoch.flows {
+			flow := visits[0]
+			if oldVisits, ok := old.flows[flowID]; !ok {
+				log.Printf("[%v] joined flow %v (epoch %v, version %v)", a.Name, flowID, id, flow.params.Version)
+			} else if oldVisits[0].params.Version != flow.params.Version {
+				log.Printf("[%v] flow %v updated to version %v (epoch %v)", a.Name, flowID, flow.params.Version, id)
+			}
+		}
+		for flowID := range old.flows {
+			if _, ok := epoch.flows[flowID]; !ok {
+				log.Printf("[%v] left flow %v (epoch %v)", a.Name, flowID, id)
+			}
+		}
+	}
+	for id := range a.epochs {
+		if _, ok := epochs[id]; !ok {
+			log.Printf("[%v] epoch %v expired", a.Name, id)
+		}
+	}
+	revoked := make(map[string]bool)
+	for _, name := range params.Revoked {
+		if !a.revoked[name] {
+			log.Printf("[%v] node %v revoked", a.Name, name)
+		}
+		revoked[name] = true
+	}
+	a.epochs = epochs
+	a.revoked = revoked
+	a.hopKeys = hopKeys
+	a.treeHead = params.TreeHead
+	a.applyPolicies(params)
+	return nil
+}
+
+// checkOpening makes sure the opening the controller issued for a route in Lagrange form proves
+// this node's secret at its slot against the signed commitment.
+func checkOpening(settings *gozkg.KZGSettings, flow types.FlowParams, secret *bls.Fr) error {
+	if flow.Opening == nil {
+		return fmt.Errorf("missing opening")
+	}
+	x, err := types.SlotPoint(settings, flow.Width, flow.Slot)
+	if err != nil {
+		return err
+	}
+	if !settings.CheckProofSingle(flow.Commitment, flow.Opening, x, secret) {
+		return fmt.Errorf("opening at slot %v does not match the commitment", flow.Slot)
+	}
+	return nil
+}
+
+// currentLocked returns the newest epoch that has activated.
+func (a *Agent) currentLocked(now time.Time) *epochState {
+	var current *epochState
+	for _, epoch := range a.epochs {
+		if now.Before(epoch.params.NotBefore) {
+			continue
+		}
+		if current == nil || epoch.params.Epoch > current.params.Epoch {
+			current = epoch
+		}
+	}
+	return current
+}
+
+// Run registers the node and keeps its parameters in sync until ctx is done.
+func (a *Agent) Run(ctx context.Context) error {
+	err := a.Register()
+	if err == nil {
+		err = a.Sync()
+	}
+	if err != nil {
+		if a.Keystore == nil {
+			return err
+		}
+		if cacheErr := a.loadCached(); cacheErr != nil {
+			return fmt.Errorf("%w; no usable cached parameters: %v", err, cacheErr)
+		}
+		log.Printf("[%v] controller unreachable (%v), using cached parameters", a.Name, err)
+	}
+
+	ticker := time.NewTicker(a.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := a.Sync(); err != nil {
+				log.Printf("[%v] sync failed: %v", a.Name, err)
+			}
+		}
+	}
+}
+
+// Prove computes this node's opening for a flow in the current epoch. Routes that pass through the
+// node more than once are proven per visit, counted from 0. seq is the sequence number of the
+// incoming proof; the first hop passes 0 and numbers the packet itself.
+func (a *Agent) Prove(flowID string, visit int, seq uint64) (*types.Proof, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	epoch := a.currentLocked(time.Now())
+	if epoch == nil {
+		return nil, fmt.Errorf("no active epoch")
+	}
+	visits, ok := epoch.flows[flowID]
+	if !ok {
+		return nil, fmt.Errorf("node %v is not on flow %v in epoch %v", a.Name, flowID, epoch.params.Epoch)
+	}
+	if visit < 0 || visit >= len(visits) {
+		return nil, fmt.Errorf("node %v visits flow %v %v times, got visit %v", a.Name, flowID, len(visits), visit)
+	}
+	flow := visits[visit]
+
+	y := new(bls.Fr)
+	if flow.params.Label != "" {
+		if err := types.FrFromString(y, flow.params.Label); err != nil {
+			return nil, err
+		}
+	} else {
+		bls.AsFr(y, uint64(flow.params.Position))
+	}
+
+	if seq == 0 && (flow.params.Position == 1 || (flow.params.Label != "" && flow.params.Previous == "")) {
+		seq = a.nextSeq(flowID, epoch.params.Epoch)
+	}
+
+	if flow.params.Width > 0 {
+		// in Lagrange form the node opens the commitment at its slot to its secret
+		x, err := types.SlotPoint(a.settings, flow.params.Width, flow.params.Slot)
+		if err != nil {
+			return nil, err
+		}
+		return &types.Proof{
+			FlowID:  flowID,
+			Epoch:   epoch.params.Epoch,
+			Version: flow.params.Version,
+			Node:    a.Name,
+			X:       x.String(),
+			Y:       flow.node.SecretFr.String(),
+			Proof:   flow.params.Opening,
+			Seq:     seq,
+		}, nil
+	}
+
+	return &types.Proof{
+		FlowID:  flowID,
+		Epoch:   epoch.params.Epoch,
+		Version: flow.params.Version,
+		Node:    a.Name,
+		X:       flow.node.SecretFr.String(),
+		Y:       y.String(),
+		Proof:   a.settings.ComputeProofSingle(flow.node.Polynomial, flow.node.Secret),
+		Seq:     seq,
+	}, nil
+}
+
+// nextSeq numbers the next packet of a flow at the ingress. Numbering restarts with every epoch,
+// and so do the verifiers' windows.
+func (a *Agent) nextSeq(flowID string, epoch uint64) uint64 {
+	a.seqMu.Lock()
+	defer a.seqMu.Unlock()
+
+	key := fmt.Sprintf("%v/%v", flowID, epoch)
+	a.seqs[key]++
+	return a.seqs[key]
+}
+
+// Verify checks a proof received from the previous hop against the commitment of the epoch the
+// proof was made in. Proofs of the previous epoch are accepted during its grace window.
+// The expected position is derived from this node's own position, not taken from the proof.
+// Nothing authenticates the proof's sequence number here, so the replay window is left alone;
+// see VerifyBound.
+func (a *Agent) Verify(proof *types.Proof) (bool, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	flow, err := a.visitLocked(proof)
+	if err != nil {
+		return false, err
+	}
+	return a.verifyLocked(flow, proof)
+}
+
+// visitLocked returns the visit of this node a proof is meant for, in a live epoch.
+func (a *Agent) visitLocked(proof *types.Proof) (*flowState, error) {
+	epoch, ok := a.epochs[proof.Epoch]
+	if !ok {
+		return nil, fmt.Errorf("unknown epoch %v", proof.Epoch)
+	}
+	if !epoch.params.Active(time.Now()) {
+		return nil, fmt.Errorf("epoch %v is not active", proof.Epoch)
+	}
+	visits, ok := epoch.flows[proof.FlowID]
+	if !ok {
+		return nil, fmt.Errorf("node %v is not on flow %v in epoch %v", a.Name, proof.FlowID, proof.Epoch)
+	}
+	return visitOf(a.settings, visits, proof)
+}
+
+func (a *Agent) verifyLocked(flow *flowState, proof *types.Proof) (bool, error) {
+	// the previous hop is taken from the committed route; the claimed sender is checked as well
+	previous := previousOf(flow)
+	if previous == "" {
+		return false, fmt.Errorf("node %v is the first hop of flow %v", a.Name, proof.FlowID)
+	}
+	if a.revoked[previous] {
+		return false, fmt.Errorf("previous hop %v is revoked", previous)
+	}
+	if a.revoked[proof.Node] {
+		return false, fmt.Errorf("sender %v is revoked", proof.Node)
+	}
+	if proof.Version != flow.params.Version {
+		return false, fmt.Errorf("stale commitment version %v, current is %v", proof.Version, flow.params.Version)
+	}
+	if proof.Proof == nil {
+		return false, fmt.Errorf("missing proof")
+	}
+
+	var x, y bls.Fr
+	if err := types.FrFromString(&x, proof.X); err != nil {
+		return false, err
+	}
+	if flow.params.Width > 0 {
+		// the previous hop opens the commitment at its slot, to its secret
+		previousX, err := types.SlotPoint(a.settings, flow.params.Width, flow.params.PreviousSlot)
+		if err != nil {
+			return false, err
+		}
+		if !bls.EqualFr(&x, previousX) {
+			return false, fmt.Errorf("proof is not from the previous hop of flow %v", proof.FlowID)
+		}
+		if err := types.FrFromString(&y, proof.Y); err != nil {
+			return false, err
+		}
+	} else if flow.params.Label != "" {
+		// the claimed label must be the previous hop's, which the controller gave this node
+		if err := types.FrFromString(&y, proof.Y); err != nil {
+			return false, err
+		}
+		var label bls.Fr
+		if err := types.FrFromString(&label, flow.params.PreviousLabel); err != nil {
+			return false, err
+		}
+		if !bls.EqualFr(&y, &label) {
+			return false, fmt.Errorf("proof is not from the previous hop of flow %v", proof.FlowID)
+		}
+	} else {
+		bls.AsFr(&y, uint64(flow.params.Position-1))
+	}
+	if !a.settings.CheckProofSingle(flow.params.Commitment, proof.Proof, &x, &y) {
+		if flow.params.Route == nil || flow.params.Width > 0 {
+			return false, nil
+		}
+		// explain the failure against the committed route
+		finding := diagnose.DiagnoseHop(a.intendedLocked(flow), flow.params.Position-1, proof, nil)
+		return false, fmt.Errorf("%v", finding)
+	}
+	return true, nil
+}
+
+// Diagnose compares the chain of proofs a packet collected on a flow with the committed route,
+// for an egress or collector on the flow. Flows that hide positions cannot be diagnosed, since
+// their hops do not know the route.
+func (a *Agent) Diagnose(flowID string, epochID uint64, path []*types.Proof, packetDigest []byte) (*diagnose.Report, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	epoch, ok := a.epochs[epochID]
+	if !ok {
+		return nil, fmt.Errorf("unknown epoch %v", epochID)
+	}
+	visits, ok := epoch.flows[flowID]
+	if !ok {
+		return nil, fmt.Errorf("node %v is not on flow %v in epoch %v", a.Name, flowID, epochID)
+	}
+	if visits[0].params.Route == nil {
+		return nil, fmt.Errorf("flow %v hides hop positions", flowID)
+	}
+	if visits[0].params.Width > 0 {
+		return nil, fmt.Errorf("flow %v is committed in Lagrange form", flowID)
+	}
+	return diagnose.Diagnose(a.intendedLocked(visits[0]), path, packetDigest), nil
+}
+
+func (a *Agent) intendedLocked(flow *flowState) *diagnose.Route {
+	route := &diagnose.Route{
+		Nodes:      flow.params.Route,
+		Ys:         make([]bls.Fr, len(flow.params.Route)),
+		Commitment: flow.params.Commitment,
+		Settings:   a.settings,
+		Keys:       a.hopKeys,
+	}
+	for i := range route.Ys {
+		bls.AsFr(&route.Ys[i], uint64(i+1))
+	}
+	return route
+}
+
+// previousOf returns the hop the route commits before a visit, empty for the first hop.
+func previousOf(flow *flowState) string {
+	if flow.params.Label == "" && flow.params.Position > 1 {
+		return flow.params.Route[flow.params.Position-2]
+	}
+	return flow.params.Previous
+}
+
+// Bind chains a proof made by this node to the previous hop's Chain and to the packet, and signs
+// the link with the node's hop key.
+func (a *Agent) Bind(proof *types.Proof, prev []byte, packetDigest []byte) error {
+	if a.HopKey == nil {
+		return fmt.Errorf("node %v has no hop key", a.Name)
+	}
+	proof.Bind(a.HopKey, prev, packetDigest)
+	return nil
+}
+
+// VerifyBound is Verify for chained proofs: the proof must also be bound to the digest of the
+// packet it arrived with by the previous hop of the committed route, so an opening recorded from
+// another packet, or re-bound by another node, is refused. The link covers the sequence number,
+// so only proofs that pass here move the replay window.
+func (a *Agent) VerifyBound(proof *types.Proof, packetDigest []byte) (bool, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	flow, err := a.visitLocked(proof)
+	if err != nil {
+		return false, err
+	}
+	// the link must be signed by the node the route commits before this visit, not by the node
+	// the proof names
+	previous := previousOf(flow)
+	if previous == "" {
+		return false, fmt.Errorf("node %v is the first hop of flow %v", a.Name, proof.FlowID)
+	}
+	key, ok := a.hopKeys[previous]
+	if !ok {
+		return false, fmt.Errorf("previous hop %v registered no hop key", previous)
+	}
+	if !proof.CheckLink(key, packetDigest) {
+		return false, fmt.Errorf("proof is not bound to this packet by %v", previous)
+	}
+	if verified, err := a.verifyLocked(flow, proof); !verified || err != nil {
+		return verified, err
+	}
+	if a.Replay != nil {
+		if err := a.Replay.Accept(proof.FlowID, fmt.Sprintf("%v/%v", proof.Epoch, flow.params.Visit), proof.Seq); err != nil {
+			return false, fmt.Errorf("sequence number %v: %w", proof.Seq, err)
+		}
+	}
+	return true, nil
+}
+
+// visitOf picks the visit a proof is meant for: the one whose predecessor proves proof.Y, or
+// opens at proof.X in Lagrange form. A node visiting the flow once does not look at the proof here.
+func visitOf(settings *gozkg.KZGSettings, visits []*flowState, proof *types.Proof) (*flowState, error) {
+	if len(visits) == 1 {
+		return visits[0], nil
+	}
+	var x, y bls.Fr
+	if err := types.FrFromString(&x, proof.X); err != nil {
+		return nil, err
+	}
+	if err := types.FrFromString(&y, proof.Y); err != nil {
+		return nil, err
+	}
+	for _, flow := range visits {
+		if flow.params.Width > 0 {
+			previous, err := types.SlotPoint(settings, flow.params.Width, flow.params.PreviousSlot)
+			if err == nil && bls.EqualFr(&x, previous) {
+				return flow, nil
+			}
+			continue
+		}
+		if flow.params.Label != "" {
+			if flow.params.PreviousLabel == "" {
+				continue // the first hop has no predecessor
+			}
+			var label bls.Fr
+			if err := types.FrFromString(&label, flow.params.PreviousLabel); err != nil {
+				return nil, err
+			}
+			if bls.EqualFr(&y, &label) {
+				return flow, nil
+			}
+			continue
+		}
+		var previous bls.Fr
+		bls.AsFr(&previous, uint64(flow.params.Position-1))
+		if bls.EqualFr(&y, &previous) {
+			return flow, nil
+		}
+	}
+	return nil, fmt.Errorf("proof is not from the previous hop of any visit of flow %v", proof.FlowID)
+}
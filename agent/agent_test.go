@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"math"
+	"testing"
+
+	"example.com/kzg-demo/controlplane"
+	"example.com/kzg-demo/replay"
+	"example.com/kzg-demo/types"
+)
+
+// agents registers the nodes of a route with a controller, commits the route and returns an
+// agent for every node, synced with the controller's parameters.
+func agents(t *testing.T, route ...string) map[string]*Agent {
+	t.Helper()
+	s := controlplane.NewService()
+	out := make(map[string]*Agent)
+	for _, name := range route {
+		a := New(name, "")
+		a.ControllerKey = s.PublicKey()
+		if _, err := s.Register(name, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetHopKey(name, a.HopKey.Public().(ed25519.PublicKey)); err != nil {
+			t.Fatal(err)
+		}
+		out[name] = a
+	}
+	if _, err := s.SetFlow("f", route); err != nil {
+		t.Fatal(err)
+	}
+	for name, a := range out {
+		params, err := s.NodeParams(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.apply(params); err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+	}
+	return out
+}
+
+func TestOnlyBoundProofsMoveTheReplayWindow(t *testing.T) {
+	nodes := agents(t, "A", "B", "C")
+	a, b := nodes["A"], nodes["B"]
+	digest := types.PacketDigest([]byte("packet"))
+
+	prove := func(seq uint64) *types.Proof {
+		t.Helper()
+		proof, err := a.Prove("f", 0, seq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Bind(proof, nil, digest); err != nil {
+			t.Fatal(err)
+		}
+		return proof
+	}
+
+	// anyone can renumber a proof verified without the packet digest; the largest number must not
+	// slide the window past the real packets
+	renumbered := prove(1)
+	renumbered.Seq = math.MaxUint64
+	if verified, err := b.Verify(renumbered); !verified || err != nil {
+		t.Fatalf("unbound proof: %v, %v", verified, err)
+	}
+	// nor does it pass as bound, since the link covers the number
+	if verified, err := b.VerifyBound(renumbered, digest); verified || err == nil {
+		t.Error("renumbered proof verified as bound")
+	}
+
+	steps := []struct {
+		name string
+		seq  uint64
+		want error // nil if accepted
+	}{
+		{"first packet", 1, nil},
+		{"same packet again", 1, replay.ErrReplayed},
+		{"later packet", replay.DefaultWindow + 2, nil},
+		{"behind the window", 1, replay.ErrTooOld},
+		{"out of order within the window", 3, nil},
+	}
+	for _, step := range steps {
+		verified, err := b.VerifyBound(prove(step.seq), digest)
+		if step.want == nil {
+			if !verified || err != nil {
+				t.Errorf("%v: %v, %v", step.name, verified, err)
+			}
+			continue
+		}
+		if verified || !errors.Is(err, step.want) {
+			t.Errorf("%v: got %v, %v; want %v", step.name, verified, err, step.want)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"example.com/kzg-demo/policy"
+	"example.com/kzg-demo/replay"
+	"example.com/kzg-demo/types"
+)
+
+type ProveRequest struct {
+	FlowID string
+	Visit  int // which pass of this node over the route, counted from 0
+	// Seq is the sequence number of the incoming proof, carried over to this hop's proof; the
+	// first hop leaves it 0 and gets the next number of the flow.
+	Seq uint64 `json:",omitempty"`
+	// PacketDigest, if set, chains the proof to the packet and to Prev, the Chain of the proof
+	// this hop received; see types.PacketDigest.
+	PacketDigest []byte `json:",omitempty"`
+	Prev         []byte `json:",omitempty"`
+}
+
+// DiagnoseRequest is the chain of proofs a packet collected, in hop order.
+type DiagnoseRequest struct {
+	FlowID       string
+	Epoch        uint64
+	Path         []*types.Proof
+	PacketDigest []byte `json:",omitempty"`
+}
+
+type DiagnoseResponse struct {
+	OK              bool
+	FirstDivergence int
+	Findings        []string
+}
+
+// VerifyRequest is a proof, with the digest of the packet it arrived with if it is chained.
+type VerifyRequest struct {
+	types.Proof
+	PacketDigest []byte `json:",omitempty"`
+}
+
+type VerifyResponse struct {
+	Verified bool
+	Error    string `json:",omitempty"`
+	// Decision is what the data plane should do with the packet under the flow's policy.
+	Decision *policy.Decision `json:",omitempty"`
+}
+
+type ReleaseRequest struct {
+	FlowID string
+}
+
+// Stats are the verifier's counters, per flow.
+type Stats struct {
+	Replay map[string]replay.Stats
+	Policy map[string]policy.Stats
+}
+
+type FlowInfo struct {
+	FlowID   string
+	Epoch    uint64
+	Version  uint64
+	Route    []string
+	Position int
+	Visit    int
+}
+
+// Handler exposes the local prove/verify API to the data plane.
+//
+//	POST /prove    compute this node's proof for a flow, chained to the packet if one is given
+//	POST /verify   verify a proof from the previous hop; with a PacketDigest, its chain link too
+//	GET  /flows    list the flows this node participates in
+//	GET  /treehead the last transparency log head this node accepted
+//	POST /diagnose explain how a packet's chain of proofs diverged from the committed route
+//	GET  /stats    counters of accepted and refused sequence numbers, and of policy decisions
+//	POST /release  lift the quarantine of a flow, e.g., {"FlowID":"f1"}
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prove", a.handleProve)
+	mux.HandleFunc("/verify", a.handleVerify)
+	mux.HandleFunc("/flows", a.handleFlows)
+	mux.HandleFunc("/treehead", a.handleTreeHead)
+	mux.HandleFunc("/diagnose", a.handleDiagnose)
+	mux.HandleFunc("/stats", a.handleStats)
+	mux.HandleFunc("/release", a.handleRelease)
+	return mux
+}
+
+func (a *Agent) handleProve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ProveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	proof, err := a.Prove(req.FlowID, req.Visit, req.Seq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if req.PacketDigest != nil {
+		if err := a.Bind(proof, req.Prev, req.PacketDigest); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	writeJSON(w, proof)
+}
+
+func (a *Agent) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var verified bool
+	var err error
+	if req.PacketDigest != nil {
+		verified, err = a.VerifyBound(&req.Proof, req.PacketDigest)
+	} else {
+		verified, err = a.Verify(&req.Proof)
+	}
+	resp := VerifyResponse{Verified: verified, Decision: a.Decide(&req.Proof, verified, err)}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	writeJSON(w, resp)
+}
+
+func (a *Agent) handleFlows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.mu.RLock()
+	infos := make([]FlowInfo, 0)
+	for _, epoch := range a.epochs {
+		for _, visits := range epoch.flows {
+			for _, flow := range visits {
+				infos = append(infos, FlowInfo{
+					FlowID:   flow.params.FlowID,
+					Epoch:    epoch.params.Epoch,
+					Version:  flow.params.Version,
+					Route:    flow.params.Route,
+					Position: flow.params.Position,
+					Visit:    flow.params.Visit,
+				})
+			}
+		}
+	}
+	a.mu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].FlowID != infos[j].FlowID {
+			return infos[i].FlowID < infos[j].FlowID
+		}
+		if infos[i].Epoch != infos[j].Epoch {
+			return infos[i].Epoch < infos[j].Epoch
+		}
+		return infos[i].Visit < infos[j].Visit
+	})
+	writeJSON(w, infos)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (a *Agent) handleTreeHead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	head := a.TreeHead()
+	if head == nil {
+		http.Error(w, "no parameters yet", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, head)
+}
+
+func (a *Agent) handleDiagnose(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req DiagnoseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for i, proof := range req.Path {
+		if proof == nil {
+			http.Error(w, fmt.Sprintf("hop %v: missing proof", i+1), http.StatusBadRequest)
+			return
+		}
+	}
+	report, err := a.Diagnose(req.FlowID, req.Epoch, req.Path, req.PacketDigest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	resp := DiagnoseResponse{OK: report.OK(), FirstDivergence: report.FirstDivergence, Findings: make([]string, 0, len(report.Findings))}
+	for _, finding := range report.Findings {
+		resp.Findings = append(resp.Findings, finding.String())
+	}
+	writeJSON(w, resp)
+}
+
+func (a *Agent) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	stats := Stats{Replay: make(map[string]replay.Stats), Policy: make(map[string]policy.Stats)}
+	if a.Replay != nil {
+		stats.Replay = a.Replay.Stats()
+	}
+	if a.Policy != nil {
+		stats.Policy = a.Policy.Stats()
+	}
+	writeJSON(w, stats)
+}
+
+func (a *Agent) handleRelease(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ReleaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if a.Policy == nil || !a.Policy.Release(req.FlowID) {
+		http.Error(w, fmt.Sprintf("flow %v is not quarantined", req.FlowID), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, req)
+}
@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"example.com/kzg-demo/policy"
+	"example.com/kzg-demo/types"
+)
+
+// Decide applies the flow's failure policy to a proof the data plane verified: verified and err
+// are the result of Verify or VerifyBound.
+func (a *Agent) Decide(proof *types.Proof, verified bool, err error) *policy.Decision {
+	if a.Policy == nil {
+		return nil
+	}
+	failure := err
+	if !verified && failure == nil {
+		failure = fmt.Errorf("proof does not open the commitment")
+	}
+	decision := a.Policy.Decide(policy.Alert{
+		Node:     a.Name,
+		Flow:     proof.FlowID,
+		Epoch:    proof.Epoch,
+		Version:  proof.Version,
+		Seq:      proof.Seq,
+		Sender:   proof.Node,
+		Previous: a.previous(proof),
+	}, failure)
+	if decision.Outcome != policy.Forward {
+		log.Printf("[%v] flow %v: proof from %v: %v", a.Name, proof.FlowID, proof.Node, decision)
+	}
+	return &decision
+}
+
+// previous returns the hop the route commits before this node for the proof's visit, if known.
+func (a *Agent) previous(proof *types.Proof) string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	epoch, ok := a.epochs[proof.Epoch]
+	if !ok {
+		return ""
+	}
+	visits, ok := epoch.flows[proof.FlowID]
+	if !ok {
+		return ""
+	}
+	flow, err := visitOf(a.settings, visits, proof)
+	if err != nil {
+		return ""
+	}
+	return flow.params.Previous
+}
+
+// applyPolicies installs the policies the controller set on the flows of params; flows without
+// one, or with one this node cannot parse, get the default policy.
+func (a *Agent) applyPolicies(params *types.NodeParams) {
+	if a.Policy == nil {
+		return
+	}
+	policies := make(map[string]policy.Policy)
+	for _, epoch := range params.Epochs {
+		for _, flow := range epoch.Flows {
+			if flow.Policy == "" {
+				continue
+			}
+			p, err := policy.Parse(flow.Policy)
+			if err != nil {
+				log.Printf("[%v] flow %v: %v, using the default policy", a.Name, flow.FlowID, err)
+				continue
+			}
+			policies[flow.FlowID] = p
+		}
+	}
+	a.Policy.SetPolicies(policies)
+}
+
+// sendAlert reports a failed proof to the controller in the background.
+func (a *Agent) sendAlert(alert policy.Alert) {
+	go func() {
+		body, err := json.Marshal(alert)
+		if err != nil {
+			log.Printf("[%v] alert: %v", a.Name, err)
+			return
+		}
+		resp, err := a.do(http.MethodPost, "/alerts", body)
+		if err != nil {
+			log.Printf("[%v] alert: %v", a.Name, err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Printf("[%v] alert: controller returned %v", a.Name, resp.Status)
+		}
+	}()
+}
@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"example.com/kzg-demo/controlplane"
+	"example.com/kzg-demo/types"
+)
+
+// checkTreeHead makes sure every commitment of params is in the controller's transparency log,
+// and that the log only grew since the last tree head this node accepted. A controller that
+// shows this node commitments it does not show others has to fork its log to do so, which shows
+// when tree heads are compared (see TreeHead and cmd/log_audit).
+func (a *Agent) checkTreeHead(params *types.NodeParams) error {
+	head := params.TreeHead
+	if !head.Verify(a.ControllerKey) {
+		return fmt.Errorf("the transparency log head is not signed by the controller")
+	}
+	for _, epoch := range params.Epochs {
+		for _, flow := range epoch.Flows {
+			leafHash := types.LeafHash(types.LogLeaf(flow.FlowID, epoch.Epoch, flow.Version, flow.Commitment))
+			if flow.Inclusion == nil || flow.Inclusion.TreeSize != head.Size || !types.VerifyInclusion(flow.Inclusion, leafHash, head.Root) {
+				return fmt.Errorf("epoch %v: flow %v: the commitment is not in the transparency log", epoch.Epoch, flow.FlowID)
+			}
+		}
+	}
+
+	a.mu.RLock()
+	old := a.treeHead
+	a.mu.RUnlock()
+	if old == nil {
+		return nil
+	}
+	switch {
+	case head.Size < old.Size:
+		return fmt.Errorf("the transparency log shrank from %v to %v leaves", old.Size, head.Size)
+	case head.Size == old.Size:
+		if !bytes.Equal(head.Root, old.Root) {
+			return fmt.Errorf("the transparency log forked at %v leaves", head.Size)
+		}
+		return nil
+	}
+	proof, err := a.fetchConsistency(old.Size, head.Size)
+	if err != nil {
+		return fmt.Errorf("fetch transparency log consistency proof: %w", err)
+	}
+	if !types.VerifyConsistency(old.Size, head.Size, old.Root, head.Root, proof) {
+		return fmt.Errorf("the transparency log of %v leaves does not extend the log of %v leaves it replaces", head.Size, old.Size)
+	}
+	return nil
+}
+
+func (a *Agent) fetchConsistency(first uint64, second uint64) ([][]byte, error) {
+	resp, err := a.client.Get(fmt.Sprintf("%v/log/consistency?first=%v&second=%v", a.ControllerURL, first, second))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("controller returned %v", resp.Status)
+	}
+	var consistency controlplane.ConsistencyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&consistency); err != nil {
+		return nil, err
+	}
+	return consistency.Hashes, nil
+}
+
+// TreeHead returns the last transparency log head this node accepted, for comparison with the
+// heads seen by other nodes and auditors.
+func (a *Agent) TreeHead() *types.TreeHead {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.treeHead
+}
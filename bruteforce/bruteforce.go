@@ -0,0 +1,142 @@
+// Package bruteforce recovers hop secrets from observed proofs by exhaustive search, to show how
+// little a 32-bit secret protects. Today a proof carries its secret X in the clear; the search
+// shows that withholding X would not help either, since a proof and the commitment pin X down.
+//
+// An opening proof pi of P at x to y satisfies e(C - [y]G1, G2) = e(pi, [s - x]G2), that is
+// e(pi, G2)^x = e(pi, [s]G2) / e(C - [y]G1, G2). Both sides are public, so every guess costs one
+// multiplication in GT while walking x upwards. The space is cut into chunks that the workers
+// take in order, so small secrets are found first whatever the number of workers.
+package bruteforce
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	bls12381 "github.com/kilic/bls12-381"
+	gozkg "github.com/protolambda/go-kzg"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// chunk is the number of guesses a worker takes at a time; each chunk starts with one
+// exponentiation in GT.
+const chunk = 1 << 16
+
+// Target is an observed proof of one hop.
+type Target struct {
+	Commitment *bls.G1Point
+	Settings   *gozkg.KZGSettings
+	Y          *bls.Fr // position or label the hop proved
+	Proof      *bls.G1Point
+}
+
+// Result of one search.
+type Result struct {
+	Secret  uint64
+	Found   bool
+	Tried   uint64 // guesses checked by all workers
+	Elapsed time.Duration
+}
+
+// Rate is the number of guesses per second.
+func (r Result) Rate() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Tried) / r.Elapsed.Seconds()
+}
+
+// Estimate is the time in seconds to search a whole space of the given bits at the measured rate,
+// the worst case for a secret drawn from it; the average is half. It is a float because large
+// spaces overflow a time.Duration.
+func (r Result) Estimate(bits int) float64 {
+	rate := r.Rate()
+	if rate == 0 {
+		return 0
+	}
+	return math.Ldexp(1, bits) / rate
+}
+
+func (r Result) String() string {
+	if !r.Found {
+		return fmt.Sprintf("not found after %v guesses in %v", r.Tried, r.Elapsed.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("secret %v found after %v guesses in %v (%.0f guesses/s)", r.Secret, r.Tried, r.Elapsed.Round(time.Millisecond), r.Rate())
+}
+
+// Recover searches the secrets below 2^bits with the given number of workers.
+func Recover(t *Target, bits int, workers int) (Result, error) {
+	if bits < 1 || bits > 63 {
+		return Result{}, fmt.Errorf("cannot search %v bits", bits)
+	}
+	workers = max(workers, 1)
+
+	g1 := bls12381.NewG1()
+	proof, err := g1.FromCompressed(bls.ToCompressedG1(t.Proof))
+	if err != nil {
+		return Result{}, err
+	}
+	commitment, err := g1.FromCompressed(bls.ToCompressedG1(t.Commitment))
+	if err != nil {
+		return Result{}, err
+	}
+	secretG2, err := bls12381.NewG2().FromCompressed(bls.ToCompressedG2(&t.Settings.SecretG2[1]))
+	if err != nil {
+		return Result{}, err
+	}
+	y, ok := new(big.Int).SetString(t.Y.String(), 10)
+	if !ok {
+		return Result{}, fmt.Errorf("invalid y %v", t.Y)
+	}
+
+	// base = e(pi, G2), target = e(pi, [s]G2) / e(C - [y]G1, G2)
+	g2One := bls12381.NewG2().One()
+	base := bls12381.NewEngine().AddPair(proof, g2One).Result()
+	shifted := g1.New()
+	g1.MulScalarBig(shifted, g1.One(), y)
+	g1.Sub(shifted, commitment, shifted)
+	target := bls12381.NewEngine().AddPair(proof, secretG2).AddPairInv(shifted, g2One).Result()
+
+	space := uint64(1) << bits
+	var next, tried atomic.Uint64
+	var found atomic.Bool
+	var secret uint64
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gt := bls12381.NewGT()
+			acc := gt.New()
+			for !found.Load() {
+				lo := next.Add(chunk) - chunk
+				if lo >= space {
+					return
+				}
+				hi := min(lo+chunk, space)
+				gt.Exp(acc, base, new(big.Int).SetUint64(lo))
+				for x := lo; x < hi; x++ {
+					if acc.Equal(target) {
+						mu.Lock()
+						if !found.Load() || x < secret {
+							secret = x
+						}
+						found.Store(true)
+						mu.Unlock()
+						tried.Add(x - lo + 1)
+						return
+					}
+					gt.Mul(acc, acc, base)
+				}
+				tried.Add(hi - lo)
+			}
+		}()
+	}
+	wg.Wait()
+	return Result{Secret: secret, Found: found.Load(), Tried: tried.Load(), Elapsed: time.Since(start)}, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+
+	"example.com/kzg-demo/controlplane"
+)
+
+// usage: go run ./cmd/audit_verify -log ./run/audit.log -controller-key <hex> [-head <seq>:<hash>]
+// the head is printed by the controller and served on GET /audit; without it, entries removed
+// from the end of the log cannot be detected
+
+func main() {
+	logPath := flag.String("log", "./run/audit.log", "audit log written by the controller")
+	controllerKey := flag.String("controller-key", "", "hex public key of the controller")
+	expected := flag.String("head", "", "head recorded earlier, <seq>:<hash>; the log must still contain it")
+	flag.Parse()
+
+	key, err := hex.DecodeString(*controllerKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		log.Fatal("-controller-key must be the hex public key of the controller")
+	}
+
+	head, n, err := controlplane.VerifyAuditLog(*logPath, key)
+	if err != nil {
+		log.Fatalf("%v: verification FAILED after %v valid entries: %v", *logPath, n, err)
+	}
+	if n == 0 {
+		log.Fatalf("%v: the log is empty", *logPath)
+	}
+
+	if *expected != "" {
+		want, err := controlplane.ParseAuditHead(*expected)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if want.Seq > head.Seq {
+			log.Fatalf("%v: verification FAILED: the log ends at entry %v, but entry %v was recorded; it was truncated", *logPath, head.Seq, want.Seq)
+		}
+		// the entry at want.Seq must still be the recorded one
+		entries, err := controlplane.ReadAuditLog(*logPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if entries[want.Seq].Hash != want.Hash {
+			log.Fatalf("%v: verification FAILED: entry %v does not match the recorded head; the log was rewritten", *logPath, want.Seq)
+		}
+	}
+
+	fmt.Printf("%v: %v entries verified, head %v\n", *logPath, n, head)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	mrand "math/rand"
+	"runtime"
+	"strings"
+	"time"
+
+	"example.com/kzg-demo/bruteforce"
+	"example.com/kzg-demo/types"
+)
+
+// usage: go run ./cmd/bruteforce [-route ABC] [-secret-bits 20] [-bits 32] [-workers 8]
+// commits a route, observes one proof per hop and recovers every secret from the commitment and
+// the proof alone, as if the proofs did not carry X; prints the time to recover and what a full
+// search of larger spaces would take at the same rate
+
+func main() {
+	routeFlag := flag.String("route", "ABC", "committed route, one letter per node")
+	secretBits := flag.Int("secret-bits", 20, "draw the secrets below 2^bits; the controller uses rand.Int31, 31 bits, which takes long on a laptop")
+	bits := flag.Int("bits", 32, "search the secrets below 2^bits")
+	workers := flag.Int("workers", runtime.NumCPU(), "parallel workers")
+	flag.Parse()
+
+	nodes := strings.Split(*routeFlag, "")
+	secrets := make([]uint32, len(nodes))
+	used := make(map[uint32]bool)
+	for i := range secrets {
+		for secrets[i] == 0 || used[secrets[i]] {
+			secrets[i] = uint32(mrand.Int63n(int64(1) << *secretBits))
+		}
+		used[secrets[i]] = true
+	}
+	var controller types.Controller
+	if _, _, err := controller.Setup(secrets); err != nil {
+		log.Fatal(err)
+	}
+	commitment := controller.Commit()
+
+	fmt.Printf("route %v, secrets below 2^%v, searching 2^%v with %v workers\n", *routeFlag, *secretBits, *bits, *workers)
+	var total bruteforce.Result
+	for i, name := range nodes {
+		proof := controller.KzgSettings.ComputeProofSingle(controller.Polynomial, uint64(secrets[i]))
+		fmt.Printf("%v: the proof reveals X = %v in the clear\n", name, secrets[i])
+
+		result, err := bruteforce.Recover(&bruteforce.Target{
+			Commitment: commitment,
+			Settings:   controller.KzgSettings,
+			Y:          controller.Position(i),
+			Proof:      proof,
+		}, *bits, *workers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%v: without X, %v\n", name, result)
+		if result.Found && result.Secret != uint64(secrets[i]) {
+			log.Fatalf("%v: recovered %v, but the secret is %v", name, result.Secret, secrets[i])
+		}
+		total.Tried += result.Tried
+		total.Elapsed += result.Elapsed
+	}
+
+	fmt.Printf("worst case at %.0f guesses/s per proof:", total.Rate())
+	for _, space := range []int{31, 32, 48, 64} {
+		fmt.Printf(" 2^%v: %v,", space, roundEstimate(total.Estimate(space)))
+	}
+	fmt.Println(" a random field element is out of reach")
+}
+
+func roundEstimate(seconds float64) string {
+	const year = 365 * 24 * time.Hour
+	if seconds >= year.Seconds() {
+		return fmt.Sprintf("%.3g years", seconds/year.Seconds())
+	}
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
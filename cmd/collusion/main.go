@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"log"
+	mrand "math/rand"
+	"os"
+	"strings"
+
+	"example.com/kzg-demo/collusion"
+	"example.com/kzg-demo/diagnose"
+	"example.com/kzg-demo/types"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// usage: go run ./cmd/collusion -route ABCDE -colluders B,D [-given-polynomial=false] [-observed] [-pad-degree 8] [-hide-positions]
+// sets up a route, hands the colluders what a node would have, and prints what they can forge;
+// every forged proof is checked with CheckProofSingle against the committed route, and every
+// skipped segment with the checks the next hop runs, chain link included
+
+func main() {
+	routeFlag := flag.String("route", "ABCDE", "committed route, one letter per node")
+	colludersFlag := flag.String("colluders", "B,D", "comma-separated colluding nodes")
+	givenPolynomial := flag.Bool("given-polynomial", true, "the controller hands the route polynomial to the nodes, as agents get it today")
+	observed := flag.Bool("observed", false, "the colluders saw an earlier packet, with the proofs of every hop up to the last colluder")
+	padDegree := flag.Int("pad-degree", 0, "pad the polynomial to this degree with random dummy points")
+	hidePositions := flag.Bool("hide-positions", false, "prove position labels; the colluders hold the route key")
+	flag.Parse()
+
+	nodes := strings.Split(*routeFlag, "")
+	colluders := strings.Split(*colludersFlag, ",")
+
+	controller := types.Controller{PaddedDegree: *padDegree}
+	if *hidePositions {
+		controller.RouteKey = make([]byte, 32)
+		if _, err := rand.Read(controller.RouteKey); err != nil {
+			log.Fatal(err)
+		}
+	}
+	secrets := make([]uint32, len(nodes))
+	used := make(map[uint32]bool)
+	for i := range secrets {
+		for secrets[i] == 0 || used[secrets[i]] {
+			secrets[i] = uint32(mrand.Int31())
+		}
+		used[secrets[i]] = true
+	}
+	if _, _, err := controller.Setup(secrets); err != nil {
+		log.Fatal(err)
+	}
+	route := &diagnose.Route{
+		Nodes:      nodes,
+		Ys:         make([]bls.Fr, len(nodes)),
+		Commitment: controller.Commit(),
+		Settings:   controller.KzgSettings,
+		Keys:       make(map[string]ed25519.PublicKey),
+	}
+	hopKeys := make(map[string]ed25519.PrivateKey)
+	for i, name := range nodes {
+		bls.CopyFr(&route.Ys[i], controller.Position(i))
+		if _, ok := hopKeys[name]; !ok {
+			public, key, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				log.Fatal(err)
+			}
+			route.Keys[name] = public
+			hopKeys[name] = key
+		}
+	}
+
+	view := &collusion.View{Route: route, Colluders: colluders, Secrets: make(map[int]uint64), HopKeys: make(map[string]ed25519.PrivateKey)}
+	last := 0
+	for i, name := range nodes {
+		for _, colluder := range colluders {
+			if name == colluder {
+				view.Secrets[i+1] = uint64(secrets[i])
+				view.HopKeys[name] = hopKeys[name]
+				last = i + 1
+			}
+		}
+	}
+	if last == 0 {
+		log.Fatalf("none of %v is on route %v", *colludersFlag, *routeFlag)
+	}
+	if *givenPolynomial {
+		view.Polynomial = controller.Polynomial
+	}
+	if *observed {
+		// the openings of an earlier packet, chained by the honest hops
+		earlier := make([]byte, 64)
+		if _, err := rand.Read(earlier); err != nil {
+			log.Fatal(err)
+		}
+		var prev []byte
+		for i := 0; i < last; i++ {
+			proof := &types.Proof{
+				Node:  nodes[i],
+				X:     fmt.Sprint(secrets[i]),
+				Y:     route.Ys[i].String(),
+				Proof: controller.KzgSettings.ComputeProofSingle(controller.Polynomial, uint64(secrets[i])),
+			}
+			proof.Bind(hopKeys[nodes[i]], prev, types.PacketDigest(earlier))
+			prev = proof.Chain
+			view.Observed = append(view.Observed, proof)
+		}
+	}
+
+	packet := make([]byte, 64)
+	if _, err := rand.Read(packet); err != nil {
+		log.Fatal(err)
+	}
+	analysis, err := collusion.Analyze(view, types.PacketDigest(packet))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("route %v\n", *routeFlag)
+	fmt.Println(analysis)
+
+	// the recovered secrets must be the ones the controller drew
+	for position, x := range analysis.Recovered {
+		var real bls.Fr
+		bls.AsFr(&real, uint64(secrets[position-1]))
+		if !bls.EqualFr(&x, &real) {
+			fmt.Printf("  position %v: recovered another root of P(X) - y, the real secret is %v\n", position, secrets[position-1])
+		}
+	}
+	for _, f := range analysis.Forgeries {
+		if f.Proof != nil && !f.Valid {
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/kzg-demo/controlplane"
+	"example.com/kzg-demo/keystore"
+	"example.com/kzg-demo/policy"
+	"example.com/kzg-demo/reputation"
+	"example.com/kzg-demo/types"
+)
+
+// usage:
+//   go run ./cmd/controller -listen :8080 -state ./run/controller.json
+//   go run ./cmd/controller -epoch 5m -lead 30s -grace 1m
+//   go run ./cmd/controller -signing-key ./run/controller.key
+//   go run ./cmd/controller -signing-key ./run/controller.key -audit ./run/audit.log
+//   VCPOT_PASSPHRASE=... go run ./cmd/controller -state ./run/controller.json -encrypt
+//   curl -H "Authorization: Bearer $(cat operator.credential)" -X POST localhost:8080/flows -d '{"FlowID":"f1","Route":"ABC"}'
+//   curl -H "Authorization: Bearer $(cat operator.credential)" -X POST localhost:8080/policies -d '{"FlowID":"f1","Policy":"quarantine+alert"}'
+//   go run ./cmd/controller -reputation-threshold 5 -reputation-action revoke
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to serve node agents on")
+	statePath := flag.String("state", "", "state file to restore from and snapshot into; in-memory only if empty")
+	epochLength := flag.Duration("epoch", 0, "rotate node secrets and polynomials every epoch; disabled if 0")
+	lead := flag.Duration("lead", 10*time.Second, "publish the next epoch this long before it activates")
+	grace := flag.Duration("grace", 30*time.Second, "keep accepting the previous epoch this long after a rotation")
+	paddedDegree := flag.Int("pad-degree", 0, "pad route polynomials to this degree to hide route lengths; 0 disables")
+	hidePositions := flag.Bool("hide-positions", false, "commit new flows against position labels instead of hop indices")
+	lagrange := flag.Bool("lagrange", false, "commit routes in Lagrange form, so one-hop route changes update commitments and openings in place")
+	encrypt := flag.Bool("encrypt", false, "encrypt the state file with the passphrase in $VCPOT_PASSPHRASE")
+	signingKeyPath := flag.String("signing-key", "", "Ed25519 key that signs the parameters, created if missing; ephemeral if empty")
+	auditPath := flag.String("audit", "", "append a signed, hash-chained record of every controller action to this file; requires -signing-key")
+	threshold := flag.Int("reputation-threshold", 5, "reported failures within the window at which a node is rerouted around or revoked; 0 disables")
+	window := flag.Duration("reputation-window", 10*time.Minute, "how long a reported failure counts against a node; 0 never forgets")
+	reporters := flag.Int("reputation-reporters", 1, "distinct verifiers that must report a node before it is acted on")
+	action := flag.String("reputation-action", "reroute", "what to do with a node that crosses the threshold: reroute or revoke")
+	operatorPath := flag.String("operator-credential", "operator.credential", "file holding the credential admin requests must carry, created if missing")
+	flag.Parse()
+
+	service := controlplane.NewService()
+	if *statePath != "" {
+		store := controlplane.NewStore(*statePath)
+		if *encrypt {
+			passphrase, err := keystore.PassphraseFromEnv("VCPOT_PASSPHRASE")
+			if err != nil {
+				log.Fatal(err)
+			}
+			store = controlplane.NewEncryptedStore(*statePath, passphrase)
+		}
+
+		var err error
+		service, err = controlplane.OpenService(store)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("restored %v nodes and %v flows from %v", len(service.Snapshot().Nodes), len(service.Flows()), *statePath)
+	}
+
+	if *signingKeyPath != "" {
+		var passphrase []byte
+		if *encrypt {
+			var err error
+			if passphrase, err = keystore.PassphraseFromEnv("VCPOT_PASSPHRASE"); err != nil {
+				log.Fatal(err)
+			}
+		}
+		signingKey, err := controlplane.LoadSigningKey(*signingKeyPath, passphrase)
+		if err != nil {
+			log.Fatal(err)
+		}
+		service.SigningKey = signingKey
+	}
+	log.Printf("controller key: %x", service.PublicKey())
+
+	operator, err := controlplane.LoadOperatorCredential(*operatorPath)
+	if err != nil {
+		log.Fatalf("operator credential: %v", err)
+	}
+	if err := service.SetOperatorCredential(operator); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("operator credential in %v", *operatorPath)
+
+	if *auditPath != "" {
+		if *signingKeyPath == "" {
+			log.Fatal("-audit requires -signing-key, so the log stays verifiable across restarts")
+		}
+		audit, err := controlplane.OpenAuditLog(*auditPath, service.SigningKey)
+		if err != nil {
+			log.Fatalf("audit log: %v", err)
+		}
+		defer audit.Close()
+		service.SetAuditLog(audit)
+		log.Printf("audit log %v, head %v", *auditPath, audit.Head())
+	}
+
+	service.Grace = *grace
+	service.PaddedDegree = *paddedDegree
+	service.HidePositions = *hidePositions
+	if *lagrange {
+		if *paddedDegree > 0 || *hidePositions {
+			log.Fatal("-lagrange cannot be combined with -pad-degree or -hide-positions")
+		}
+		// the domain matches the 16 roots of unity nodes derive from the setup
+		settings, err := types.NewLagrangeSettings(4)
+		if err != nil {
+			log.Fatal(err)
+		}
+		service.Lagrange = settings
+	}
+	service.OnAlert = func(alert policy.Alert) {
+		log.Printf("alert from %v: flow %v, proof from %v (seq %v): %v", alert.Node, alert.Flow, alert.Sender, alert.Seq, alert.Reason)
+	}
+	if *threshold > 0 {
+		reputationAction, err := reputation.ParseAction(*action)
+		if err != nil {
+			log.Fatal(err)
+		}
+		service.Reputation = reputation.NewTracker(*threshold, *window)
+		service.Reputation.MinReporters = *reporters
+		service.ReputationAction = reputationAction
+		service.OnEnforce = func(enforcement controlplane.Enforcement) {
+			log.Printf("reputation: %v", enforcement)
+		}
+	}
+
+	if *epochLength > 0 {
+		if *lead >= *epochLength {
+			log.Fatal("-lead must be shorter than -epoch")
+		}
+		go service.RunRotation(context.Background(), *epochLength, *lead, func(err error) {
+			log.Printf("rotation failed: %v", err)
+		})
+	}
+
+	log.Printf("controller listening on %v", *listen)
+	log.Fatal(http.ListenAndServe(*listen, service.Handler()))
+}
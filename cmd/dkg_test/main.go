@@ -0,0 +1,11 @@
+package main
+
+import (
+	"example.com/kzg-demo/kzgtest"
+)
+
+func main() {
+	for _, n := range []int{3, 5, 8, 10, 20} {
+		kzgtest.RunDKG(n)
+	}
+}
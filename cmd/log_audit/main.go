@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"example.com/kzg-demo/controlplane"
+	"example.com/kzg-demo/types"
+)
+
+// usage: go run ./cmd/log_audit -controller http://localhost:8080 -controller-key <hex> \
+//          -nodes http://localhost:9001,http://localhost:9002
+//
+// Collects the transparency log heads the controller and the node agents hold and checks that
+// they are all consistent with each other. A controller that showed different commitments to
+// different parties must have forked its log, and at least one pair of heads fails the check.
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+func main() {
+	controller := flag.String("controller", "http://localhost:8080", "controller URL")
+	controllerKey := flag.String("controller-key", "", "hex public key of the controller")
+	nodes := flag.String("nodes", "", "comma-separated node agent URLs whose tree heads to compare")
+	flag.Parse()
+
+	key, err := hex.DecodeString(*controllerKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		log.Fatal("-controller-key must be the hex public key of the controller")
+	}
+
+	latest, err := fetchHead(*controller + "/log/head")
+	if err != nil {
+		log.Fatalf("controller: %v", err)
+	}
+	if !latest.Verify(key) {
+		log.Fatalf("controller: the tree head is not signed by the controller key")
+	}
+	fmt.Printf("controller: %v leaves, root %x\n", latest.Size, latest.Root)
+
+	failed := false
+	for _, node := range strings.Split(*nodes, ",") {
+		if node == "" {
+			continue
+		}
+		head, err := fetchHead(node + "/treehead")
+		if err != nil {
+			fmt.Printf("%v: %v\n", node, err)
+			failed = true
+			continue
+		}
+		if err := check(*controller, key, head, latest); err != nil {
+			fmt.Printf("%v: %v leaves, root %x: INCONSISTENT: %v\n", node, head.Size, head.Root, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%v: %v leaves, root %x: consistent\n", node, head.Size, head.Root)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// check verifies that head is a signed prefix of latest.
+func check(controller string, key ed25519.PublicKey, head *types.TreeHead, latest *types.TreeHead) error {
+	if !head.Verify(key) {
+		return fmt.Errorf("not signed by the controller key")
+	}
+	if head.Size > latest.Size {
+		return fmt.Errorf("ahead of the controller's own log of %v leaves", latest.Size)
+	}
+	if head.Size == latest.Size {
+		if !bytes.Equal(head.Root, latest.Root) {
+			return fmt.Errorf("the log forked at %v leaves", head.Size)
+		}
+		return nil
+	}
+	resp, err := client.Get(fmt.Sprintf("%v/log/consistency?first=%v&second=%v", controller, head.Size, latest.Size))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("consistency proof: controller returned %v", resp.Status)
+	}
+	var consistency controlplane.ConsistencyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&consistency); err != nil {
+		return err
+	}
+	if !types.VerifyConsistency(head.Size, latest.Size, head.Root, latest.Root, consistency.Hashes) {
+		return fmt.Errorf("not a prefix of the controller's log of %v leaves", latest.Size)
+	}
+	return nil
+}
+
+func fetchHead(url string) (*types.TreeHead, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v returned %v", url, resp.Status)
+	}
+	var head types.TreeHead
+	if err := json.NewDecoder(resp.Body).Decode(&head); err != nil {
+		return nil, err
+	}
+	return &head, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"example.com/kzg-demo/agent"
+	"example.com/kzg-demo/controlplane"
+	"example.com/kzg-demo/keystore"
+	"example.com/kzg-demo/policy"
+	"example.com/kzg-demo/replay"
+)
+
+// usage:
+//   go run ./cmd/node_agent -name A -controller http://localhost:8080 -controller-key <hex> -listen :9001
+//   go run ./cmd/node_agent -name A -controller-key <hex> -credential ./run/A.credential -hop-key ./run/A.hopkey
+//   curl -X POST localhost:9001/prove -d '{"FlowID":"f1"}'
+//
+// with -keystore, the passphrase is read from $VCPOT_PASSPHRASE, and seals the hop key as well
+
+func main() {
+	name := flag.String("name", "", "node name, e.g., A")
+	controller := flag.String("controller", "http://localhost:8080", "controller URL")
+	listen := flag.String("listen", ":9001", "address to serve the local prove/verify API on")
+	poll := flag.Duration("poll", 5*time.Second, "interval between parameter syncs")
+	keystorePath := flag.String("keystore", "", "encrypted cache of the node's parameters; disabled if empty")
+	controllerKey := flag.String("controller-key", "", "hex public key the controller logs at startup; parameters not signed with it are refused")
+	replayWindow := flag.Int("replay-window", replay.DefaultWindow, "sequence numbers tracked per flow to refuse replayed proofs; 0 disables the check")
+	credentialPath := flag.String("credential", "", "file the controller-issued credential is kept in, so the node can register again after a restart; memory only if empty")
+	hopKeyPath := flag.String("hop-key", "", "file the key signing this node's chain links is kept in; ephemeral if empty")
+	defaultPolicy := flag.String("policy", "drop", "failure policy for flows the controller set none on: drop, mark or quarantine, optionally with +alert")
+	flag.Parse()
+
+	if *name == "" {
+		log.Fatal("-name is required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	a := agent.New(*name, *controller)
+	a.PollInterval = *poll
+	a.CredentialPath = *credentialPath
+	key, err := hex.DecodeString(*controllerKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		log.Fatal("-controller-key must be the hex public key of the controller")
+	}
+	a.ControllerKey = key
+	a.Replay = nil
+	if *replayWindow > 0 {
+		a.Replay = replay.NewDetector(*replayWindow)
+	}
+	p, err := policy.Parse(*defaultPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	a.Policy.Default = p
+	var passphrase []byte
+	if *keystorePath != "" {
+		passphrase, err = keystore.PassphraseFromEnv("VCPOT_PASSPHRASE")
+		if err != nil {
+			log.Fatal(err)
+		}
+		a.Keystore = keystore.New(*keystorePath, passphrase)
+	}
+	if *hopKeyPath != "" {
+		if a.HopKey, err = controlplane.LoadSigningKey(*hopKeyPath, passphrase); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	go func() {
+		log.Printf("[%v] local API listening on %v", *name, *listen)
+		log.Fatal(http.ListenAndServe(*listen, a.Handler()))
+	}()
+
+	if err := a.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
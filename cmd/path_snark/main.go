@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+
+	"example.com/kzg-demo/snark"
+	"example.com/kzg-demo/types"
+	"example.com/kzg-demo/utils"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// usage:
+//   go run ./cmd/path_snark setup -hops 4 -pk ./run/path.pk -vk ./run/path.vk
+//   go run ./cmd/path_snark prove -pk ./run/path.pk -secrets 98765,4321,1111,2468 -packet hello -out ./run/path.json
+//   go run ./cmd/path_snark verify -vk ./run/path.vk -in ./run/path.json
+// setup runs the circuit-specific Groth16 setup for a route shape and discards the trapdoor.
+// prove plays the controller and the egress: it commits a route, collects and checks the openings
+// of every hop as the egress would receive them, and proves the whole path at once.
+// verify plays the auditor: it only needs the verifying key, the KZG setup, the commitment, the
+// positions and the packet digest.
+
+// keyFile holds a key together with the route shape it was set up for.
+type keyFile struct {
+	Hops         int
+	Coefficients int
+	ProvingKey   *snark.ProvingKey   `json:",omitempty"`
+	VerifyingKey *snark.VerifyingKey `json:",omitempty"`
+}
+
+type pathFile struct {
+	Setup        types.SetupParams
+	Commitment   *bls.G1Point
+	Positions    []string // decimal, in route order
+	PacketDigest []byte
+	Path         *snark.PathProof
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatalf("usage: path_snark setup|prove|verify [flags]")
+	}
+	var err error
+	switch os.Args[1] {
+	case "setup":
+		err = setup(os.Args[2:])
+	case "prove":
+		err = prove(os.Args[2:])
+	case "verify":
+		err = verify(os.Args[2:])
+	default:
+		err = fmt.Errorf("unknown command %v", os.Args[1])
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func setup(args []string) error {
+	flags := flag.NewFlagSet("setup", flag.ExitOnError)
+	hops := flags.Int("hops", 4, "number of hops of the route")
+	paddedDegree := flags.Int("pad-degree", 0, "degree the route polynomial is padded to; 0 disables")
+	pkPath := flags.String("pk", "./run/path.pk", "where to write the proving key")
+	vkPath := flags.String("vk", "./run/path.vk", "where to write the verifying key")
+	flags.Parse(args)
+
+	if *hops < 3 {
+		return fmt.Errorf("a route needs at least 3 hops")
+	}
+	coefficients := *hops
+	if *paddedDegree > 0 {
+		if *hops > *paddedDegree+1 {
+			return fmt.Errorf("%v hops do not fit in a polynomial of degree %v", *hops, *paddedDegree)
+		}
+		coefficients = *paddedDegree + 1
+	}
+	pk, vk, err := snark.PathSetup(*hops, coefficients)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(*pkPath, keyFile{Hops: *hops, Coefficients: coefficients, ProvingKey: pk}); err != nil {
+		return err
+	}
+	if err := writeJSON(*vkPath, keyFile{Hops: *hops, Coefficients: coefficients, VerifyingKey: vk}); err != nil {
+		return err
+	}
+	fmt.Printf("Circuit for %v hops and %v coefficients set up: %v constraints, keys written to %v and %v\n",
+		*hops, coefficients, pk.Constraints, *pkPath, *vkPath)
+	return nil
+}
+
+func prove(args []string) error {
+	flags := flag.NewFlagSet("prove", flag.ExitOnError)
+	pkPath := flags.String("pk", "./run/path.pk", "proving key written by setup")
+	secretsStr := flags.String("secrets", "", "comma-separated hop secrets in route order; random if empty")
+	packet := flags.String("packet", "packet", "packet the path is proven for")
+	out := flags.String("out", "./run/path.json", "where to write the path proof")
+	flags.Parse(args)
+
+	var key keyFile
+	if err := readJSON(*pkPath, &key); err != nil {
+		return err
+	}
+	if key.ProvingKey == nil {
+		return fmt.Errorf("%v holds no proving key", *pkPath)
+	}
+
+	nodesPrivateData := make([]uint32, 0)
+	if *secretsStr != "" {
+		for _, field := range strings.Split(*secretsStr, ",") {
+			data, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32)
+			if err != nil {
+				return err
+			}
+			nodesPrivateData = append(nodesPrivateData, uint32(data))
+		}
+	} else {
+		for i := 0; i < key.Hops; i++ {
+			nodesPrivateData = append(nodesPrivateData, uint32(rand.Int31()))
+		}
+	}
+	if len(nodesPrivateData) != key.Hops {
+		return fmt.Errorf("the key is for %v hops, got %v secrets", key.Hops, len(nodesPrivateData))
+	}
+
+	controller := types.Controller{}
+	if key.Coefficients > key.Hops {
+		controller.PaddedDegree = key.Coefficients - 1
+	}
+	if _, _, err := controller.Setup(nodesPrivateData); err != nil {
+		return err
+	}
+	if len(controller.Polynomial) > key.Coefficients {
+		return fmt.Errorf("the key is for %v coefficients, the route has %v", key.Coefficients, len(controller.Polynomial))
+	}
+	ks := controller.KzgSettings
+	commitment := controller.Commit()
+	// vanishing leading coefficients do not change the commitment
+	polynomial := append(controller.Polynomial, make([]bls.Fr, key.Coefficients-len(controller.Polynomial))...)
+
+	// the openings the egress receives, one per hop, each checked as the next hop would
+	xs := make([]bls.Fr, len(nodesPrivateData))
+	ys := make([]bls.Fr, len(nodesPrivateData))
+	positions := make([]string, len(nodesPrivateData))
+	for i, data := range nodesPrivateData {
+		bls.AsFr(&xs[i], uint64(data))
+		bls.CopyFr(&ys[i], controller.Position(i))
+		positions[i] = ys[i].String()
+		if !ks.CheckProofSingle(commitment, ks.ComputeProofSingle(polynomial, uint64(data)), &xs[i], &ys[i]) {
+			return fmt.Errorf("opening of hop %v does not verify", i+1)
+		}
+	}
+
+	digest := types.PacketDigest([]byte(*packet))
+	path, err := snark.ProvePath(key.ProvingKey, ks, polynomial, xs, ys, digest)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(*out, pathFile{
+		Setup:        types.SetupParams{SecretG1: ks.SecretG1, SecretG2: ks.SecretG2},
+		Commitment:   commitment,
+		Positions:    positions,
+		PacketDigest: digest,
+		Path:         path,
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("Path of %v hops proven in %v bytes instead of %v openings, written to %v\n",
+		len(xs), snark.PathProofSize, len(xs), *out)
+	return nil
+}
+
+func verify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	vkPath := flags.String("vk", "./run/path.vk", "verifying key written by setup")
+	in := flags.String("in", "./run/path.json", "path proof written by prove")
+	flags.Parse(args)
+
+	var key keyFile
+	if err := readJSON(*vkPath, &key); err != nil {
+		return err
+	}
+	if key.VerifyingKey == nil {
+		return fmt.Errorf("%v holds no verifying key", *vkPath)
+	}
+	var file pathFile
+	if err := readJSON(*in, &file); err != nil {
+		return err
+	}
+	if file.Commitment == nil || len(file.Setup.SecretG1) < 2 || len(file.Setup.SecretG1) != len(file.Setup.SecretG2) {
+		return fmt.Errorf("malformed path proof")
+	}
+	positions := make([]bls.Fr, len(file.Positions))
+	for i, position := range file.Positions {
+		if err := types.FrFromString(&positions[i], position); err != nil {
+			return fmt.Errorf("position %v: %w", i+1, err)
+		}
+	}
+
+	ks := types.KzgSettingsFromSetup(file.Setup.SecretG1, file.Setup.SecretG2)
+	err := snark.VerifyPath(key.VerifyingKey, ks, file.Commitment, positions, file.PacketDigest, file.Path)
+	fmt.Printf("Path of %v hops verified: %v\n", len(positions), err == nil)
+	return err
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(path, data)
+}
+
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
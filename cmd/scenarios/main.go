@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"example.com/kzg-demo/scenario"
+)
+
+// usage: go run ./cmd/scenarios [-run <name>] [-v]
+// plays the scripted attacks and exits non-zero if any verdict differs from the expected one
+
+func main() {
+	only := flag.String("run", "", "run only the scenario with this name")
+	verbose := flag.Bool("v", false, "print the egress diagnosis of every scenario")
+	flag.Parse()
+
+	failed, ran := 0, 0
+	for _, s := range scenario.All() {
+		if *only != "" && s.Name != *only {
+			continue
+		}
+		ran++
+		result, err := scenario.Run(s)
+		if err != nil {
+			log.Fatalf("%v: %v", s.Name, err)
+		}
+		fmt.Println(result)
+		if *verbose {
+			fmt.Printf("  route %v: %v\n", s.Route, s.Description)
+			if result.Report != nil {
+				fmt.Printf("  %v\n", strings.ReplaceAll(result.Report.String(), "\n", "\n  "))
+			}
+		}
+		if !result.Passed {
+			failed++
+		}
+	}
+	if ran == 0 {
+		log.Fatalf("no scenario named %q", *only)
+	}
+	fmt.Printf("%v/%v scenarios passed\n", ran-failed, ran)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
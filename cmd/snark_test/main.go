@@ -0,0 +1,11 @@
+package main
+
+import (
+	"example.com/kzg-demo/kzgtest"
+)
+
+func main() {
+	for _, n := range []int{3, 5, 10, 20, 50} {
+		kzgtest.RunPathSNARK(n)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"example.com/kzg-demo/controlplane"
+	"example.com/kzg-demo/keystore"
+)
+
+// usage: go run ./cmd/state_dump -state ./run/controller.json
+// encrypted state files are opened with the passphrase in $VCPOT_PASSPHRASE
+// node secrets and polynomial coefficients are never printed
+
+func main() {
+	statePath := flag.String("state", "./run/controller.json", "state file written by the controller")
+	flag.Parse()
+
+	store := controlplane.NewStore(*statePath)
+	if os.Getenv("VCPOT_PASSPHRASE") != "" {
+		store = controlplane.NewEncryptedStore(*statePath, []byte(os.Getenv("VCPOT_PASSPHRASE")))
+	}
+
+	state, err := store.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if state == nil {
+		log.Fatalf("%v does not exist", *statePath)
+	}
+
+	fmt.Printf("State file: %v (format %v, saved at %v)\n", *statePath, state.FormatVersion, state.SavedAt)
+
+	fmt.Printf("Nodes: %v\n", len(state.Nodes))
+	for _, name := range state.Nodes {
+		fmt.Printf("  %v\n", name)
+	}
+
+	fmt.Printf("Routes: %v\n", len(state.Routes))
+	for _, route := range state.Routes {
+		fmt.Printf("  %v: route %v, version %v\n", route.ID, route.Route, route.Version)
+	}
+
+	fmt.Printf("Epochs: %v\n", len(state.Epochs))
+	for _, epoch := range state.Epochs {
+		fmt.Printf("  epoch %v: activates at %v, %v node secrets %v\n", epoch.ID, epoch.ActivatesAt, len(epoch.Secrets), keystore.Redacted)
+		for _, flow := range epoch.Flows {
+			commitment, _ := flow.Commitment.MarshalText()
+			fmt.Printf("    %v: version %v, %v coefficients %v\n", flow.ID, flow.Version, len(flow.Polynomial), keystore.Redacted)
+			fmt.Printf("      commitment %s\n", commitment)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// Package collusion works out what a set of colluding route nodes can forge, and demonstrates it
+// with concrete proofs checked by CheckProofSingle.
+//
+// A hop's proof is an opening of the route polynomial P at the hop's secret x to its position y.
+// Anyone who can evaluate P and find an x with P(x) = y proves that position: the colluders
+// recover P either from the controller, which hands it to every node, or by interpolating the
+// points they know (their own secrets and the X revealed by earlier proofs), checked against the
+// commitment. The roots of P(X) - y then give the secrets of every other hop, and an opening seen
+// on an earlier packet opens the commitment without P. A forged opening is only half a hop though:
+// its chain link must be signed with the hop key of the node the route commits there, and the
+// colluders hold no hop key but their own, so the next honest hop refuses every forged link.
+package collusion
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"sort"
+	"strings"
+
+	"example.com/kzg-demo/diagnose"
+	"example.com/kzg-demo/types"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+type Method int
+
+const (
+	None    Method = iota
+	Own            // a colluder's own hop
+	Root           // a root of P(X) - y
+	Rebound        // an opening observed on an earlier packet, its link re-hashed for the new one
+)
+
+func (m Method) String() string {
+	switch m {
+	case None:
+		return "not forgeable"
+	case Own:
+		return "own hop"
+	case Root:
+		return "root of P(X) - y"
+	case Rebound:
+		return "observed opening, re-bound"
+	}
+	return fmt.Sprintf("Method(%d)", int(m))
+}
+
+// View is what the colluders know. Route.Keys is only used to check the forged chain as the next
+// hop would.
+type View struct {
+	Route      *diagnose.Route
+	Colluders  []string
+	Secrets    map[int]uint64                // secret of every position, from 1, held by a colluder
+	HopKeys    map[string]ed25519.PrivateKey // hop key of every colluder
+	Polynomial []bls.Fr                      // nil if the nodes are not given the polynomial
+	Observed   []*types.Proof                // proofs seen on earlier packets
+}
+
+// Forgery is a proof the colluders produced for a position.
+type Forgery struct {
+	Position int
+	Node     string
+	Method   Method
+	Proof    *types.Proof
+	Valid    bool // CheckProofSingle accepts it against the commitment
+}
+
+// Segment is a run of hops between two colluders that can be left out of the path.
+type Segment struct {
+	From, To int // colluder positions around the segment, from 1
+	Skipped  []string
+	Verified bool   // a forged chain across it passed the hop checks
+	Reason   string // why it cannot be skipped
+}
+
+// Analysis is what the colluders can do.
+type Analysis struct {
+	Colluders  []string
+	Polynomial string         // how they obtained P, empty if they could not
+	Recovered  map[int]bls.Fr // secrets of other hops, by position
+	Forgeries  []Forgery
+	Segments   []Segment
+}
+
+// Analyze determines what the colluders of a view can forge. The forged proofs are chained for
+// packetDigest.
+func Analyze(view *View, packetDigest []byte) (*Analysis, error) {
+	if len(view.Colluders) == 0 {
+		return nil, fmt.Errorf("no colluders")
+	}
+	route := view.Route
+	a := &Analysis{Colluders: view.Colluders, Recovered: make(map[int]bls.Fr)}
+	colluding := make(map[string]bool)
+	for _, name := range view.Colluders {
+		colluding[name] = true
+	}
+
+	// the points the colluders know, and the openings they have seen
+	known := make(map[int]bls.Fr)
+	for position, secret := range view.Secrets {
+		var x bls.Fr
+		bls.AsFr(&x, secret)
+		known[position] = x
+	}
+	observed := make(map[int]*types.Proof)
+	for _, proof := range view.Observed {
+		var x bls.Fr
+		if proof.Proof == nil || types.FrFromString(&x, proof.X) != nil {
+			continue
+		}
+		for i := range route.Ys {
+			if route.Settings.CheckProofSingle(route.Commitment, proof.Proof, &x, &route.Ys[i]) {
+				observed[i+1] = proof
+				if _, ok := known[i+1]; !ok {
+					known[i+1] = x
+				}
+				break
+			}
+		}
+	}
+
+	polynomial := view.Polynomial
+	if polynomial != nil {
+		a.Polynomial = "given by the controller"
+	} else if len(known) > 1 {
+		// P is the interpolation of the known points if there are more of them than its degree
+		positions := sortedKeys(known)
+		xs := make([]bls.Fr, len(positions))
+		ys := make([]bls.Fr, len(positions))
+		for i, position := range positions {
+			xs[i] = known[position]
+			ys[i] = route.Ys[position-1]
+		}
+		candidate := Interpolate(xs, ys)
+		if bls.EqualG1(route.Settings.CommitToPoly(candidate), route.Commitment) {
+			polynomial = candidate
+			a.Polynomial = fmt.Sprintf("interpolated from %v known points", len(positions))
+		}
+	}
+
+	for i, name := range route.Nodes {
+		position := i + 1
+		forgery := Forgery{Position: position, Node: name}
+		x, isKnown := known[position]
+		switch {
+		case colluding[name]:
+			forgery.Method = Own
+			if _, ok := view.Secrets[position]; !ok {
+				return nil, fmt.Errorf("no secret for %v at position %v", name, position)
+			}
+		case polynomial != nil:
+			if !isKnown {
+				shifted := append([]bls.Fr(nil), polynomial...)
+				bls.SubModFr(&shifted[0], &shifted[0], &route.Ys[i])
+				roots := Roots(shifted)
+				if len(roots) == 0 {
+					break
+				}
+				x = roots[0]
+				// the real secret is a uint32, any other root opens as well
+				for _, root := range roots {
+					if fitsUint32(&root) {
+						x = root
+					}
+				}
+			}
+			a.Recovered[position] = x
+			forgery.Method = Root
+		case observed[position] != nil:
+			forgery.Method = Rebound
+		}
+		a.Forgeries = append(a.Forgeries, forgery)
+	}
+
+	// build the forged chain along the whole route, so that every forgery is bound to its
+	// predecessor and the packet; links are signed with the hop key of the last colluder so far
+	signer := view.Colluders[0]
+	var prev []byte
+	for i := range a.Forgeries {
+		f := &a.Forgeries[i]
+		if f.Method == Own {
+			signer = f.Node
+		}
+		var proof *types.Proof
+		switch {
+		case f.Method == Rebound:
+			proof = &types.Proof{}
+			*proof = *observed[f.Position]
+		case f.Method == Own && polynomial == nil && observed[f.Position] != nil:
+			proof = &types.Proof{}
+			*proof = *observed[f.Position]
+		case f.Method == Root || (f.Method == Own && polynomial != nil):
+			x, ok := a.Recovered[f.Position]
+			if !ok {
+				bls.AsFr(&x, view.Secrets[f.Position])
+			}
+			proof = &types.Proof{
+				FlowID: "collusion",
+				Node:   f.Node,
+				X:      x.String(),
+				Y:      route.Ys[i].String(),
+				Proof:  openAt(route, polynomial, &x),
+			}
+		default:
+			prev = nil
+			continue
+		}
+		key, ok := view.HopKeys[signer]
+		if !ok {
+			return nil, fmt.Errorf("no hop key for %v", signer)
+		}
+		proof.Bind(key, prev, packetDigest)
+		prev = proof.Chain
+		f.Proof = proof
+		var x bls.Fr
+		f.Valid = types.FrFromString(&x, proof.X) == nil &&
+			route.Settings.CheckProofSingle(route.Commitment, proof.Proof, &x, &route.Ys[i])
+	}
+
+	// segments between consecutive colluder positions
+	var positions []int
+	for i, name := range route.Nodes {
+		if colluding[name] {
+			positions = append(positions, i+1)
+		}
+	}
+	for k := 1; k < len(positions); k++ {
+		from, to := positions[k-1], positions[k]
+		if to == from+1 {
+			continue
+		}
+		segment := Segment{From: from, To: to, Skipped: route.Nodes[from : to-1]}
+		segment.Verified = true
+		for p := from + 1; p < to; p++ {
+			f := a.Forgeries[p-1]
+			if !f.Valid {
+				segment.Verified = false
+				segment.Reason = fmt.Sprintf("cannot forge %v at position %v", f.Node, p)
+				break
+			}
+			// the next hop checks the link and the opening as it would on the data plane
+			if finding := diagnose.DiagnoseHop(route, p, f.Proof, packetDigest); finding.Kind != diagnose.OK {
+				segment.Verified = false
+				segment.Reason = finding.String()
+				break
+			}
+		}
+		a.Segments = append(a.Segments, segment)
+	}
+	return a, nil
+}
+
+// openAt computes the opening at a field element, which ComputeProofSingle only takes as a
+// uint64: the commitment to the quotient (P(X) - P(x)) / (X - x).
+func openAt(route *diagnose.Route, polynomial []bls.Fr, x *bls.Fr) *bls.G1Point {
+	var y bls.Fr
+	bls.EvalPolyAt(&y, polynomial, x)
+	numerator := polySub(polynomial, []bls.Fr{y})
+	var negated bls.Fr
+	bls.SubModFr(&negated, &bls.ZERO, x)
+	quotient, _ := polyDivMod(numerator, []bls.Fr{negated, bls.ONE})
+	return route.Settings.CommitToPoly(quotient)
+}
+
+func fitsUint32(x *bls.Fr) bool {
+	v := bls.FrTo32(x) // little endian
+	for _, b := range v[4:] {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[int]bls.Fr) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+func (a *Analysis) String() string {
+	lines := []string{fmt.Sprintf("colluders: %v", strings.Join(a.Colluders, ", "))}
+	if a.Polynomial != "" {
+		lines = append(lines, "polynomial: "+a.Polynomial)
+	} else {
+		lines = append(lines, "polynomial: unknown to the colluders")
+	}
+	for _, f := range a.Forgeries {
+		line := fmt.Sprintf("  position %v (%v): %v", f.Position, f.Node, f.Method)
+		if x, ok := a.Recovered[f.Position]; ok && f.Method == Root {
+			line += fmt.Sprintf(", secret %v", x.String())
+		}
+		if f.Proof != nil {
+			line += fmt.Sprintf(", CheckProofSingle: %v", f.Valid)
+		}
+		lines = append(lines, line)
+	}
+	for _, s := range a.Segments {
+		if s.Verified {
+			lines = append(lines, fmt.Sprintf("  can skip %v between positions %v and %v", strings.Join(s.Skipped, ", "), s.From, s.To))
+		} else {
+			lines = append(lines, fmt.Sprintf("  cannot skip %v between positions %v and %v: %v", strings.Join(s.Skipped, ", "), s.From, s.To, s.Reason))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
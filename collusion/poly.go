@@ -0,0 +1,178 @@
+package collusion
+
+import (
+	"math/big"
+
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// Polynomials are coefficient slices over bls.Fr, lowest degree first, as in types.Controller.
+
+var modulus, _ = new(big.Int).SetString(bls.ModulusStr, 10)
+
+func trim(p []bls.Fr) []bls.Fr {
+	n := len(p)
+	for n > 0 && bls.EqualZero(&p[n-1]) {
+		n--
+	}
+	return p[:n]
+}
+
+// degree is -1 for the zero polynomial.
+func degree(p []bls.Fr) int {
+	return len(trim(p)) - 1
+}
+
+func polySub(a, b []bls.Fr) []bls.Fr {
+	out := make([]bls.Fr, max(len(a), len(b)))
+	for i := range out {
+		var x, y bls.Fr
+		if i < len(a) {
+			bls.CopyFr(&x, &a[i])
+		}
+		if i < len(b) {
+			bls.CopyFr(&y, &b[i])
+		}
+		bls.SubModFr(&out[i], &x, &y)
+	}
+	return trim(out)
+}
+
+func polyMul(a, b []bls.Fr) []bls.Fr {
+	if len(a) == 0 || len(b) == 0 {
+		return nil
+	}
+	out := make([]bls.Fr, len(a)+len(b)-1)
+	for i := range a {
+		for j := range b {
+			var t bls.Fr
+			bls.MulModFr(&t, &a[i], &b[j])
+			bls.AddModFr(&out[i+j], &out[i+j], &t)
+		}
+	}
+	return trim(out)
+}
+
+// polyDivMod divides a by a non-zero b.
+func polyDivMod(a, b []bls.Fr) (q, r []bls.Fr) {
+	b = trim(b)
+	r = append([]bls.Fr(nil), trim(a)...)
+	if len(r) < len(b) {
+		return nil, r
+	}
+	var lead bls.Fr
+	bls.InvModFr(&lead, &b[len(b)-1])
+	q = make([]bls.Fr, len(r)-len(b)+1)
+	for i := len(q) - 1; i >= 0; i-- {
+		bls.MulModFr(&q[i], &r[i+len(b)-1], &lead)
+		for j := range b {
+			var t bls.Fr
+			bls.MulModFr(&t, &q[i], &b[j])
+			bls.SubModFr(&r[i+j], &r[i+j], &t)
+		}
+	}
+	return trim(q), trim(r)
+}
+
+func polyMod(a, m []bls.Fr) []bls.Fr {
+	_, r := polyDivMod(a, m)
+	return r
+}
+
+// monic scales p so that its leading coefficient is one.
+func monic(p []bls.Fr) []bls.Fr {
+	p = trim(p)
+	if len(p) == 0 {
+		return p
+	}
+	var inv bls.Fr
+	bls.InvModFr(&inv, &p[len(p)-1])
+	out := make([]bls.Fr, len(p))
+	for i := range p {
+		bls.MulModFr(&out[i], &p[i], &inv)
+	}
+	return out
+}
+
+func polyGcd(a, b []bls.Fr) []bls.Fr {
+	a, b = trim(a), trim(b)
+	for len(b) > 0 {
+		a, b = b, polyMod(a, b)
+	}
+	return monic(a)
+}
+
+// polyPowMod computes base^e mod m by square and multiply.
+func polyPowMod(base []bls.Fr, e *big.Int, m []bls.Fr) []bls.Fr {
+	result := []bls.Fr{bls.ONE}
+	base = polyMod(base, m)
+	for i := e.BitLen() - 1; i >= 0; i-- {
+		result = polyMod(polyMul(result, result), m)
+		if e.Bit(i) == 1 {
+			result = polyMod(polyMul(result, base), m)
+		}
+	}
+	return result
+}
+
+// Roots returns the distinct roots of p in the scalar field, by Cantor-Zassenhaus: the product of
+// the linear factors of p is gcd(p, X^r - X), and random gcds with (X + a)^((r-1)/2) - 1 split it.
+func Roots(p []bls.Fr) []bls.Fr {
+	p = monic(p)
+	if len(p) < 2 {
+		return nil
+	}
+	x := []bls.Fr{bls.ZERO, bls.ONE}
+	linear := polyGcd(p, polySub(polyPowMod(x, modulus, p), x))
+	return splitRoots(linear)
+}
+
+// splitRoots finds the roots of a monic product of distinct linear factors.
+func splitRoots(g []bls.Fr) []bls.Fr {
+	switch degree(g) {
+	case -1, 0:
+		return nil
+	case 1:
+		var root bls.Fr
+		bls.SubModFr(&root, &bls.ZERO, &g[0])
+		return []bls.Fr{root}
+	}
+	half := new(big.Int).Rsh(new(big.Int).Sub(modulus, big.NewInt(1)), 1)
+	for {
+		shifted := []bls.Fr{*bls.RandomFr(), bls.ONE}
+		d := polyGcd(g, polySub(polyPowMod(shifted, half, g), []bls.Fr{bls.ONE}))
+		if n := degree(d); n > 0 && n < degree(g) {
+			q, _ := polyDivMod(g, d)
+			return append(splitRoots(d), splitRoots(q)...)
+		}
+	}
+}
+
+// Interpolate returns the polynomial of degree below len(xs) through the points (xs[i], ys[i]).
+// The xs must be distinct.
+func Interpolate(xs, ys []bls.Fr) []bls.Fr {
+	out := make([]bls.Fr, len(xs))
+	for i := range xs {
+		basis := []bls.Fr{bls.ONE}
+		var denominator bls.Fr
+		bls.CopyFr(&denominator, &bls.ONE)
+		for j := range xs {
+			if j == i {
+				continue
+			}
+			var negated, diff bls.Fr
+			bls.SubModFr(&negated, &bls.ZERO, &xs[j])
+			basis = polyMul(basis, []bls.Fr{negated, bls.ONE})
+			bls.SubModFr(&diff, &xs[i], &xs[j])
+			bls.MulModFr(&denominator, &denominator, &diff)
+		}
+		var scale bls.Fr
+		bls.DivModFr(&scale, &ys[i], &denominator)
+		for k := range basis {
+			var t bls.Fr
+			bls.MulModFr(&t, &basis[k], &scale)
+			bls.AddModFr(&out[k], &out[k], &t)
+		}
+	}
+	return out
+}
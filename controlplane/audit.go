@@ -0,0 +1,222 @@
+package controlplane
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// AuditEntry is one controller action. Entries are chained: Hash covers the entry with its Prev,
+// the Hash of the entry before it, and the controller signs Hash, so an entry cannot be modified,
+// removed or reordered without breaking the chain. Node secrets are never logged.
+type AuditEntry struct {
+	Seq        uint64
+	Time       time.Time
+	Action     string
+	Node       string   `json:",omitempty"`
+	Flow       string   `json:",omitempty"`
+	Route      []string `json:",omitempty"`
+	Epoch      uint64
+	Version    uint64
+	Commitment *bls.G1Point `json:",omitempty"`
+	Detail     string       `json:",omitempty"`
+	Prev       string       // hex hash of the previous entry, empty for the first one
+	Hash       string       // hex SHA-256 of the entry with Hash and Signature cleared
+	Signature  []byte
+}
+
+// Audit actions.
+const (
+	AuditStart    = "start"    // the controller opened the log; Detail holds its public key
+	AuditRegister = "register" // a node registered
+	AuditSecret   = "secret"   // a node secret was generated for an epoch
+	AuditSetup    = "setup"    // the KZG setup was (re)generated; Detail holds its size and hash
+	AuditCommit   = "commit"   // a flow was committed in an epoch
+	AuditRemove   = "remove"   // a flow was removed
+	AuditRotate   = "rotate"   // an epoch was published
+	AuditExpire   = "expire"   // an epoch expired
+	AuditRevoke   = "revoke"   // a node was revoked
+	AuditPolicy   = "policy"   // the failure policy of a flow was set; Detail holds the policy
+	AuditAbort    = "abort"    // the actions logged since the last persisted change were rolled back
+)
+
+// AuditHead identifies the newest entry of a log. Comparing it with a head recorded earlier, or
+// published elsewhere, detects a log that was truncated at the end.
+type AuditHead struct {
+	Seq  uint64
+	Hash string
+}
+
+func (h AuditHead) String() string {
+	return fmt.Sprintf("%v:%v", h.Seq, h.Hash)
+}
+
+// ParseAuditHead reverses AuditHead.String.
+func ParseAuditHead(s string) (AuditHead, error) {
+	var head AuditHead
+	if _, err := fmt.Sscanf(s, "%d:%s", &head.Seq, &head.Hash); err != nil {
+		return AuditHead{}, fmt.Errorf("malformed audit head %q, expected <seq>:<hash>", s)
+	}
+	return head, nil
+}
+
+func (e *AuditEntry) digest() ([32]byte, error) {
+	unsigned := *e
+	unsigned.Hash = ""
+	unsigned.Signature = nil
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// AuditLog appends entries to a JSON-lines file. Every entry is synced to disk before the
+// action it records is persisted.
+type AuditLog struct {
+	Path string
+
+	mu   sync.Mutex
+	key  ed25519.PrivateKey
+	file *os.File
+	head AuditHead
+	n    uint64 // number of entries
+}
+
+// OpenAuditLog verifies the existing log at path, if any, and opens it for appending.
+func OpenAuditLog(path string, key ed25519.PrivateKey) (*AuditLog, error) {
+	head, n, err := VerifyAuditLog(path, key.Public().(ed25519.PublicKey))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &AuditLog{Path: path, key: key, file: file, head: head, n: n}
+	if err := l.Append(AuditEntry{Action: AuditStart, Detail: hex.EncodeToString(key.Public().(ed25519.PublicKey))}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Append chains, signs and writes entries.
+func (l *AuditLog) Append(entries ...AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var buf bytes.Buffer
+	head, n := l.head, l.n
+	for _, entry := range entries {
+		entry.Seq = n
+		entry.Time = time.Now().UTC()
+		entry.Prev = head.Hash
+		digest, err := entry.digest()
+		if err != nil {
+			return err
+		}
+		entry.Hash = hex.EncodeToString(digest[:])
+		entry.Signature = ed25519.Sign(l.key, digest[:])
+		line, err := json.Marshal(&entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		head, n = AuditHead{Seq: entry.Seq, Hash: entry.Hash}, n+1
+	}
+	if _, err := l.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("audit log: %w", err)
+	}
+	l.head, l.n = head, n
+	return nil
+}
+
+// SetAuditLog records every later change of the service in l.
+func (s *Service) SetAuditLog(l *AuditLog) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = l
+}
+
+// AuditHead returns the head of the audit log, if any.
+func (s *Service) AuditHead() (AuditHead, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.audit == nil {
+		return AuditHead{}, false
+	}
+	return s.audit.Head(), true
+}
+
+func (l *AuditLog) Head() AuditHead {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.head
+}
+
+func (l *AuditLog) Close() error {
+	return l.file.Close()
+}
+
+// ReadAuditLog decodes the entries of the log at path without checking them.
+func ReadAuditLog(path string) ([]AuditEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return entries, fmt.Errorf("audit entry %v: malformed: %w", len(entries), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// VerifyAuditLog checks every entry of the log at path against the chain and the controller's
+// key, and returns the head and the number of valid entries. The first broken entry is reported.
+func VerifyAuditLog(path string, controllerKey ed25519.PublicKey) (AuditHead, uint64, error) {
+	entries, err := ReadAuditLog(path)
+	var head AuditHead
+	for n, entry := range entries {
+		if entry.Seq != uint64(n) {
+			return head, uint64(n), fmt.Errorf("audit entry %v: has sequence number %v, entries were removed or reordered", n, entry.Seq)
+		}
+		if entry.Prev != head.Hash {
+			return head, uint64(n), fmt.Errorf("audit entry %v: does not chain to the previous entry", n)
+		}
+		digest, err := entry.digest()
+		if err != nil {
+			return head, uint64(n), err
+		}
+		if entry.Hash != hex.EncodeToString(digest[:]) {
+			return head, uint64(n), fmt.Errorf("audit entry %v: was modified", n)
+		}
+		if !ed25519.Verify(controllerKey, digest[:], entry.Signature) {
+			return head, uint64(n), fmt.Errorf("audit entry %v: is not signed by the controller", n)
+		}
+		head = AuditHead{Seq: entry.Seq, Hash: entry.Hash}
+	}
+	return head, uint64(len(entries)), err
+}
@@ -0,0 +1,139 @@
+package controlplane
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// editEntry rewrites entry i of a log given as lines.
+func editEntry(t *testing.T, lines []string, i int, edit func(*AuditEntry)) []string {
+	t.Helper()
+	var entry AuditEntry
+	if err := json.Unmarshal([]byte(lines[i]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	edit(&entry)
+	line, err := json.Marshal(&entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := append([]string(nil), lines...)
+	out[i] = string(line)
+	return out
+}
+
+func TestAuditLogDetectsTampering(t *testing.T) {
+	public, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublic, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	l, err := OpenAuditLog(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(
+		AuditEntry{Action: AuditRegister, Node: "A"},
+		AuditEntry{Action: AuditRegister, Node: "B"},
+		AuditEntry{Action: AuditCommit, Flow: "f", Route: []string{"A", "B"}},
+		AuditEntry{Action: AuditRevoke, Node: "B", Detail: "secret leaked"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	head := l.Head()
+	l.Close()
+
+	got, n, err := VerifyAuditLog(path, public)
+	if err != nil || n != 5 || got != head {
+		t.Fatalf("intact log: head %v, %v entries, %v; want %v and 5 entries", got, n, err, head)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	tests := []struct {
+		name  string
+		lines []string
+		key   ed25519.PublicKey
+		want  string // in the error; empty if the log verifies
+		valid uint64 // entries before the first broken one
+	}{
+		{"entry removed", append(append([]string(nil), lines[:2]...), lines[3:]...), public, "audit entry 2: has sequence number 3", 2},
+		{"entries swapped", []string{lines[0], lines[2], lines[1], lines[3], lines[4]}, public, "audit entry 1: has sequence number 2", 1},
+		{"entry edited", editEntry(t, lines, 3, func(e *AuditEntry) { e.Route = []string{"A", "C"} }), public, "audit entry 3: was modified", 3},
+		{"entry edited and rehashed", editEntry(t, lines, 4, func(e *AuditEntry) {
+			e.Detail = "routine"
+			digest, _ := e.digest()
+			e.Hash = hex.EncodeToString(digest[:])
+		}), public, "audit entry 4: is not signed by the controller", 4},
+		{"chain cut", editEntry(t, lines, 2, func(e *AuditEntry) { e.Prev = "" }), public, "audit entry 2: does not chain", 2},
+		{"partial last line", append(append([]string(nil), lines[:4]...), lines[4][:len(lines[4])/2]), public, "audit entry 4: malformed", 4},
+		{"another controller", lines, otherPublic, "audit entry 0: is not signed by the controller", 0},
+		// a log cut at the end still verifies; only the head tells
+		{"truncated at the end", lines[:3], public, "", 3},
+	}
+	for _, test := range tests {
+		tampered := filepath.Join(dir, "tampered.log")
+		if err := os.WriteFile(tampered, []byte(strings.Join(test.lines, "\n")+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, n, err := VerifyAuditLog(tampered, test.key)
+		if test.want == "" {
+			if err != nil {
+				t.Errorf("%v: %v", test.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: got %v, want %q", test.name, err, test.want)
+		}
+		if n != test.valid {
+			t.Errorf("%v: %v valid entries, want %v", test.name, n, test.valid)
+		}
+		if got == head {
+			t.Errorf("%v: head %v is unchanged", test.name, got)
+		}
+		if test.want != "" && test.key.Equal(public) {
+			if _, err := OpenAuditLog(tampered, key); err == nil {
+				t.Errorf("%v: opened for appending", test.name)
+			}
+		}
+	}
+
+	// reopening the intact log continues the chain
+	l, err = OpenAuditLog(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(AuditEntry{Action: AuditRegister, Node: "C"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	if _, n, err := VerifyAuditLog(path, public); err != nil || n != 7 {
+		t.Errorf("reopened log: %v entries, %v; want 7", n, err)
+	}
+}
+
+func TestParseAuditHead(t *testing.T) {
+	head := AuditHead{Seq: 12, Hash: strings.Repeat("ab", 32)}
+	got, err := ParseAuditHead(head.String())
+	if err != nil || got != head {
+		t.Errorf("round trip: got %v, %v", got, err)
+	}
+	for _, s := range []string{"", "12", ":abcd", "x:abcd"} {
+		if _, err := ParseAuditHead(s); err == nil {
+			t.Errorf("%q parsed", s)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package controlplane
+
+import (
+	"crypto/ed25519"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"example.com/kzg-demo/utils"
+)
+
+// ErrUnauthorized is returned when a request on behalf of a node does not carry its credential.
+var ErrUnauthorized = errors.New("missing or wrong node credential")
+
+// ErrNotOperator is returned when an admin request does not carry the operator credential.
+var ErrNotOperator = errors.New("missing or wrong operator credential")
+
+// NodeCredential is the hash of the credential issued to a node at registration; the controller
+// never stores the credential itself.
+type NodeCredential struct {
+	Name string
+	Hash string // hex SHA-256 of the credential
+}
+
+// NodeHopKey is the public key a node signs its chain links with, see types.Proof.Bind.
+type NodeHopKey struct {
+	Name string
+	Key  string // hex Ed25519 public key
+}
+
+// SetHopKey records the hop key of a registered node. Nodes send it on every registration, which
+// authenticates them once they hold a credential, so a node that lost its key registers a new one.
+func (s *Service) SetHopKey(name string, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("node %v: malformed hop key", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.nodes[name] {
+		return fmt.Errorf("node %v is not registered", name)
+	}
+	old, ok := s.hopKeys[name]
+	if ok && old.Equal(key) {
+		return nil
+	}
+	s.hopKeys[name] = key
+	if err := s.persistLocked(AuditEntry{Action: AuditRegister, Node: name, Detail: "hop key " + hex.EncodeToString(key)}); err != nil {
+		if ok {
+			s.hopKeys[name] = old
+		} else {
+			delete(s.hopKeys, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// newCredential draws a credential and returns it with its hash.
+func newCredential() (string, [32]byte, error) {
+	raw := make([]byte, 32)
+	if _, err := crand.Read(raw); err != nil {
+		return "", [32]byte{}, err
+	}
+	credential := hex.EncodeToString(raw)
+	return credential, sha256.Sum256([]byte(credential)), nil
+}
+
+// Authenticate checks the credential presented on behalf of a node.
+func (s *Service) Authenticate(name string, credential string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.authenticateLocked(name, credential)
+}
+
+func (s *Service) authenticateLocked(name string, credential string) error {
+	hash, ok := s.credentials[name]
+	if !ok || credential == "" {
+		return fmt.Errorf("node %v: %w", name, ErrUnauthorized)
+	}
+	presented := sha256.Sum256([]byte(credential))
+	if subtle.ConstantTimeCompare(presented[:], hash[:]) != 1 {
+		return fmt.Errorf("node %v: %w", name, ErrUnauthorized)
+	}
+	return nil
+}
+
+// SetOperatorCredential sets the credential operators present on admin requests: committing,
+// removing and revoking, epochs, policies and resetting reputations. Until it is set, admin
+// requests are refused.
+func (s *Service) SetOperatorCredential(credential string) error {
+	if credential == "" {
+		return errors.New("empty operator credential")
+	}
+	hash := sha256.Sum256([]byte(credential))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operator = &hash
+	return nil
+}
+
+// AuthenticateOperator checks the credential presented on an admin request.
+func (s *Service) AuthenticateOperator(credential string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.operator == nil || credential == "" {
+		return ErrNotOperator
+	}
+	presented := sha256.Sum256([]byte(credential))
+	if subtle.ConstantTimeCompare(presented[:], s.operator[:]) != 1 {
+		return ErrNotOperator
+	}
+	return nil
+}
+
+// LoadOperatorCredential reads the operator credential from path, or draws one and saves it
+// there, readable by the owner only.
+func LoadOperatorCredential(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		credential := strings.TrimSpace(string(data))
+		if credential == "" {
+			return "", fmt.Errorf("%v: empty operator credential", path)
+		}
+		return credential, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	credential, _, err := newCredential()
+	if err != nil {
+		return "", err
+	}
+	if err := utils.WriteFileAtomic(path, []byte(credential+"\n")); err != nil {
+		return "", err
+	}
+	return credential, nil
+}
+
+// credentialOf returns the credential a request carries as "Authorization: Bearer <credential>".
+func credentialOf(r *http.Request) string {
+	credential, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(credential)
+}
@@ -0,0 +1,219 @@
+package controlplane
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegisterIssuesCredential(t *testing.T) {
+	s := NewService()
+	credential, err := s.Register("A", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential == "" {
+		t.Fatal("first registration issued no credential")
+	}
+	if err := s.Authenticate("A", credential); err != nil {
+		t.Fatalf("issued credential refused: %v", err)
+	}
+
+	for _, presented := range []string{"", "00", credential + "0"} {
+		if _, err := s.Register("A", presented); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("registering A again with %q: got %v, want ErrUnauthorized", presented, err)
+		}
+		if err := s.Authenticate("A", presented); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("authenticating A with %q: got %v, want ErrUnauthorized", presented, err)
+		}
+	}
+	if again, err := s.Register("A", credential); err != nil || again != "" {
+		t.Errorf("registering A again with its credential: got %q, %v", again, err)
+	}
+	if err := s.Authenticate("B", credential); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("A's credential authenticated unregistered node B: %v", err)
+	}
+}
+
+func TestCredentialsSurviveRestore(t *testing.T) {
+	s := NewService()
+	credential, err := s.Register("A", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewService()
+	if err := restored.Restore(s.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Authenticate("A", credential); err != nil {
+		t.Fatalf("credential refused after restore: %v", err)
+	}
+	if _, err := restored.Register("A", ""); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("restored service let A register without its credential: %v", err)
+	}
+}
+
+func TestAdminEndpointsNeedOperator(t *testing.T) {
+	s := NewService()
+	for _, name := range []string{"A", "B", "C", "D"} {
+		if _, err := s.Register(name, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.SetFlow("f", []string{"A", "B", "C"}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "operator.credential")
+	credential, err := LoadOperatorCredential(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler()
+	send := func(method string, target string, body string, credential string) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if credential != "" {
+			req.Header.Set("Authorization", "Bearer "+credential)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	requests := []struct {
+		method, target, body string
+		status               int // with the operator credential
+	}{
+		{http.MethodPost, "/revocations", `{"Node":"B","Reason":"leaked"}`, http.StatusOK},
+		{http.MethodPost, "/flows", `{"FlowID":"g","Route":"ACD"}`, http.StatusOK},
+		{http.MethodPost, "/policies", `{"FlowID":"g","Policy":"drop"}`, http.StatusOK},
+		{http.MethodPost, "/epochs", `{"ActivatesIn":"1m"}`, http.StatusOK},
+		{http.MethodDelete, "/flows?id=g", "", http.StatusNoContent},
+	}
+	// before an operator credential is set, nobody is an operator
+	if got := send(http.MethodPost, "/revocations", requests[0].body, credential); got != http.StatusUnauthorized {
+		t.Errorf("revocation without a configured operator: got %v", got)
+	}
+	if err := s.SetOperatorCredential(credential); err != nil {
+		t.Fatal(err)
+	}
+	nodeCredential, err := s.Register("E", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range requests {
+		for _, presented := range []string{"", "00", nodeCredential} {
+			if got := send(req.method, req.target, req.body, presented); got != http.StatusUnauthorized {
+				t.Errorf("%v %v with credential %q: got %v, want %v", req.method, req.target, presented, got, http.StatusUnauthorized)
+			}
+		}
+	}
+	if len(s.Revocations()) != 0 {
+		t.Fatal("an unauthenticated request revoked a node")
+	}
+	for _, req := range requests {
+		if got := send(req.method, req.target, req.body, credential); got != req.status {
+			t.Errorf("%v %v as the operator: got %v, want %v", req.method, req.target, got, req.status)
+		}
+	}
+
+	// the credential is kept in its file
+	if again, err := LoadOperatorCredential(path); err != nil || again != credential {
+		t.Errorf("reloaded credential %q, %v, want the saved one", again, err)
+	}
+}
+
+func TestHopKeysAreVouchedFor(t *testing.T) {
+	s := NewService()
+	handler := s.Handler()
+	register := func(node string, credential string, hopKey []byte) (int, RegisterResponse) {
+		body, err := json.Marshal(RegisterRequest{Node: node, HopKey: hopKey})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body))
+		if credential != "" {
+			req.Header.Set("Authorization", "Bearer "+credential)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var resp RegisterResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec.Code, resp
+	}
+	hopKey := func() ed25519.PublicKey {
+		public, _, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return public
+	}
+
+	keyA, keyB, stolen := hopKey(), hopKey(), hopKey()
+	status, a := register("A", "", keyA)
+	if status != http.StatusOK {
+		t.Fatalf("registering A: %v", status)
+	}
+	if status, _ := register("B", "", keyB); status != http.StatusOK {
+		t.Fatalf("registering B: %v", status)
+	}
+
+	tests := []struct {
+		name       string
+		credential string
+		hopKey     []byte
+		status     int
+	}{
+		{"replaced without the credential", "", stolen, http.StatusUnauthorized},
+		{"malformed key", a.Credential, keyA[:16], http.StatusBadRequest},
+		{"same key again", a.Credential, keyA, http.StatusOK},
+	}
+	for _, test := range tests {
+		if status, _ := register("A", test.credential, test.hopKey); status != test.status {
+			t.Errorf("%v: got %v, want %v", test.name, status, test.status)
+		}
+	}
+
+	check := func(s *Service, want map[string]ed25519.PublicKey) {
+		t.Helper()
+		params, err := s.NodeParams("B")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]ed25519.PublicKey)
+		for _, hopKey := range params.HopKeys {
+			if !hopKey.Verify(s.PublicKey()) {
+				t.Errorf("hop key of %v is not signed by the controller", hopKey.Node)
+			}
+			got[hopKey.Node] = hopKey.Key
+		}
+		if len(got) != len(want) {
+			t.Errorf("got hop keys of %v nodes, want %v", len(got), len(want))
+		}
+		for node, key := range want {
+			if !key.Equal(got[node]) {
+				t.Errorf("hop key of %v: got %x, want %x", node, got[node], key)
+			}
+		}
+	}
+	check(s, map[string]ed25519.PublicKey{"A": keyA, "B": keyB})
+
+	// a node that lost its key registers a new one with its credential
+	keyA = hopKey()
+	if status, _ := register("A", a.Credential, keyA); status != http.StatusOK {
+		t.Fatalf("replacing A's key with its credential: %v", status)
+	}
+	check(s, map[string]ed25519.PublicKey{"A": keyA, "B": keyB})
+
+	restored := NewService()
+	restored.SigningKey = s.SigningKey
+	if err := restored.Restore(s.Snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	check(restored, map[string]ed25519.PublicKey{"A": keyA, "B": keyB})
+}
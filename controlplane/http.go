@@ -0,0 +1,388 @@
+package controlplane
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/kzg-demo/policy"
+)
+
+type RegisterRequest struct {
+	Node   string
+	HopKey []byte `json:",omitempty"` // public key the node signs its chain links with
+}
+
+// RegisterResponse carries the node's credential on its first registration. The node presents it
+// as "Authorization: Bearer <credential>" on every later request.
+type RegisterResponse struct {
+	Node       string
+	Credential string `json:",omitempty"`
+}
+
+type FlowRequest struct {
+	FlowID string
+	Route  string // e.g., ABCD, one letter per node
+	Policy string `json:",omitempty"` // failure policy, e.g., quarantine+alert; kept if empty
+}
+
+type PolicyRequest struct {
+	FlowID string
+	Policy string // empty leaves the choice to each node
+}
+
+type FlowSummary struct {
+	FlowID     string
+	Route      []string
+	Version    uint64
+	Epoch      uint64
+	Commitment string
+}
+
+// ConsistencyResponse proves that the transparency log of First leaves is a prefix of the log
+// of Second leaves.
+type ConsistencyResponse struct {
+	First  uint64
+	Second uint64
+	Hashes [][]byte
+}
+
+type EpochSummary struct {
+	Epoch       uint64
+	ActivatesAt time.Time
+	NotAfter    time.Time
+	Flows       []FlowSummary
+}
+
+// Handler exposes the service to node agents and operators. Requests marked * need the operator
+// credential, see SetOperatorCredential.
+//
+//	POST   /register          register a node and its hop key; registered nodes must present their credential
+//	GET    /params?node=A     download the parameters of a node, with the node's credential
+//	GET    /flows             list committed flows
+//	POST   /flows             commit (or re-commit) a flow *
+//	DELETE /flows?id=f1       remove a flow *
+//	GET    /epochs            list live epochs and their commitments
+//	POST   /epochs            publish the next epoch, e.g., {"ActivatesIn":"30s"} *
+//	GET    /revocations       list revoked nodes
+//	POST   /revocations       revoke a node, e.g., {"Node":"B","Reason":"secret leaked"} *
+//	GET    /routes?node=A     list the routes through a node
+//	POST   /policies          set the failure policy of a flow, e.g., {"FlowID":"f1","Policy":"mark+alert"} *
+//	GET    /alerts?flow=f1    list the failed proofs verifiers reported
+//	POST   /alerts            report a failed proof, see policy.Alert, with the reporter's credential
+//	GET    /reputation        list the standing of reported nodes and what was done about them
+//	DELETE /reputation?node=B forget the failures reported against a node *
+//	GET    /audit             show the head of the audit log
+//	GET    /log/head          signed head of the transparency log of commitments
+//	GET    /log/consistency?first=3&second=7
+//	                          prove the log of 7 leaves extends the log of 3
+func (s *Service) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", s.handleRegister)
+	mux.HandleFunc("/params", s.handleParams)
+	mux.HandleFunc("/flows", s.handleFlows)
+	mux.HandleFunc("/epochs", s.handleEpochs)
+	mux.HandleFunc("/revocations", s.handleRevocations)
+	mux.HandleFunc("/routes", s.handleRoutes)
+	mux.HandleFunc("/policies", s.handlePolicies)
+	mux.HandleFunc("/alerts", s.handleAlerts)
+	mux.HandleFunc("/reputation", s.handleReputation)
+	mux.HandleFunc("/audit", s.handleAudit)
+	mux.HandleFunc("/log/head", s.handleTreeHead)
+	mux.HandleFunc("/log/consistency", s.handleConsistency)
+	return mux
+}
+
+// operatorOnly refuses an admin request without the operator credential, and reports whether
+// it may go ahead.
+func (s *Service) operatorOnly(w http.ResponseWriter, r *http.Request) bool {
+	if err := s.AuthenticateOperator(credentialOf(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (s *Service) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	credential, err := s.Register(req.Node, credentialOf(r))
+	if errors.Is(err, ErrUnauthorized) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err == nil && req.HopKey != nil {
+		err = s.SetHopKey(req.Node, req.HopKey)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, RegisterResponse{Node: req.Node, Credential: credential})
+}
+
+func (s *Service) handleParams(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	node := r.URL.Query().Get("node")
+	if err := s.Authenticate(node, credentialOf(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	params, err := s.NodeParams(node)
+	if errors.Is(err, ErrRevoked) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, params)
+}
+
+func (s *Service) handleFlows(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		summaries := make([]FlowSummary, 0)
+		for _, flow := range s.Flows() {
+			summaries = append(summaries, summarize(flow))
+		}
+		writeJSON(w, summaries)
+	case http.MethodPost:
+		if !s.operatorOnly(w, r) {
+			return
+		}
+		var req FlowRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Policy != "" {
+			if _, err := policy.Parse(req.Policy); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		flow, err := s.SetFlow(req.FlowID, strings.Split(strings.TrimSpace(req.Route), ""))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Policy != "" {
+			if err := s.SetPolicy(req.FlowID, req.Policy); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		writeJSON(w, summarize(flow))
+	case http.MethodDelete:
+		if !s.operatorOnly(w, r) {
+			return
+		}
+		if err := s.RemoveFlow(r.URL.Query().Get("id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Service) handleEpochs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.Epochs())
+	case http.MethodPost:
+		if !s.operatorOnly(w, r) {
+			return
+		}
+		var req struct {
+			ActivatesIn string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		in, err := time.ParseDuration(req.ActivatesIn)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		epoch, err := s.Rotate(time.Now().Add(in))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, EpochSummary{Epoch: epoch.ID, ActivatesAt: epoch.ActivatesAt})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Service) handleRevocations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.Revocations())
+	case http.MethodPost:
+		if !s.operatorOnly(w, r) {
+			return
+		}
+		var req struct {
+			Node   string
+			Reason string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := s.Revoke(req.Node, req.Reason)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, result)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Service) handleRoutes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.RoutesOf(r.URL.Query().Get("node")))
+}
+
+func (s *Service) handlePolicies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.operatorOnly(w, r) {
+		return
+	}
+	var req PolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.SetPolicy(req.FlowID, req.Policy); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, req)
+}
+
+func (s *Service) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.Alerts(r.URL.Query().Get("flow")))
+	case http.MethodPost:
+		var alert policy.Alert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.Authenticate(alert.Node, credentialOf(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		resp, err := s.ReportAlert(alert)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, resp)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Service) handleReputation(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.Reputations())
+	case http.MethodDelete:
+		if !s.operatorOnly(w, r) {
+			return
+		}
+		if err := s.ResetReputation(r.URL.Query().Get("node")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Service) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	head, ok := s.AuditHead()
+	if !ok {
+		http.Error(w, "audit log disabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, head)
+}
+
+func (s *Service) handleTreeHead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.TreeHead())
+}
+
+func (s *Service) handleConsistency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	first, err1 := strconv.ParseUint(r.URL.Query().Get("first"), 10, 64)
+	second, err2 := strconv.ParseUint(r.URL.Query().Get("second"), 10, 64)
+	if err1 != nil || err2 != nil {
+		http.Error(w, "first and second must be tree sizes", http.StatusBadRequest)
+		return
+	}
+	hashes, err := s.Consistency(first, second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, ConsistencyResponse{First: first, Second: second, Hashes: hashes})
+}
+
+func summarize(flow *FlowRecord) FlowSummary {
+	commitment, _ := flow.Commitment.MarshalText()
+	return FlowSummary{
+		FlowID:     flow.ID,
+		Route:      flow.Route,
+		Version:    flow.Version,
+		Epoch:      flow.Epoch,
+		Commitment: string(commitment),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
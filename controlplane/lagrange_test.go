@@ -0,0 +1,87 @@
+package controlplane
+
+import (
+	"slices"
+	"testing"
+
+	"example.com/kzg-demo/types"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// checkFlowAgainstSetup compares a flow committed by the service with a fresh Controller.Setup of
+// the same route and slots.
+func checkFlowAgainstSetup(t *testing.T, s *Service, flow *FlowRecord) {
+	t.Helper()
+	epoch := s.epochs[len(s.epochs)-1]
+	data := make([]uint32, len(flow.Route))
+	for i, visit := range types.Visits(flow.Route) {
+		data[i] = uint32(types.VisitSecret(epoch.Secrets[flow.Route[i]], visit))
+	}
+	fresh := types.Controller{Lagrange: s.Lagrange, Slots: flow.Slots}
+	if _, _, err := fresh.Setup(data); err != nil {
+		t.Fatal(err)
+	}
+	if !bls.EqualG1(flow.Commitment, fresh.Commit()) {
+		t.Fatalf("route %v: commitment differs from a fresh Setup", flow.Route)
+	}
+	for i, opening := range fresh.Route.Openings() {
+		if !bls.EqualG1(flow.Openings[i], opening.Proof) {
+			t.Errorf("route %v: opening of hop %v differs from a fresh Setup", flow.Route, i)
+		}
+	}
+}
+
+func TestSetFlowUpdatesLagrangeRoutes(t *testing.T) {
+	s := NewService()
+	settings, err := types.NewLagrangeSettings(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Lagrange = settings
+	for _, name := range []string{"A", "B", "C", "D", "E"} {
+		if _, err := s.Register(name, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	flow, err := s.SetFlow("f", []string{"A", "B", "C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFlowAgainstSetup(t, s, flow)
+	slots := flow.Slots
+
+	// inserting D keeps the slots of the other hops
+	flow, err = s.SetFlow("f", []string{"A", "B", "D", "C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFlowAgainstSetup(t, s, flow)
+	if flow.Slots[0] != slots[0] || flow.Slots[1] != slots[1] || flow.Slots[3] != slots[2] {
+		t.Errorf("insert moved hops: slots %v, were %v", flow.Slots, slots)
+	}
+
+	params, err := s.NodeParams("D")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := params.Epochs[len(params.Epochs)-1].Flows[0]
+	if d.Width != settings.Width || d.Slot != flow.Slots[2] || d.PreviousSlot != flow.Slots[1] || len(d.Polynomial) != 0 {
+		t.Errorf("D got width %v, slot %v after %v and %v coefficients", d.Width, d.Slot, d.PreviousSlot, len(d.Polynomial))
+	}
+	if !settings.Verify(d.Commitment, d.Slot, params.Epochs[len(params.Epochs)-1].Secret, d.Opening) {
+		t.Error("D's opening does not verify")
+	}
+
+	// replacing a hop, then changing two, which needs a fresh setup
+	for _, route := range [][]string{{"A", "E", "D", "C"}, {"E", "A", "C"}} {
+		flow, err = s.SetFlow("f", route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFlowAgainstSetup(t, s, flow)
+	}
+	if !slices.Equal(flow.Slots, settings.SpreadSlots(3)) {
+		t.Errorf("a route changed by two hops kept slots %v", flow.Slots)
+	}
+}
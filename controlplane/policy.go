@@ -0,0 +1,120 @@
+package controlplane
+
+import (
+	"fmt"
+	"time"
+
+	"example.com/kzg-demo/policy"
+	"example.com/kzg-demo/reputation"
+)
+
+// MaxAlerts is the number of alerts the controller keeps; older ones are dropped.
+const MaxAlerts = 1000
+
+// SetPolicy sets what the verifiers of a flow do with packets whose proof failed. Nodes pick it
+// up with their next parameter sync, and an empty policy leaves the choice to each node.
+func (s *Service) SetPolicy(id string, p string) error {
+	if p != "" {
+		parsed, err := policy.Parse(p)
+		if err != nil {
+			return err
+		}
+		p = parsed.String()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.routes[id]
+	if !ok {
+		return fmt.Errorf("flow %v not found", id)
+	}
+	old := record.Policy
+	record.Policy = p
+	if err := s.persistLocked(AuditEntry{Action: AuditPolicy, Flow: id, Version: record.Version, Detail: p}); err != nil {
+		record.Policy = old
+		return err
+	}
+	return nil
+}
+
+// AlertResponse tells a verifier what became of its alert.
+type AlertResponse struct {
+	Suspect     string       `json:",omitempty"` // the upstream hop the failure was attributed to
+	Ignored     string       `json:",omitempty"` // why the alert did not count against the suspect
+	Enforcement *Enforcement `json:",omitempty"` // set if the alert made the suspect cross the threshold
+}
+
+// ReportAlert records an alert a verifier sent about a failed proof, and counts it against the
+// upstream hop if the service tracks reputations. The alert must come from a verifier of the
+// flow's route in a live epoch and blame its committed predecessor, see reputation.Attribute;
+// the caller authenticates the reporter. The alert is stamped with the controller's clock, so a
+// reporter cannot backdate its reports out of the reputation window or pile them into it.
+func (s *Service) ReportAlert(alert policy.Alert) (*AlertResponse, error) {
+	if alert.Node == "" || alert.Flow == "" {
+		return nil, fmt.Errorf("an alert needs a node and a flow")
+	}
+	alert.Time = time.Now().UTC()
+	route, err := s.routeOf(alert.Flow, alert.Epoch, alert.Time)
+	if err != nil {
+		return nil, err
+	}
+	report, err := reputation.Attribute(alert, route)
+	if err != nil {
+		return nil, err
+	}
+
+	s.alertMu.Lock()
+	s.alerts = append(s.alerts, alert)
+	if len(s.alerts) > MaxAlerts {
+		s.alerts = append([]policy.Alert(nil), s.alerts[len(s.alerts)-MaxAlerts:]...)
+	}
+	s.alertMu.Unlock()
+
+	if s.OnAlert != nil {
+		s.OnAlert(alert)
+	}
+
+	resp := &AlertResponse{Suspect: report.Suspect}
+	enforcement, err := s.observeAlert(report)
+	if err != nil {
+		resp.Ignored = err.Error()
+	}
+	resp.Enforcement = enforcement
+	return resp, nil
+}
+
+// routeOf returns the route a flow was committed along in an epoch, if the epoch is live.
+func (s *Service) routeOf(flow string, epochID uint64, now time.Time) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for i, epoch := range s.epochs {
+		if epoch.ID != epochID {
+			continue
+		}
+		if notAfter := s.notAfterLocked(i); now.Before(epoch.ActivatesAt) || (!notAfter.IsZero() && !now.Before(notAfter)) {
+			return nil, fmt.Errorf("epoch %v is not active", epochID)
+		}
+		record, ok := epoch.Flows[flow]
+		if !ok {
+			return nil, fmt.Errorf("no flow %v in epoch %v", flow, epochID)
+		}
+		return record.Route, nil
+	}
+	return nil, fmt.Errorf("unknown epoch %v", epochID)
+}
+
+// Alerts returns the alerts received so far, oldest first, optionally only those of one flow.
+func (s *Service) Alerts(flow string) []policy.Alert {
+	s.alertMu.Lock()
+	defer s.alertMu.Unlock()
+
+	alerts := make([]policy.Alert, 0, len(s.alerts))
+	for _, alert := range s.alerts {
+		if flow == "" || alert.Flow == flow {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
@@ -0,0 +1,102 @@
+package controlplane
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/kzg-demo/policy"
+	"example.com/kzg-demo/reputation"
+)
+
+func TestAlertsNeedVerifierAndPredecessor(t *testing.T) {
+	s := NewService()
+	s.Reputation = reputation.NewTracker(5, time.Hour)
+	credentials := make(map[string]string)
+	for _, name := range []string{"A", "B", "C", "D"} {
+		credential, err := s.Register(name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		credentials[name] = credential
+	}
+	if _, err := s.SetFlow("f", []string{"A", "B", "C"}); err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler()
+
+	tests := []struct {
+		name       string
+		credential string
+		alert      policy.Alert
+		status     int
+	}{
+		{"no credential", "", policy.Alert{Node: "C", Flow: "f", Sender: "B"}, http.StatusUnauthorized},
+		{"another node's credential", credentials["D"], policy.Alert{Node: "C", Flow: "f", Sender: "B"}, http.StatusUnauthorized},
+		{"reporter off the route", credentials["D"], policy.Alert{Node: "D", Flow: "f", Sender: "C"}, http.StatusBadRequest},
+		{"first hop", credentials["A"], policy.Alert{Node: "A", Flow: "f", Sender: "B"}, http.StatusBadRequest},
+		{"suspect is not the predecessor", credentials["C"], policy.Alert{Node: "C", Flow: "f", Sender: "A"}, http.StatusBadRequest},
+		{"unknown epoch", credentials["C"], policy.Alert{Node: "C", Flow: "f", Epoch: 7, Sender: "B"}, http.StatusBadRequest},
+		// the controller stamps alerts itself, so a backdated one still counts within the window
+		{"predecessor", credentials["C"], policy.Alert{Node: "C", Flow: "f", Sender: "B", Time: time.Now().Add(-24 * time.Hour)}, http.StatusOK},
+		{"predecessor from the route", credentials["B"], policy.Alert{Node: "B", Flow: "f"}, http.StatusOK},
+	}
+	for _, test := range tests {
+		body, err := json.Marshal(test.alert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/alerts", bytes.NewReader(body))
+		if test.credential != "" {
+			req.Header.Set("Authorization", "Bearer "+test.credential)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%v: got %v %v, want %v", test.name, rec.Code, rec.Body.String(), test.status)
+		}
+	}
+
+	alerts := s.Alerts("f")
+	if len(alerts) != 2 {
+		t.Errorf("recorded %v alerts, want the 2 accepted ones", len(alerts))
+	}
+	for _, alert := range alerts {
+		if time.Since(alert.Time) > time.Minute {
+			t.Errorf("alert of %v kept the reporter's time %v", alert.Node, alert.Time)
+		}
+	}
+	failures := make(map[string]int)
+	for _, standing := range s.Reputation.Reputations(time.Now()) {
+		failures[standing.Node] = standing.Recent
+	}
+	if failures["A"] != 1 || failures["B"] != 1 || failures["C"] != 0 {
+		t.Errorf("failures counted %v, want one each against A and B", failures)
+	}
+
+	// forgetting failures is an admin request
+	if err := s.SetOperatorCredential("operator"); err != nil {
+		t.Fatal(err)
+	}
+	for _, presented := range []string{"", credentials["C"], "operator"} {
+		req := httptest.NewRequest(http.MethodDelete, "/reputation?node=B", nil)
+		if presented != "" {
+			req.Header.Set("Authorization", "Bearer "+presented)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		want := http.StatusUnauthorized
+		if presented == "operator" {
+			want = http.StatusNoContent
+		}
+		if rec.Code != want {
+			t.Errorf("forgetting B's failures with credential %q: got %v, want %v", presented, rec.Code, want)
+		}
+	}
+	if s.Reputation.Reset("B") {
+		t.Error("B's failures were not forgotten")
+	}
+}
@@ -0,0 +1,155 @@
+package controlplane
+
+import (
+	"fmt"
+	"time"
+
+	"example.com/kzg-demo/reputation"
+)
+
+// MaxEnforcements is the number of enforcements the controller keeps; older ones are dropped.
+const MaxEnforcements = 100
+
+// Enforcement is what the controller did with a node that crossed the failure threshold.
+type Enforcement struct {
+	Node       string
+	Action     string
+	Time       time.Time
+	Reputation reputation.Reputation
+	Revocation *RevocationResult   `json:",omitempty"`
+	Rerouted   map[string][]string `json:",omitempty"` // flow -> new route
+	Errors     []string            `json:",omitempty"` // flows that could not be rerouted, and why
+}
+
+func (e Enforcement) String() string {
+	s := fmt.Sprintf("%v %v (score %.2f, %v failures)", e.Action, e.Node, e.Reputation.Score, e.Reputation.Failures)
+	for _, id := range sortedKeys(e.Rerouted) {
+		s += fmt.Sprintf(", flow %v now %v", id, e.Rerouted[id])
+	}
+	for _, err := range e.Errors {
+		s += ", " + err
+	}
+	return s
+}
+
+// ReputationSummary lists the standing of every reported node and what was done about it.
+type ReputationSummary struct {
+	Nodes        []reputation.Reputation
+	Enforcements []Enforcement
+}
+
+// observeAlert attributes an alert to its upstream hop, and enforces the reputation action on
+// the hop if it crossed the threshold.
+func (s *Service) observeAlert(report reputation.Report) (*Enforcement, error) {
+	if s.Reputation == nil {
+		return nil, nil
+	}
+	s.mu.RLock()
+	_, revoked := s.revoked[report.Reporter]
+	registered := s.nodes[report.Reporter]
+	s.mu.RUnlock()
+	if !registered || revoked {
+		return nil, fmt.Errorf("%v is not a registered node in good standing", report.Reporter)
+	}
+	standing, crossed, err := s.Reputation.Observe(report)
+	if err != nil || !crossed {
+		return nil, err
+	}
+
+	enforcement := s.enforce(standing)
+	s.alertMu.Lock()
+	s.enforcements = append(s.enforcements, *enforcement)
+	if len(s.enforcements) > MaxEnforcements {
+		s.enforcements = append([]Enforcement(nil), s.enforcements[len(s.enforcements)-MaxEnforcements:]...)
+	}
+	s.alertMu.Unlock()
+
+	if s.OnEnforce != nil {
+		s.OnEnforce(*enforcement)
+	}
+	return enforcement, nil
+}
+
+// enforce revokes a flagged node if the service is configured to, and re-commits every flow
+// through it on a route that avoids it, preferring registered nodes in good standing as
+// replacements.
+func (s *Service) enforce(standing reputation.Reputation) *Enforcement {
+	enforcement := &Enforcement{
+		Node:       standing.Node,
+		Action:     s.ReputationAction.String(),
+		Time:       time.Now().UTC(),
+		Reputation: standing,
+		Rerouted:   make(map[string][]string),
+	}
+	if s.ReputationAction == reputation.Revoke {
+		result, err := s.Revoke(standing.Node, fmt.Sprintf("%v verification failures: %v", standing.Failures, standing.LastReason))
+		if err != nil {
+			enforcement.Errors = append(enforcement.Errors, err.Error())
+		}
+		enforcement.Revocation = result
+	}
+
+	for _, id := range s.RoutesOf(standing.Node) {
+		route, spares, ok := s.rerouteCandidates(id)
+		if !ok {
+			continue
+		}
+		avoided, err := reputation.Avoid(route, standing.Node, spares)
+		if err == nil {
+			_, err = s.SetFlow(id, avoided)
+		}
+		if err != nil {
+			enforcement.Errors = append(enforcement.Errors, fmt.Sprintf("flow %v: %v", id, err))
+			continue
+		}
+		enforcement.Rerouted[id] = avoided
+	}
+	return enforcement
+}
+
+// rerouteCandidates returns the route of a flow and the registered nodes that may replace a hop
+// of it: not revoked, not flagged and not on the route already.
+func (s *Service) rerouteCandidates(id string) ([]string, []string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.routes[id]
+	if !ok {
+		return nil, nil, false
+	}
+	onRoute := make(map[string]bool)
+	for _, hop := range record.Route {
+		onRoute[hop] = true
+	}
+	spares := make([]string, 0)
+	for _, name := range sortedKeys(s.nodes) {
+		if _, revoked := s.revoked[name]; revoked || onRoute[name] || s.Reputation.Flagged(name) {
+			continue
+		}
+		spares = append(spares, name)
+	}
+	return append([]string(nil), record.Route...), spares, true
+}
+
+// Reputations returns the standing of every reported node and the enforcements so far.
+func (s *Service) Reputations() ReputationSummary {
+	summary := ReputationSummary{Nodes: make([]reputation.Reputation, 0), Enforcements: make([]Enforcement, 0)}
+	if s.Reputation == nil {
+		return summary
+	}
+	summary.Nodes = s.Reputation.Reputations(time.Now().UTC())
+
+	s.alertMu.Lock()
+	defer s.alertMu.Unlock()
+	summary.Enforcements = append(summary.Enforcements, s.enforcements...)
+	return summary
+}
+
+// ResetReputation forgets the failures reported against a node. It does not undo a revocation or
+// move flows back onto the node.
+func (s *Service) ResetReputation(node string) error {
+	if s.Reputation == nil || !s.Reputation.Reset(node) {
+		return fmt.Errorf("no failures reported against %v", node)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package controlplane
+
+import (
+	"fmt"
+	"time"
+)
+
+type Revocation struct {
+	Node      string
+	RevokedAt time.Time
+	Reason    string
+}
+
+// RevocationResult tells the operator what a revocation touched.
+type RevocationResult struct {
+	Revocation
+	Routes   []string // routes through the revoked node; they must be rerouted
+	Rekeyed  []string // nodes whose secrets were regenerated
+	Recommit []string // routes re-committed with the new secrets
+}
+
+// addToIndexLocked and removeFromIndexLocked maintain which routes include which node.
+func (s *Service) addToIndexLocked(record *RouteRecord) {
+	for _, hop := range record.Route {
+		if s.index[hop] == nil {
+			s.index[hop] = make(map[string]bool)
+		}
+		s.index[hop][record.ID] = true
+	}
+}
+
+func (s *Service) removeFromIndexLocked(record *RouteRecord) {
+	for _, hop := range record.Route {
+		delete(s.index[hop], record.ID)
+		if len(s.index[hop]) == 0 {
+			delete(s.index, hop)
+		}
+	}
+}
+
+// RoutesOf returns the routes that include a node.
+func (s *Service) RoutesOf(name string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedKeys(s.index[name])
+}
+
+// Revoke blacklists a node whose secret leaked.
+//
+// Every node sharing a route with it holds the same polynomials, so the leaked node could have
+// solved them for their secrets too. Those nodes get fresh secrets in every live epoch, including
+// epochs that were superseded but are still accepted for their grace window, and only the routes
+// through them are re-committed, with a bumped version so proofs made with the old secrets are
+// rejected. Routes through the revoked node stay committed but verifiers refuse proofs from it
+// until the operator reroutes them.
+func (s *Service) Revoke(name string, reason string) (*RevocationResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.nodes[name] {
+		return nil, fmt.Errorf("node %v is not registered", name)
+	}
+	if _, ok := s.revoked[name]; ok {
+		return nil, fmt.Errorf("node %v is already revoked", name)
+	}
+
+	result := &RevocationResult{
+		Revocation: Revocation{Node: name, RevokedAt: time.Now().UTC(), Reason: reason},
+		Routes:     sortedKeys(s.index[name]),
+	}
+
+	exposed := make(map[string]bool)
+	for _, id := range result.Routes {
+		for _, hop := range s.routes[id].Route {
+			if hop != name {
+				exposed[hop] = true
+			}
+		}
+	}
+	recommit := make(map[string]bool)
+	for hop := range exposed {
+		for id := range s.index[hop] {
+			recommit[id] = true
+		}
+	}
+	result.Rekeyed = sortedKeys(exposed)
+	result.Recommit = sortedKeys(recommit)
+
+	// stage the new secrets, routes and commitments before touching any state
+	now := time.Now()
+	secrets := make(map[uint64]map[string]uint64)
+	flows := make(map[uint64]map[string]*FlowRecord)
+	routes := make(map[string]*RouteRecord)
+	for _, id := range result.Recommit {
+		old := s.routes[id]
+		routes[id] = &RouteRecord{ID: id, Route: old.Route, Version: old.Version + 1, RouteKey: old.RouteKey, Policy: old.Policy}
+	}
+	for i, epoch := range s.epochs {
+		// epochs past their grace window are no longer accepted, and are left to Expire
+		if notAfter := s.notAfterLocked(i); !notAfter.IsZero() && !now.Before(notAfter) {
+			continue
+		}
+		staged := &EpochRecord{
+			ID:          epoch.ID,
+			ActivatesAt: epoch.ActivatesAt,
+			Secrets:     make(map[string]uint64),
+			Flows:       make(map[string]*FlowRecord),
+		}
+		for hop, secret := range epoch.Secrets {
+			staged.Secrets[hop] = secret
+		}
+		for _, hop := range result.Rekeyed {
+			delete(staged.Secrets, hop)
+		}
+		for _, hop := range result.Rekeyed {
+			staged.Secrets[hop] = newSecret(staged.Secrets)
+		}
+		for _, id := range result.Recommit {
+			flow, err := s.commitLocked(staged, routes[id])
+			if err != nil {
+				return nil, err
+			}
+			staged.Flows[id] = flow
+		}
+		secrets[epoch.ID] = staged.Secrets
+		flows[epoch.ID] = staged.Flows
+	}
+
+	oldSecrets := make(map[uint64]map[string]uint64)
+	oldFlows := make(map[uint64]map[string]*FlowRecord)
+	oldRoutes := make(map[string]*RouteRecord)
+	for _, epoch := range s.epochs {
+		if _, ok := secrets[epoch.ID]; !ok {
+			continue
+		}
+		oldSecrets[epoch.ID] = epoch.Secrets
+		oldFlows[epoch.ID] = make(map[string]*FlowRecord)
+		epoch.Secrets = secrets[epoch.ID]
+		for id, flow := range flows[epoch.ID] {
+			oldFlows[epoch.ID][id] = epoch.Flows[id]
+			epoch.Flows[id] = flow
+		}
+	}
+	for id, record := range routes {
+		oldRoutes[id] = s.routes[id]
+		s.routes[id] = record
+	}
+	s.revoked[name] = &result.Revocation
+
+	entries := []AuditEntry{{Action: AuditRevoke, Node: name, Detail: reason}}
+	for _, epoch := range s.epochs {
+		if _, ok := secrets[epoch.ID]; !ok {
+			continue
+		}
+		for _, hop := range result.Rekeyed {
+			entries = append(entries, AuditEntry{Action: AuditSecret, Node: hop, Epoch: epoch.ID})
+		}
+		for _, id := range result.Recommit {
+			entries = append(entries, commitEntry(flows[epoch.ID][id]))
+		}
+	}
+	if err := s.persistLocked(entries...); err != nil {
+		for _, epoch := range s.epochs {
+			if _, ok := oldSecrets[epoch.ID]; !ok {
+				continue
+			}
+			epoch.Secrets = oldSecrets[epoch.ID]
+			for id, flow := range oldFlows[epoch.ID] {
+				if flow != nil {
+					epoch.Flows[id] = flow
+				} else {
+					delete(epoch.Flows, id)
+				}
+			}
+		}
+		for id, record := range oldRoutes {
+			s.routes[id] = record
+		}
+		delete(s.revoked, name)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *Service) Revocations() []Revocation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revocations := make([]Revocation, 0, len(s.revoked))
+	for _, name := range sortedKeys(s.revoked) {
+		revocations = append(revocations, *s.revoked[name])
+	}
+	return revocations
+}
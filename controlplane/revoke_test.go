@@ -0,0 +1,42 @@
+package controlplane
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRevokeRekeysEpochsInGrace(t *testing.T) {
+	s := NewService()
+	s.Grace = time.Hour
+	s.epochs[0].ActivatesAt = time.Now().Add(-time.Hour)
+	for _, name := range []string{"A", "B", "C", "D"} {
+		if _, err := s.Register(name, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.SetFlow("f", []string{"A", "B", "C"}); err != nil {
+		t.Fatal(err)
+	}
+	// epoch 1 supersedes epoch 0, which stays accepted for the grace window
+	if _, err := s.Rotate(time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	before := make(map[uint64]uint64)
+	versions := make(map[uint64]uint64)
+	for _, epoch := range s.epochs {
+		before[epoch.ID] = epoch.Secrets["A"]
+		versions[epoch.ID] = epoch.Flows["f"].Version
+	}
+	if _, err := s.Revoke("B", "leaked"); err != nil {
+		t.Fatal(err)
+	}
+	for _, epoch := range s.epochs {
+		if epoch.Secrets["A"] == before[epoch.ID] {
+			t.Errorf("epoch %v: A kept the secret B could have solved for", epoch.ID)
+		}
+		if got := epoch.Flows["f"].Version; got != versions[epoch.ID]+1 {
+			t.Errorf("epoch %v: flow f version %v, want %v", epoch.ID, got, versions[epoch.ID]+1)
+		}
+	}
+}
@@ -0,0 +1,677 @@
+package controlplane
+
+import (
+	"context"
+	"crypto/ed25519"
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"example.com/kzg-demo/keystore"
+	"example.com/kzg-demo/policy"
+	"example.com/kzg-demo/reputation"
+	"example.com/kzg-demo/types"
+	gozkg "github.com/protolambda/go-kzg"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+type NodeRecord struct {
+	Name   string
+	Secret uint64
+}
+
+func (n NodeRecord) String() string {
+	return fmt.Sprintf("NodeRecord{Name: %v, Secret: %v}", n.Name, keystore.Redacted)
+}
+
+func (n NodeRecord) GoString() string {
+	return n.String()
+}
+
+// RouteRecord is the operator's intent for a flow; it is committed once per epoch.
+type RouteRecord struct {
+	ID       string
+	Route    []string
+	Version  uint64
+	RouteKey []byte `json:",omitempty"` // set when hop positions are hidden
+	Policy   string `json:",omitempty"` // failure policy of the verifiers, see package policy
+}
+
+// FlowRecord is the commitment of a flow in one epoch.
+type FlowRecord struct {
+	ID         string
+	Route      []string
+	Version    uint64
+	Epoch      uint64
+	Polynomial []bls.Fr
+	Commitment *bls.G1Point
+	RouteKey   []byte
+
+	// Width, Slots and Openings are set for routes committed in Lagrange form, see
+	// Service.Lagrange: the size of the domain, the slot of every hop and its opening there.
+	Width    int
+	Slots    []int
+	Openings []*bls.G1Point
+
+	lagrange *types.LagrangeRoute // in memory only, updated in place by the next route change
+}
+
+// EpochRecord holds the node secrets and flow commitments of one epoch.
+// An epoch is published before ActivatesAt, and stays acceptable until its successor
+// has been active for the grace window.
+type EpochRecord struct {
+	ID          uint64
+	ActivatesAt time.Time
+	Secrets     map[string]uint64
+	Flows       map[string]*FlowRecord
+}
+
+var ErrRevoked = errors.New("node is revoked")
+
+// Service is the controller side of the demo: it owns node secrets and the committed flows.
+type Service struct {
+	// Grace is how long verifiers keep accepting an epoch after its successor activated.
+	Grace time.Duration
+	// PaddedDegree, if non-zero, pads every route polynomial to this degree.
+	PaddedDegree int
+	// HidePositions commits new flows against position labels instead of the hop indices 1..n,
+	// and hands each hop only its own label and its predecessor.
+	HidePositions bool
+	// Lagrange, if set, commits new route versions in evaluation form over its domain. A route
+	// change of one hop then updates the commitment and every opening in place instead of
+	// re-interpolating the route, and nodes get their opening instead of the polynomial.
+	Lagrange *types.LagrangeSettings
+	// SigningKey signs the commitment of every flow handed to the nodes; NewService generates
+	// an ephemeral one.
+	SigningKey ed25519.PrivateKey
+	// OnAlert, if set, is called with every alert a verifier reports.
+	OnAlert func(policy.Alert)
+	// Reputation, if set, counts every alert against the upstream hop it blames; a hop that
+	// crosses the threshold is handled with ReputationAction, and OnEnforce is called if set.
+	Reputation       *reputation.Tracker
+	ReputationAction reputation.Action
+	OnEnforce        func(Enforcement)
+
+	mu       sync.RWMutex
+	settings *gozkg.KZGSettings
+	nodes    map[string]bool
+	// credentials holds the hash of the credential issued to each node
+	credentials map[string][32]byte
+	hopKeys     map[string]ed25519.PublicKey // keys the nodes sign chain links with
+	operator    *[32]byte                    // hash of the operator credential, see SetOperatorCredential
+	routes      map[string]*RouteRecord
+	epochs      []*EpochRecord             // ordered by ID
+	index       map[string]map[string]bool // node -> routes through it
+	revoked     map[string]*Revocation
+	store       *Store
+	audit       *AuditLog
+	translog    *TransparencyLog
+	// auditedSetup is the hash of the last setup recorded in the audit log
+	auditedSetup [32]byte
+
+	alertMu      sync.Mutex
+	alerts       []policy.Alert // most recent last, at most MaxAlerts
+	enforcements []Enforcement  // most recent last, at most MaxEnforcements
+}
+
+func NewService() *Service {
+	_, signingKey, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return &Service{
+		Grace:       30 * time.Second,
+		SigningKey:  signingKey,
+		settings:    types.NewKzgSettings(0),
+		nodes:       make(map[string]bool),
+		credentials: make(map[string][32]byte),
+		hopKeys:     make(map[string]ed25519.PublicKey),
+		routes:      make(map[string]*RouteRecord),
+		index:       make(map[string]map[string]bool),
+		revoked:     make(map[string]*Revocation),
+		translog:    NewTransparencyLog(),
+		epochs: []*EpochRecord{{
+			ID:          0,
+			ActivatesAt: time.Now().UTC(),
+			Secrets:     make(map[string]uint64),
+			Flows:       make(map[string]*FlowRecord),
+		}},
+	}
+}
+
+// OpenService restores the service from the store, and snapshots every later change into it.
+func OpenService(store *Store) (*Service, error) {
+	s := NewService()
+	state, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if state != nil {
+		if err := s.Restore(state); err != nil {
+			return nil, err
+		}
+	}
+	s.store = store
+	return s, nil
+}
+
+// Register adds a node, generating its secret in every live epoch on first registration, and
+// returns the credential the node must present from then on. A registered node registers again
+// with its credential, and gets none back; a node restored from a state without credentials is
+// issued one on its next registration.
+func (s *Service) Register(name string, credential string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("empty node name")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.revoked[name]; ok {
+		return "", fmt.Errorf("node %v is revoked", name)
+	}
+	if s.nodes[name] {
+		if _, ok := s.credentials[name]; ok {
+			return "", s.authenticateLocked(name, credential)
+		}
+	}
+
+	issued, hash, err := newCredential()
+	if err != nil {
+		return "", err
+	}
+	s.credentials[name] = hash
+	if s.nodes[name] {
+		if err := s.persistLocked(AuditEntry{Action: AuditRegister, Node: name, Detail: "credential issued"}); err != nil {
+			delete(s.credentials, name)
+			return "", err
+		}
+		return issued, nil
+	}
+
+	s.nodes[name] = true
+	entries := []AuditEntry{{Action: AuditRegister, Node: name}}
+	for _, epoch := range s.epochs {
+		epoch.Secrets[name] = newSecret(epoch.Secrets)
+		entries = append(entries, AuditEntry{Action: AuditSecret, Node: name, Epoch: epoch.ID})
+	}
+	if err := s.persistLocked(entries...); err != nil {
+		delete(s.nodes, name)
+		delete(s.credentials, name)
+		for _, epoch := range s.epochs {
+			delete(epoch.Secrets, name)
+		}
+		return "", err
+	}
+	return issued, nil
+}
+
+// newSecret draws a secret that no other node uses in the same epoch.
+func newSecret(used map[string]uint64) uint64 {
+	for {
+		data := uint64(rand.Int31())
+		unique := true
+		for _, secret := range used {
+			if secret == data {
+				unique = false
+				break
+			}
+		}
+		if unique {
+			return data
+		}
+	}
+}
+
+// SetFlow commits the route of a flow in the current and upcoming epochs.
+// Re-committing an existing flow bumps its version.
+func (s *Service) SetFlow(id string, route []string) (*FlowRecord, error) {
+	if id == "" {
+		return nil, fmt.Errorf("empty flow id")
+	}
+	if len(route) < 3 {
+		return nil, fmt.Errorf("a route needs at least 3 nodes, got %v", len(route))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range route {
+		if !s.nodes[name] {
+			return nil, fmt.Errorf("node %v is not registered", name)
+		}
+		if _, ok := s.revoked[name]; ok {
+			return nil, fmt.Errorf("node %v is revoked", name)
+		}
+	}
+
+	record := &RouteRecord{ID: id, Route: append([]string(nil), route...)}
+	old, existed := s.routes[id]
+	if existed {
+		record.Version = old.Version + 1
+		record.RouteKey = old.RouteKey
+		record.Policy = old.Policy
+	}
+	// the key is kept across versions so flows of older epochs keep their labels
+	if s.HidePositions && record.RouteKey == nil {
+		key, err := types.NewRouteKey()
+		if err != nil {
+			return nil, err
+		}
+		record.RouteKey = key
+	}
+
+	now := time.Now()
+	flows := make(map[uint64]*FlowRecord)
+	for i, epoch := range s.epochs {
+		if s.supersededLocked(i, now) {
+			continue
+		}
+		flow, err := s.commitLocked(epoch, record)
+		if err != nil {
+			return nil, err
+		}
+		flows[epoch.ID] = flow
+	}
+
+	// apply only after every epoch committed successfully
+	previous := make(map[uint64]*FlowRecord)
+	entries := make([]AuditEntry, 0, len(flows))
+	for _, epoch := range s.epochs {
+		if flow, ok := flows[epoch.ID]; ok {
+			previous[epoch.ID] = epoch.Flows[id]
+			epoch.Flows[id] = flow
+			entries = append(entries, commitEntry(flow))
+		}
+	}
+	if existed {
+		s.removeFromIndexLocked(old)
+	}
+	s.routes[id] = record
+	s.addToIndexLocked(record)
+	if err := s.persistLocked(entries...); err != nil {
+		for _, epoch := range s.epochs {
+			if flow, ok := previous[epoch.ID]; ok && flow != nil {
+				epoch.Flows[id] = flow
+			} else if ok {
+				delete(epoch.Flows, id)
+			}
+		}
+		s.removeFromIndexLocked(record)
+		if existed {
+			s.routes[id] = old
+			s.addToIndexLocked(old)
+		} else {
+			delete(s.routes, id)
+		}
+		return nil, err
+	}
+	return flows[s.currentLocked(now).ID], nil
+}
+
+// commitLocked interpolates and commits a route with the node secrets of an epoch.
+func (s *Service) commitLocked(epoch *EpochRecord, record *RouteRecord) (*FlowRecord, error) {
+	nodesPrivateData := make([]uint32, 0, len(record.Route))
+	for i, visit := range types.Visits(record.Route) {
+		nodesPrivateData = append(nodesPrivateData, uint32(types.VisitSecret(epoch.Secrets[record.Route[i]], visit)))
+	}
+
+	if s.Lagrange != nil {
+		return s.commitLagrangeLocked(epoch, record, nodesPrivateData)
+	}
+
+	controller := types.Controller{PaddedDegree: s.PaddedDegree, RouteKey: record.RouteKey}
+	ks, polynomial, err := controller.Setup(nodesPrivateData)
+	if err != nil {
+		return nil, fmt.Errorf("epoch %v: %w", epoch.ID, err)
+	}
+	if len(ks.SecretG1) > len(s.settings.SecretG1) {
+		s.settings = ks
+	}
+
+	return &FlowRecord{
+		ID:         record.ID,
+		Route:      record.Route,
+		Version:    record.Version,
+		Epoch:      epoch.ID,
+		Polynomial: polynomial,
+		Commitment: controller.Commit(),
+		RouteKey:   record.RouteKey,
+	}, nil
+}
+
+// commitLagrangeLocked commits a route in Lagrange form. If the flow is committed in this epoch
+// already and the route changed by one hop, the committed route is updated in place; otherwise,
+// e.g., after a rotation, a revocation or a restart, it is set up from scratch.
+func (s *Service) commitLagrangeLocked(epoch *EpochRecord, record *RouteRecord, nodesPrivateData []uint32) (*FlowRecord, error) {
+	controller := types.Controller{Lagrange: s.Lagrange, PaddedDegree: s.PaddedDegree, RouteKey: record.RouteKey}
+	updated := false
+	if old, ok := epoch.Flows[record.ID]; ok && old.lagrange != nil && old.Width == s.Lagrange.Width {
+		controller.Route = old.lagrange.Clone()
+		controller.Slots = controller.Route.Slots
+		updated = controller.Update(nodesPrivateData) == nil
+	}
+	if !updated {
+		controller.Route = nil
+		controller.Slots = nil
+		if _, _, err := controller.Setup(nodesPrivateData); err != nil {
+			return nil, fmt.Errorf("epoch %v: %w", epoch.ID, err)
+		}
+	}
+
+	return &FlowRecord{
+		ID:         record.ID,
+		Route:      record.Route,
+		Version:    record.Version,
+		Epoch:      epoch.ID,
+		Commitment: controller.Commit(),
+		RouteKey:   record.RouteKey,
+		Width:      s.Lagrange.Width,
+		Slots:      append([]int(nil), controller.Route.Slots...),
+		Openings:   append([]*bls.G1Point(nil), controller.Route.Proofs...),
+		lagrange:   controller.Route,
+	}, nil
+}
+
+// commitEntry records a flow commitment in the audit log.
+func commitEntry(flow *FlowRecord) AuditEntry {
+	return AuditEntry{
+		Action:     AuditCommit,
+		Flow:       flow.ID,
+		Route:      flow.Route,
+		Epoch:      flow.Epoch,
+		Version:    flow.Version,
+		Commitment: flow.Commitment,
+	}
+}
+
+func (s *Service) RemoveFlow(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.routes[id]
+	if !ok {
+		return fmt.Errorf("flow %v not found", id)
+	}
+	previous := make(map[uint64]*FlowRecord)
+	for _, epoch := range s.epochs {
+		if flow, ok := epoch.Flows[id]; ok {
+			previous[epoch.ID] = flow
+			delete(epoch.Flows, id)
+		}
+	}
+	delete(s.routes, id)
+	s.removeFromIndexLocked(old)
+	if err := s.persistLocked(AuditEntry{Action: AuditRemove, Flow: id, Version: old.Version}); err != nil {
+		for _, epoch := range s.epochs {
+			if flow, ok := previous[epoch.ID]; ok {
+				epoch.Flows[id] = flow
+			}
+		}
+		s.routes[id] = old
+		s.addToIndexLocked(old)
+		return err
+	}
+	return nil
+}
+
+// Flows returns the commitments of the current epoch.
+func (s *Service) Flows() []*FlowRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	epoch := s.currentLocked(time.Now())
+	flows := make([]*FlowRecord, 0, len(epoch.Flows))
+	for _, id := range sortedKeys(epoch.Flows) {
+		flows = append(flows, epoch.Flows[id])
+	}
+	return flows
+}
+
+func (s *Service) Epochs() []EpochSummary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	summaries := make([]EpochSummary, 0, len(s.epochs))
+	for i, epoch := range s.epochs {
+		summary := EpochSummary{
+			Epoch:       epoch.ID,
+			ActivatesAt: epoch.ActivatesAt,
+			NotAfter:    s.notAfterLocked(i),
+			Flows:       make([]FlowSummary, 0, len(epoch.Flows)),
+		}
+		for _, id := range sortedKeys(epoch.Flows) {
+			summary.Flows = append(summary.Flows, summarize(epoch.Flows[id]))
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+// Rotate publishes a new epoch with fresh node secrets and re-commits every flow in it.
+// The new epoch becomes current at activatesAt; until then nodes keep proving with the current one.
+func (s *Service) Rotate(activatesAt time.Time) (*EpochRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last := s.epochs[len(s.epochs)-1]
+	if !activatesAt.After(last.ActivatesAt) {
+		return nil, fmt.Errorf("epoch must activate after %v", last.ActivatesAt)
+	}
+
+	epoch := &EpochRecord{
+		ID:          last.ID + 1,
+		ActivatesAt: activatesAt.UTC(),
+		Secrets:     make(map[string]uint64),
+		Flows:       make(map[string]*FlowRecord),
+	}
+	entries := []AuditEntry{{Action: AuditRotate, Epoch: epoch.ID, Detail: "activates at " + epoch.ActivatesAt.Format(time.RFC3339)}}
+	for _, name := range sortedKeys(s.nodes) {
+		epoch.Secrets[name] = newSecret(epoch.Secrets)
+		entries = append(entries, AuditEntry{Action: AuditSecret, Node: name, Epoch: epoch.ID})
+	}
+	for _, id := range sortedKeys(s.routes) {
+		flow, err := s.commitLocked(epoch, s.routes[id])
+		if err != nil {
+			return nil, err
+		}
+		epoch.Flows[id] = flow
+		entries = append(entries, commitEntry(flow))
+	}
+
+	s.epochs = append(s.epochs, epoch)
+	if err := s.persistLocked(entries...); err != nil {
+		s.epochs = s.epochs[:len(s.epochs)-1]
+		return nil, err
+	}
+	return epoch, nil
+}
+
+// Expire drops epochs whose grace window has ended.
+func (s *Service) Expire(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	epochs := make([]*EpochRecord, 0, len(s.epochs))
+	var entries []AuditEntry
+	for i, epoch := range s.epochs {
+		notAfter := s.notAfterLocked(i)
+		if notAfter.IsZero() || now.Before(notAfter) {
+			epochs = append(epochs, epoch)
+		} else {
+			entries = append(entries, AuditEntry{Action: AuditExpire, Epoch: epoch.ID})
+		}
+	}
+	if len(epochs) == len(s.epochs) {
+		return nil
+	}
+
+	old := s.epochs
+	s.epochs = epochs
+	if err := s.persistLocked(entries...); err != nil {
+		s.epochs = old
+		return err
+	}
+	return nil
+}
+
+// RunRotation starts a new epoch every length, publishing it lead ahead of its activation,
+// and expires old epochs, until ctx is done.
+func (s *Service) RunRotation(ctx context.Context, length time.Duration, lead time.Duration, onError func(error)) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mu.RLock()
+			next := s.epochs[len(s.epochs)-1].ActivatesAt.Add(length)
+			s.mu.RUnlock()
+
+			if !now.Before(next.Add(-lead)) {
+				// after a long downtime, do not publish epochs that are already due
+				if next.Before(now.Add(lead)) {
+					next = now.Add(lead)
+				}
+				if _, err := s.Rotate(next); err != nil {
+					onError(err)
+				}
+			}
+			if err := s.Expire(now); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// supersededLocked reports whether a newer epoch already activated, i.e., epoch i is only
+// kept for its grace window.
+func (s *Service) supersededLocked(i int, now time.Time) bool {
+	return i+1 < len(s.epochs) && !now.Before(s.epochs[i+1].ActivatesAt)
+}
+
+func (s *Service) currentLocked(now time.Time) *EpochRecord {
+	current := s.epochs[0]
+	for _, epoch := range s.epochs {
+		if !now.Before(epoch.ActivatesAt) {
+			current = epoch
+		}
+	}
+	return current
+}
+
+// notAfterLocked is the end of the grace window of epoch i, or zero while it has no successor.
+func (s *Service) notAfterLocked(i int) time.Time {
+	if i+1 >= len(s.epochs) {
+		return time.Time{}
+	}
+	return s.epochs[i+1].ActivatesAt.Add(s.Grace)
+}
+
+// NodeParams collects the secrets of a node together with every flow it participates in,
+// for each live epoch.
+func (s *Service) NodeParams(name string) (*types.NodeParams, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.nodes[name] {
+		return nil, fmt.Errorf("node %v is not registered", name)
+	}
+	if _, ok := s.revoked[name]; ok {
+		return nil, ErrRevoked
+	}
+
+	params := &types.NodeParams{
+		Node:    name,
+		Revoked: sortedKeys(s.revoked),
+		Setup: types.SetupParams{
+			SecretG1: s.settings.SecretG1,
+			SecretG2: s.settings.SecretG2,
+		},
+		Epochs: make([]types.EpochParams, 0, len(s.epochs)),
+	}
+	setupHash := types.SetupHash(s.settings.SecretG1, s.settings.SecretG2)
+	params.TreeHead = s.treeHeadLocked()
+	for _, node := range sortedKeys(s.hopKeys) {
+		if _, ok := s.revoked[node]; !ok {
+			params.HopKeys = append(params.HopKeys, types.SignHopKey(s.SigningKey, node, s.hopKeys[node]))
+		}
+	}
+
+	for i, epoch := range s.epochs {
+		epochParams := types.EpochParams{
+			Epoch:     epoch.ID,
+			NotBefore: epoch.ActivatesAt,
+			NotAfter:  s.notAfterLocked(i),
+			Secret:    epoch.Secrets[name],
+			Flows:     make([]types.FlowParams, 0),
+		}
+		for _, id := range sortedKeys(epoch.Flows) {
+			flow := epoch.Flows[id]
+			visits := types.Visits(flow.Route)
+			for j, hop := range flow.Route {
+				if hop != name {
+					continue
+				}
+				flowParams := types.FlowParams{
+					FlowID:     flow.ID,
+					Version:    flow.Version,
+					Route:      flow.Route,
+					Position:   j + 1, // starts from 1
+					Visit:      visits[j],
+					Polynomial: types.PolynomialToStrings(flow.Polynomial),
+					Commitment: flow.Commitment,
+					Signature:  types.SignParams(s.SigningKey, flow.ID, epoch.ID, flow.Version, flow.Commitment, setupHash),
+				}
+				if route, ok := s.routes[flow.ID]; ok {
+					flowParams.Policy = route.Policy
+				}
+				if flow.Width > 0 && j < len(flow.Slots) {
+					flowParams.Width = flow.Width
+					flowParams.Slot = flow.Slots[j]
+					flowParams.PreviousSlot = -1
+					if j > 0 {
+						flowParams.PreviousSlot = flow.Slots[j-1]
+					}
+					flowParams.Opening = flow.Openings[j]
+				}
+				inclusion, err := s.translog.Inclusion(flow, params.TreeHead.Size)
+				if err != nil {
+					return nil, err
+				}
+				flowParams.Inclusion = inclusion
+				if j > 0 {
+					flowParams.Previous = flow.Route[j-1]
+				}
+				if flow.RouteKey != nil {
+					// the hop learns its label, its predecessor and the predecessor's label; without
+					// the route key it cannot walk the labels to find where it sits on the route
+					labels := types.Labels(flow.RouteKey, j+1)
+					flowParams.Route = nil
+					flowParams.Position = 0
+					flowParams.Label = labels[j].String()
+					if j > 0 {
+						flowParams.PreviousLabel = labels[j-1].String()
+					}
+				}
+				epochParams.Flows = append(epochParams.Flows, flowParams)
+			}
+		}
+		params.Epochs = append(params.Epochs, epochParams)
+	}
+	return params, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,43 @@
+package controlplane
+
+import (
+	"testing"
+
+	"example.com/kzg-demo/types"
+)
+
+func TestHiddenPositionsKeepRouteKey(t *testing.T) {
+	s := NewService()
+	s.HidePositions = true
+	for _, name := range []string{"A", "B", "C"} {
+		if _, err := s.Register(name, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flow, err := s.SetFlow("f", []string{"A", "B", "C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := types.Labels(flow.RouteKey, 3)
+
+	for i, name := range []string{"A", "B", "C"} {
+		params, err := s.NodeParams(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := params.Epochs[0].Flows[0]
+		if got.Route != nil || got.Position != 0 {
+			t.Errorf("%v learns route %v and position %v", name, got.Route, got.Position)
+		}
+		if got.Label != labels[i].String() {
+			t.Errorf("%v got label %v, want %v", name, got.Label, labels[i].String())
+		}
+		want := ""
+		if i > 0 {
+			want = labels[i-1].String()
+		}
+		if got.PreviousLabel != want {
+			t.Errorf("%v got previous label %q, want %q", name, got.PreviousLabel, want)
+		}
+	}
+}
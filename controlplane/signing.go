@@ -0,0 +1,62 @@
+package controlplane
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"example.com/kzg-demo/keystore"
+	"example.com/kzg-demo/utils"
+)
+
+// LoadSigningKey reads an Ed25519 signing key, the controller's or a node's hop key, from path,
+// generating and saving a new one if the file does not exist. The key is sealed with the keystore when a passphrase is
+// given, and stored as a hex seed otherwise.
+func LoadSigningKey(path string, passphrase []byte) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createSigningKey(path, passphrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if keystore.IsSealed(data) {
+		if passphrase == nil {
+			return nil, fmt.Errorf("signing key %v is encrypted, but no passphrase was given", path)
+		}
+		if data, err = keystore.Open(passphrase, data); err != nil {
+			return nil, err
+		}
+	}
+	seed, err := hex.DecodeString(string(data))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key %v is malformed", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func createSigningKey(path string, passphrase []byte) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	data := []byte(hex.EncodeToString(key.Seed()))
+	if passphrase != nil {
+		if data, err = keystore.Seal(passphrase, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := utils.WriteFileAtomic(path, data); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// PublicKey returns the key nodes pin to check the parameters they download.
+func (s *Service) PublicKey() ed25519.PublicKey {
+	return s.SigningKey.Public().(ed25519.PublicKey)
+}
@@ -0,0 +1,320 @@
+package controlplane
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"example.com/kzg-demo/keystore"
+	"example.com/kzg-demo/types"
+	"example.com/kzg-demo/utils"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+const stateFormatVersion = 2
+
+type FlowState struct {
+	ID         string
+	Version    uint64
+	Polynomial []string // decimal coefficients
+	Commitment *bls.G1Point
+	Width      int            `json:",omitempty"` // set for routes committed in Lagrange form
+	Slots      []int          `json:",omitempty"`
+	Openings   []*bls.G1Point `json:",omitempty"`
+}
+
+type EpochState struct {
+	ID          uint64
+	ActivatesAt time.Time
+	Secrets     []NodeRecord
+	Flows       []FlowState
+}
+
+// State is the serializable form of everything the controller knows.
+type State struct {
+	FormatVersion int
+	SavedAt       time.Time
+	Nodes         []string
+	Routes        []RouteRecord
+	Epochs        []EpochState
+	Revoked       []Revocation
+	Credentials   []NodeCredential `json:",omitempty"`
+	HopKeys       []NodeHopKey     `json:",omitempty"`
+	Transparency  []string         `json:",omitempty"` // hex leaf hashes of the transparency log
+}
+
+// Store keeps the controller state in a single JSON file.
+// Snapshots are written to a temporary file and renamed, so a crash never leaves a partial state behind.
+type Store struct {
+	Path       string
+	passphrase []byte
+}
+
+func NewStore(path string) *Store {
+	return &Store{Path: path}
+}
+
+// NewEncryptedStore is like NewStore, but node secrets and polynomials are sealed with the keystore.
+func NewEncryptedStore(path string, passphrase []byte) *Store {
+	return &Store{Path: path, passphrase: passphrase}
+}
+
+func (st *Store) Save(state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if st.passphrase != nil {
+		data, err = keystore.Seal(st.passphrase, data)
+		if err != nil {
+			return err
+		}
+	}
+	return utils.WriteFileAtomic(st.Path, data)
+}
+
+// Load reads the last snapshot. A missing file yields (nil, nil).
+func (st *Store) Load() (*State, error) {
+	data, err := os.ReadFile(st.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if keystore.IsSealed(data) {
+		if st.passphrase == nil {
+			return nil, fmt.Errorf("state file %v is encrypted, a passphrase is required", st.Path)
+		}
+		data, err = keystore.Open(st.passphrase, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("corrupted state file %v: %w", st.Path, err)
+	}
+	if state.FormatVersion != stateFormatVersion {
+		return nil, fmt.Errorf("unsupported state format version %v", state.FormatVersion)
+	}
+	return &state, nil
+}
+
+// Snapshot captures the current state of the service.
+func (s *Service) Snapshot() *State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.snapshotLocked()
+}
+
+func (s *Service) snapshotLocked() *State {
+	state := &State{
+		FormatVersion: stateFormatVersion,
+		SavedAt:       time.Now().UTC(),
+		Nodes:         sortedKeys(s.nodes),
+		Routes:        make([]RouteRecord, 0, len(s.routes)),
+		Epochs:        make([]EpochState, 0, len(s.epochs)),
+		Revoked:       make([]Revocation, 0, len(s.revoked)),
+	}
+	for _, name := range sortedKeys(s.revoked) {
+		state.Revoked = append(state.Revoked, *s.revoked[name])
+	}
+	for _, name := range sortedKeys(s.credentials) {
+		hash := s.credentials[name]
+		state.Credentials = append(state.Credentials, NodeCredential{Name: name, Hash: hex.EncodeToString(hash[:])})
+	}
+	for _, name := range sortedKeys(s.hopKeys) {
+		state.HopKeys = append(state.HopKeys, NodeHopKey{Name: name, Key: hex.EncodeToString(s.hopKeys[name])})
+	}
+	for _, leaf := range s.translog.leaves {
+		state.Transparency = append(state.Transparency, hex.EncodeToString(leaf))
+	}
+	for _, id := range sortedKeys(s.routes) {
+		state.Routes = append(state.Routes, *s.routes[id])
+	}
+	for _, epoch := range s.epochs {
+		epochState := EpochState{
+			ID:          epoch.ID,
+			ActivatesAt: epoch.ActivatesAt,
+			Secrets:     make([]NodeRecord, 0, len(epoch.Secrets)),
+			Flows:       make([]FlowState, 0, len(epoch.Flows)),
+		}
+		for _, name := range sortedKeys(epoch.Secrets) {
+			epochState.Secrets = append(epochState.Secrets, NodeRecord{Name: name, Secret: epoch.Secrets[name]})
+		}
+		for _, id := range sortedKeys(epoch.Flows) {
+			flow := epoch.Flows[id]
+			epochState.Flows = append(epochState.Flows, FlowState{
+				ID:         flow.ID,
+				Version:    flow.Version,
+				Polynomial: types.PolynomialToStrings(flow.Polynomial),
+				Commitment: flow.Commitment,
+				Width:      flow.Width,
+				Slots:      flow.Slots,
+				Openings:   flow.Openings,
+			})
+		}
+		state.Epochs = append(state.Epochs, epochState)
+	}
+	return state
+}
+
+// Restore replaces the state of the service with a snapshot.
+func (s *Service) Restore(state *State) error {
+	if len(state.Epochs) == 0 {
+		return fmt.Errorf("state has no epochs")
+	}
+
+	nodes := make(map[string]bool)
+	for _, name := range state.Nodes {
+		nodes[name] = true
+	}
+	routes := make(map[string]*RouteRecord)
+	for i := range state.Routes {
+		route := state.Routes[i]
+		for _, hop := range route.Route {
+			if !nodes[hop] {
+				return fmt.Errorf("flow %v: node %v is not registered", route.ID, hop)
+			}
+		}
+		routes[route.ID] = &route
+	}
+
+	credentials := make(map[string][32]byte)
+	for _, credential := range state.Credentials {
+		hash, err := hex.DecodeString(credential.Hash)
+		if err != nil || len(hash) != sha256.Size || !nodes[credential.Name] {
+			return fmt.Errorf("malformed credential of node %v", credential.Name)
+		}
+		credentials[credential.Name] = [32]byte(hash)
+	}
+
+	hopKeys := make(map[string]ed25519.PublicKey)
+	for _, hopKey := range state.HopKeys {
+		key, err := hex.DecodeString(hopKey.Key)
+		if err != nil || len(key) != ed25519.PublicKeySize || !nodes[hopKey.Name] {
+			return fmt.Errorf("malformed hop key of node %v", hopKey.Name)
+		}
+		hopKeys[hopKey.Name] = key
+	}
+
+	revoked := make(map[string]*Revocation)
+	for i := range state.Revoked {
+		revocation := state.Revoked[i]
+		revoked[revocation.Node] = &revocation
+	}
+
+	maxLen := 0
+	epochs := make([]*EpochRecord, 0, len(state.Epochs))
+	for _, epochState := range state.Epochs {
+		if len(epochs) > 0 && epochState.ID <= epochs[len(epochs)-1].ID {
+			return fmt.Errorf("epoch %v is out of order", epochState.ID)
+		}
+		epoch := &EpochRecord{
+			ID:          epochState.ID,
+			ActivatesAt: epochState.ActivatesAt,
+			Secrets:     make(map[string]uint64),
+			Flows:       make(map[string]*FlowRecord),
+		}
+		for _, node := range epochState.Secrets {
+			epoch.Secrets[node.Name] = node.Secret
+		}
+		for _, flow := range epochState.Flows {
+			route, ok := routes[flow.ID]
+			if !ok {
+				return fmt.Errorf("epoch %v: flow %v has no route", epoch.ID, flow.ID)
+			}
+			polynomial, err := types.PolynomialFromStrings(flow.Polynomial)
+			if err != nil {
+				return fmt.Errorf("epoch %v: flow %v: %w", epoch.ID, flow.ID, err)
+			}
+			if flow.Commitment == nil {
+				return fmt.Errorf("epoch %v: flow %v: missing commitment", epoch.ID, flow.ID)
+			}
+			if len(flow.Slots) != len(flow.Openings) {
+				return fmt.Errorf("epoch %v: flow %v: %v slots for %v openings", epoch.ID, flow.ID, len(flow.Slots), len(flow.Openings))
+			}
+			epoch.Flows[flow.ID] = &FlowRecord{
+				ID:         flow.ID,
+				Route:      route.Route,
+				Version:    flow.Version,
+				Epoch:      epoch.ID,
+				Polynomial: polynomial,
+				Commitment: flow.Commitment,
+				RouteKey:   route.RouteKey,
+				Width:      flow.Width,
+				Slots:      flow.Slots,
+				Openings:   flow.Openings,
+			}
+			maxLen = max(maxLen, len(polynomial))
+		}
+		epochs = append(epochs, epoch)
+	}
+
+	// states written before the transparency log existed get their commitments logged now
+	translog := NewTransparencyLog()
+	for _, leaf := range state.Transparency {
+		leafHash, err := hex.DecodeString(leaf)
+		if err != nil || len(leafHash) != sha256.Size {
+			return fmt.Errorf("malformed transparency log leaf %q", leaf)
+		}
+		translog.appendLeaf(leafHash)
+	}
+	for _, epoch := range epochs {
+		for _, id := range sortedKeys(epoch.Flows) {
+			translog.appendLeaf(types.LeafHash(types.LogLeaf(id, epoch.ID, epoch.Flows[id].Version, epoch.Flows[id].Commitment)))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes = nodes
+	s.credentials = credentials
+	s.hopKeys = hopKeys
+	s.translog = translog
+	s.routes = routes
+	s.epochs = epochs
+	s.revoked = revoked
+	s.index = make(map[string]map[string]bool)
+	for _, route := range routes {
+		s.addToIndexLocked(route)
+	}
+	s.settings = types.NewKzgSettings(maxLen)
+	return nil
+}
+
+// persistLocked writes the audit entries of a change, then a snapshot if the service is backed
+// by a store. The entries are logged first, so no persisted change goes unaudited; a change that
+// fails to persist is followed by an abort entry.
+func (s *Service) persistLocked(entries ...AuditEntry) error {
+	if s.audit != nil {
+		if setupHash := types.SetupHash(s.settings.SecretG1, s.settings.SecretG2); setupHash != s.auditedSetup {
+			setup := AuditEntry{Action: AuditSetup, Detail: fmt.Sprintf("%v points, hash %x", len(s.settings.SecretG1), setupHash)}
+			entries = append([]AuditEntry{setup}, entries...)
+			s.auditedSetup = setupHash
+		}
+		if err := s.audit.Append(entries...); err != nil {
+			return err
+		}
+	}
+	size := s.translog.Size()
+	s.publishLocked(entries)
+	if s.store == nil {
+		return nil
+	}
+	if err := s.store.Save(s.snapshotLocked()); err != nil {
+		s.translog.truncate(size)
+		if s.audit != nil {
+			_ = s.audit.Append(AuditEntry{Action: AuditAbort, Detail: err.Error()})
+		}
+		return err
+	}
+	return nil
+}
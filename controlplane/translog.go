@@ -0,0 +1,90 @@
+package controlplane
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"example.com/kzg-demo/types"
+)
+
+// TransparencyLog is the append-only Merkle log of every commitment the controller published.
+type TransparencyLog struct {
+	leaves [][]byte          // leaf hashes, in publication order
+	index  map[string]uint64 // hex leaf hash -> position
+}
+
+func NewTransparencyLog() *TransparencyLog {
+	return &TransparencyLog{index: make(map[string]uint64)}
+}
+
+func (l *TransparencyLog) Size() uint64 {
+	return uint64(len(l.leaves))
+}
+
+// appendLeaf adds a leaf hash unless it is already logged, e.g., when a state is re-persisted.
+func (l *TransparencyLog) appendLeaf(leafHash []byte) {
+	key := hex.EncodeToString(leafHash)
+	if _, ok := l.index[key]; ok {
+		return
+	}
+	l.index[key] = uint64(len(l.leaves))
+	l.leaves = append(l.leaves, leafHash)
+}
+
+// truncate drops the leaves appended after size, to roll back a change that failed to persist.
+func (l *TransparencyLog) truncate(size uint64) {
+	for _, leaf := range l.leaves[size:] {
+		delete(l.index, hex.EncodeToString(leaf))
+	}
+	l.leaves = l.leaves[:size]
+}
+
+// Inclusion proves that the commitment of a flow is logged, in the tree of the given size.
+func (l *TransparencyLog) Inclusion(flow *FlowRecord, size uint64) (*types.InclusionProof, error) {
+	leafHash := types.LeafHash(types.LogLeaf(flow.ID, flow.Epoch, flow.Version, flow.Commitment))
+	i, ok := l.index[hex.EncodeToString(leafHash)]
+	if !ok || i >= size || size > l.Size() {
+		return nil, fmt.Errorf("flow %v version %v of epoch %v is not in the log of size %v", flow.ID, flow.Version, flow.Epoch, size)
+	}
+	return types.ProveInclusion(l.leaves[:size], i)
+}
+
+// Consistency proves that the log of size first is a prefix of the log of size second.
+func (l *TransparencyLog) Consistency(first uint64, second uint64) ([][]byte, error) {
+	if second > l.Size() || first > second {
+		return nil, fmt.Errorf("no consistency proof from %v to %v leaves, the log has %v", first, second, l.Size())
+	}
+	if first == 0 || first == second {
+		return nil, nil
+	}
+	return types.ProveConsistency(l.leaves[:second], first)
+}
+
+// TreeHead returns the current size and root of the log, signed by the controller.
+func (s *Service) TreeHead() *types.TreeHead {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.treeHeadLocked()
+}
+
+func (s *Service) treeHeadLocked() *types.TreeHead {
+	head := &types.TreeHead{Size: s.translog.Size(), Root: types.RootHash(s.translog.leaves)}
+	head.Sign(s.SigningKey)
+	return head
+}
+
+// Consistency proves that the log only grew between two tree heads.
+func (s *Service) Consistency(first uint64, second uint64) ([][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.translog.Consistency(first, second)
+}
+
+// publishLocked appends the commitments of a change to the log.
+func (s *Service) publishLocked(entries []AuditEntry) {
+	for _, entry := range entries {
+		if entry.Action == AuditCommit {
+			s.translog.appendLeaf(types.LeafHash(types.LogLeaf(entry.Flow, entry.Epoch, entry.Version, entry.Commitment)))
+		}
+	}
+}
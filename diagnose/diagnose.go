@@ -0,0 +1,286 @@
+// Package diagnose explains why a path failed verification. It locates every received opening on
+// the intended route, by the position whose value it opens to, and compares the observed order
+// with the route entered at setup: a hop verifying its predecessor gets one finding, an egress or
+// collector holding the whole chain gets every divergence and the first divergent position.
+package diagnose
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"strings"
+
+	"example.com/kzg-demo/types"
+	gozkg "github.com/protolambda/go-kzg"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+type Kind int
+
+const (
+	OK              Kind = iota
+	SkippedHop           // an intended hop left no proof
+	InsertedNode         // a node off the route proved something that opens to no position
+	ReorderedHops        // hops of the route were visited out of order
+	WrongCommitment      // a route node proved against another commitment, e.g., a stale version
+	ReplayedProof        // a valid opening that belongs to another packet or was already seen
+)
+
+func (k Kind) String() string {
+	switch k {
+	case OK:
+		return "ok"
+	case SkippedHop:
+		return "skipped hop"
+	case InsertedNode:
+		return "inserted node"
+	case ReorderedHops:
+		return "reordered hops"
+	case WrongCommitment:
+		return "wrong commitment"
+	case ReplayedProof:
+		return "replayed proof"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Route is the intended route as committed at setup.
+type Route struct {
+	Nodes      []string // node names, in route order
+	Ys         []bls.Fr // value committed for every position: 1..n or position labels
+	Commitment *bls.G1Point
+	Settings   *gozkg.KZGSettings
+	Keys       map[string]ed25519.PublicKey // hop keys of the route nodes, needed for the chain link checks
+}
+
+// bound reports whether the proof at a position of the route is bound to the packet by the node
+// the route commits there.
+func (route *Route) bound(position int, proof *types.Proof, packetDigest []byte) bool {
+	return proof.CheckLink(route.Keys[route.Nodes[position-1]], packetDigest)
+}
+
+// Finding is one divergence from the intended route.
+type Finding struct {
+	Kind     Kind
+	Hop      int    // observed hop, from 1; 0 for hops that never showed up, or in DiagnoseHop
+	Position int    // first affected position of the intended route, from 1
+	Expected string // node intended at Position
+	Node     string // node observed at Hop
+	Detail   string
+}
+
+func (f Finding) String() string {
+	var b strings.Builder
+	b.WriteString(f.Kind.String())
+	if f.Position > 0 {
+		fmt.Fprintf(&b, " at position %v", f.Position)
+		if f.Expected != "" {
+			fmt.Fprintf(&b, " (expected %v)", f.Expected)
+		}
+	}
+	if f.Hop > 0 {
+		fmt.Fprintf(&b, ", hop %v was %v", f.Hop, f.Node)
+	} else if f.Node != "" {
+		fmt.Fprintf(&b, ", got %v", f.Node)
+	}
+	if f.Detail != "" {
+		b.WriteString(": ")
+		b.WriteString(f.Detail)
+	}
+	return b.String()
+}
+
+// Report collects the findings of a whole path.
+type Report struct {
+	Findings []Finding
+	// FirstDivergence is the first position of the intended route where the path diverged,
+	// from 1; 0 if it followed the route.
+	FirstDivergence int
+}
+
+func (r *Report) OK() bool {
+	return len(r.Findings) == 0
+}
+
+func (r *Report) String() string {
+	if r.OK() {
+		return "the path followed the intended route"
+	}
+	lines := []string{fmt.Sprintf("the path diverged from the intended route at position %v:", r.FirstDivergence)}
+	for _, finding := range r.Findings {
+		lines = append(lines, "  "+finding.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// locate returns the position, from 1, that the opening proves against the commitment, trying
+// the claimed value first; 0 if it opens to none.
+func locate(route *Route, proof *types.Proof) int {
+	if proof.Proof == nil {
+		return 0
+	}
+	var x, claimed bls.Fr
+	if err := types.FrFromString(&x, proof.X); err != nil {
+		return 0
+	}
+	if err := types.FrFromString(&claimed, proof.Y); err == nil {
+		for i := range route.Ys {
+			if bls.EqualFr(&claimed, &route.Ys[i]) {
+				if route.Settings.CheckProofSingle(route.Commitment, proof.Proof, &x, &route.Ys[i]) {
+					return i + 1
+				}
+				break
+			}
+		}
+	}
+	for i := range route.Ys {
+		if route.Settings.CheckProofSingle(route.Commitment, proof.Proof, &x, &route.Ys[i]) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// visits counts the visits of a node on the intended route.
+func (route *Route) visits(node string) int {
+	n := 0
+	for _, name := range route.Nodes {
+		if name == node {
+			n++
+		}
+	}
+	return n
+}
+
+func (route *Route) expected(position int) string {
+	if position < 1 || position > len(route.Nodes) {
+		return ""
+	}
+	return route.Nodes[position-1]
+}
+
+// unlocated classifies an opening that proves no position of the route; visited counts the
+// earlier hops of the same node.
+func (route *Route) unlocated(hop int, position int, proof *types.Proof, visited int) Finding {
+	if n := route.visits(proof.Node); n > 0 && visited >= n {
+		return Finding{Kind: InsertedNode, Hop: hop, Position: position, Expected: route.expected(position), Node: proof.Node,
+			Detail: fmt.Sprintf("%v is on the route only %v time(s), this is an extra visit", proof.Node, n)}
+	} else if n > 0 {
+		return Finding{Kind: WrongCommitment, Hop: hop, Position: position, Expected: route.expected(position), Node: proof.Node,
+			Detail: fmt.Sprintf("%v is on the route, but its proof does not open this commitment", proof.Node)}
+	}
+	return Finding{Kind: InsertedNode, Hop: hop, Position: position, Expected: route.expected(position), Node: proof.Node,
+		Detail: fmt.Sprintf("%v is not on the route and its proof opens to no position", proof.Node)}
+}
+
+// DiagnoseHop explains a predecessor's proof to a verifier that expected the hop at position
+// expected, from 1. A nil packetDigest skips the chain link check.
+func DiagnoseHop(route *Route, expected int, proof *types.Proof, packetDigest []byte) Finding {
+	position := locate(route, proof)
+	if packetDigest != nil && position != 0 && !route.bound(position, proof, packetDigest) {
+		return Finding{Kind: ReplayedProof, Position: expected, Expected: route.expected(expected), Node: proof.Node,
+			Detail: fmt.Sprintf("the proof is not bound to this packet by %v", route.expected(position))}
+	}
+	switch {
+	case position == 0:
+		return route.unlocated(0, expected, proof, 0)
+	case position == expected:
+		return Finding{Kind: OK, Position: expected, Expected: route.expected(expected), Node: proof.Node}
+	case position < expected:
+		// a verifier off the route may expect a position past its end
+		skipped := route.Nodes[position:min(expected, len(route.Nodes))]
+		return Finding{Kind: SkippedHop, Position: position + 1, Expected: route.expected(position + 1), Node: proof.Node,
+			Detail: fmt.Sprintf("the proof is from position %v, so %v never proved", position, strings.Join(skipped, ", "))}
+	default:
+		return Finding{Kind: ReorderedHops, Position: expected, Expected: route.expected(expected), Node: proof.Node,
+			Detail: fmt.Sprintf("the proof is from position %v, later on the route", position)}
+	}
+}
+
+// Diagnose compares a whole chain of proofs, in the order the packet collected them, with the
+// intended route. A nil packetDigest skips the chain link checks.
+func Diagnose(route *Route, path []*types.Proof, packetDigest []byte) *Report {
+	positions := make([]int, len(path))
+	for i, proof := range path {
+		positions[i] = locate(route, proof)
+	}
+	later := func(i int, position int) bool {
+		for _, p := range positions[i+1:] {
+			if p == position {
+				return true
+			}
+		}
+		return false
+	}
+
+	report := &Report{}
+	next := 1                      // next intended position
+	seen := make(map[int]bool)     // positions proven so far
+	reported := make(map[int]bool) // positions already covered by a reorder finding
+	visited := make(map[string]int)
+	for i, proof := range path {
+		hop := i + 1
+		position := positions[i]
+		if packetDigest != nil && position != 0 && !route.bound(position, proof, packetDigest) {
+			report.Findings = append(report.Findings, Finding{Kind: ReplayedProof, Hop: hop, Position: position, Expected: route.expected(position), Node: proof.Node,
+				Detail: fmt.Sprintf("the opening is valid but not bound to this packet by %v", route.expected(position))})
+		}
+		switch {
+		case position == 0:
+			report.Findings = append(report.Findings, route.unlocated(hop, next, proof, visited[proof.Node]))
+		case seen[position]:
+			report.Findings = append(report.Findings, Finding{Kind: ReplayedProof, Hop: hop, Position: position, Expected: route.expected(position), Node: proof.Node,
+				Detail: fmt.Sprintf("position %v was already proven", position)})
+		case position == next:
+			next++
+		case position > next:
+			missing := make([]string, 0, position-next)
+			reordered := false
+			for p := next; p < position; p++ {
+				missing = append(missing, route.expected(p))
+				reordered = reordered || later(i, p)
+			}
+			if reordered {
+				report.Findings = append(report.Findings, Finding{Kind: ReorderedHops, Hop: hop, Position: next, Expected: route.expected(next), Node: proof.Node,
+					Detail: fmt.Sprintf("%v (position %v) came before %v", proof.Node, position, strings.Join(missing, ", "))})
+				for p := next; p < position; p++ {
+					reported[p] = true
+				}
+			} else {
+				report.Findings = append(report.Findings, Finding{Kind: SkippedHop, Hop: hop, Position: next, Expected: route.expected(next), Node: proof.Node,
+					Detail: fmt.Sprintf("%v never proved", strings.Join(missing, ", "))})
+			}
+			next = position + 1
+		default:
+			if !reported[position] {
+				report.Findings = append(report.Findings, Finding{Kind: ReorderedHops, Hop: hop, Position: position, Expected: route.expected(position), Node: proof.Node,
+					Detail: fmt.Sprintf("%v (position %v) came after position %v", proof.Node, position, next-1)})
+			}
+		}
+		if position != 0 {
+			seen[position] = true
+		}
+		visited[proof.Node]++
+	}
+
+	var missing []string
+	first := 0
+	for p := 1; p <= len(route.Nodes); p++ {
+		if !seen[p] && !reported[p] && p >= next {
+			missing = append(missing, route.expected(p))
+			if first == 0 {
+				first = p
+			}
+		}
+	}
+	if len(missing) > 0 {
+		report.Findings = append(report.Findings, Finding{Kind: SkippedHop, Position: first, Expected: route.expected(first),
+			Detail: fmt.Sprintf("the path ended before %v", strings.Join(missing, ", "))})
+	}
+
+	for _, finding := range report.Findings {
+		if report.FirstDivergence == 0 || finding.Position < report.FirstDivergence {
+			report.FirstDivergence = finding.Position
+		}
+	}
+	return report
+}
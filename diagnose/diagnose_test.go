@@ -0,0 +1,63 @@
+package diagnose
+
+import (
+	"testing"
+
+	"example.com/kzg-demo/kzgtest"
+	"example.com/kzg-demo/types"
+)
+
+// testRoute commits a route of the given length and returns it with an opening for every
+// position.
+func testRoute(t *testing.T, hops int, seed int64) (*Route, []*types.Proof) {
+	t.Helper()
+	f, err := kzgtest.NewFixture(hops, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := &Route{
+		Nodes:      f.Nodes,
+		Ys:         f.Ys(),
+		Commitment: f.Controller.Commit(),
+		Settings:   f.Controller.KzgSettings,
+	}
+	proofs := make([]*types.Proof, hops)
+	for i := range proofs {
+		proofs[i] = f.Open(i)
+	}
+	return route, proofs
+}
+
+func TestDiagnoseHopPastRouteEnd(t *testing.T) {
+	// intended ABC, real route DDDAE: E is off the route and expects its predecessor at the
+	// position its real index would have, past the end of the route
+	route, proofs := testRoute(t, 3, 1)
+	for _, expected := range []int{4, 5} {
+		finding := DiagnoseHop(route, expected, proofs[0], nil)
+		if finding.Kind != SkippedHop || finding.Position != 2 || finding.Expected != "B" {
+			t.Errorf("expected %v: got %v", expected, finding)
+		}
+	}
+}
+
+func TestDiagnoseHop(t *testing.T) {
+	for _, hops := range []int{3, 4, 6} {
+		route, proofs := testRoute(t, hops, int64(10+hops))
+		for i, proof := range proofs {
+			// the verifier after hop i expects it at position i+1
+			if finding := DiagnoseHop(route, i+1, proof, nil); finding.Kind != OK {
+				t.Errorf("%v hops: predecessor %v: got %v", hops, proof.Node, finding)
+			}
+			for expected := i + 2; expected <= hops; expected++ {
+				if finding := DiagnoseHop(route, expected, proof, nil); finding.Kind != SkippedHop {
+					t.Errorf("%v hops: %v where position %v was expected: got %v", hops, proof.Node, expected, finding)
+				}
+			}
+			for expected := 1; expected <= i; expected++ {
+				if finding := DiagnoseHop(route, expected, proof, nil); finding.Kind != ReorderedHops {
+					t.Errorf("%v hops: %v where position %v was expected: got %v", hops, proof.Node, expected, finding)
+				}
+			}
+		}
+	}
+}
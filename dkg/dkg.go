@@ -0,0 +1,199 @@
+// Package dkg lets the nodes of a route interpolate their path polynomial without disclosing their
+// secrets to the controller or to each other.
+//
+// Every value of the computation is Shamir-shared among the nodes with threshold t < n/2, and
+// products are computed BGW-style: parties multiply their shares locally and reshare the result,
+// so no trusted dealer is needed. The coefficients of the polynomial stay shared: they would give
+// away every secret as a root of P(X) - y. Only the commitment is opened, in the exponent, and
+// every hop receives its own opening; nodes otherwise see only shares and masked values. Once
+// packets flow, a proof carries its hop's secret as X, so the next hop learns it as before.
+//
+// The parties run in-process and talk through a Network that counts the traffic a deployment
+// would send. The controller service does not run the protocol: it still draws node secrets
+// itself.
+package dkg
+
+import (
+	"fmt"
+
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// Network simulates the point-to-point channels between the parties.
+type Network struct {
+	Parties   int
+	Threshold int
+	Messages  int // point-to-point messages sent
+	Rounds    int // communication rounds
+
+	points  []bls.Fr // evaluation point of every party's shares: 1..n
+	lambdas []bls.Fr // Lagrange coefficients at 0 over all points, for degree-reduction
+}
+
+// Shared is a secret-shared value; entry j is held by party j only.
+type Shared []bls.Fr
+
+// NewNetwork connects n parties. The threshold is the largest t with 2t < n, the most colluding
+// parties BGW multiplication tolerates.
+func NewNetwork(n int) (*Network, error) {
+	if n < 3 {
+		return nil, fmt.Errorf("secret-shared interpolation needs at least 3 parties, got %v", n)
+	}
+	net := &Network{Parties: n, Threshold: (n - 1) / 2, points: make([]bls.Fr, n), lambdas: make([]bls.Fr, n)}
+	for j := range net.points {
+		bls.AsFr(&net.points[j], uint64(j+1))
+	}
+	for j := range net.lambdas {
+		lagrangeAtZero(&net.lambdas[j], net.points, j)
+	}
+	return net, nil
+}
+
+// Share is run by the party dealer: it splits value with a random polynomial of degree Threshold
+// and sends one share to every party.
+func (net *Network) Share(dealer int, value *bls.Fr) Shared {
+	poly := make([]bls.Fr, net.Threshold+1)
+	bls.CopyFr(&poly[0], value)
+	for i := 1; i < len(poly); i++ {
+		bls.CopyFr(&poly[i], bls.RandomFr())
+	}
+	shares := make(Shared, net.Parties)
+	for j := range shares {
+		bls.EvalPolyAt(&shares[j], poly, &net.points[j])
+		if j != dealer {
+			net.Messages++
+		}
+	}
+	return shares
+}
+
+// Public turns a public constant into shares without communication.
+func (net *Network) Public(value *bls.Fr) Shared {
+	shares := make(Shared, net.Parties)
+	for j := range shares {
+		bls.CopyFr(&shares[j], value)
+	}
+	return shares
+}
+
+func (net *Network) Add(a, b Shared) Shared {
+	out := make(Shared, net.Parties)
+	for j := range out {
+		bls.AddModFr(&out[j], &a[j], &b[j])
+	}
+	return out
+}
+
+func (net *Network) Sub(a, b Shared) Shared {
+	out := make(Shared, net.Parties)
+	for j := range out {
+		bls.SubModFr(&out[j], &a[j], &b[j])
+	}
+	return out
+}
+
+// Scale multiplies a shared value by a public constant.
+func (net *Network) Scale(a Shared, c *bls.Fr) Shared {
+	out := make(Shared, net.Parties)
+	for j := range out {
+		bls.MulModFr(&out[j], &a[j], c)
+	}
+	return out
+}
+
+// Mul multiplies two shared values: the local products lie on a polynomial of degree 2t, so every
+// party reshares its product and combines the shares it receives with the Lagrange coefficients.
+func (net *Network) Mul(a, b Shared) Shared {
+	return net.MulBatch([]Shared{a}, []Shared{b})[0]
+}
+
+// MulBatch runs independent multiplications in one round.
+func (net *Network) MulBatch(a, b []Shared) []Shared {
+	net.Rounds++
+	out := make([]Shared, len(a))
+	for k := range a {
+		out[k] = make(Shared, net.Parties)
+		for dealer := 0; dealer < net.Parties; dealer++ {
+			var product bls.Fr
+			bls.MulModFr(&product, &a[k][dealer], &b[k][dealer])
+			reshared := net.Share(dealer, &product)
+			for j := range out[k] {
+				var term bls.Fr
+				bls.MulModFr(&term, &reshared[j], &net.lambdas[dealer])
+				bls.AddModFr(&out[k][j], &out[k][j], &term)
+			}
+		}
+	}
+	return out
+}
+
+// Random is a shared value nobody knows: the sum of one random contribution per party.
+func (net *Network) Random() Shared {
+	net.Rounds++
+	out := net.Public(&bls.ZERO)
+	for dealer := 0; dealer < net.Parties; dealer++ {
+		out = net.Add(out, net.Share(dealer, bls.RandomFr()))
+	}
+	return out
+}
+
+// Open reveals a shared value to all parties.
+func (net *Network) Open(a Shared) *bls.Fr {
+	net.Rounds++
+	net.Messages += net.Parties * (net.Parties - 1)
+	value := new(bls.Fr)
+	for j := range a {
+		var term bls.Fr
+		bls.MulModFr(&term, &a[j], &net.lambdas[j])
+		bls.AddModFr(value, value, &term)
+	}
+	return value
+}
+
+// Inverse computes 1/a without revealing a: the parties open a*r for a random shared r, which is
+// uniformly distributed, invert it in the clear and multiply by r.
+func (net *Network) Inverse(a Shared) (Shared, error) {
+	r := net.Random()
+	masked := net.Open(net.Mul(a, r))
+	if bls.EqualZero(masked) {
+		return nil, fmt.Errorf("cannot invert zero")
+	}
+	var inverse bls.Fr
+	bls.InvModFr(&inverse, masked)
+	return net.Scale(r, &inverse), nil
+}
+
+// OpenG1 reveals sum_m values[m] * basis[m] to one receiver, without revealing the values: every
+// party combines its own shares locally and sends the resulting point to the receiver, who
+// interpolates the points at 0 in the exponent.
+func (net *Network) OpenG1(values []Shared, basis []bls.G1Point) (*bls.G1Point, error) {
+	if len(values) > len(basis) {
+		return nil, fmt.Errorf("%v values for %v basis points", len(values), len(basis))
+	}
+	net.Rounds++
+	net.Messages += net.Parties
+	points := make([]bls.G1Point, net.Parties)
+	for j := range points {
+		shares := make([]bls.Fr, len(values))
+		for m := range values {
+			bls.CopyFr(&shares[m], &values[m][j])
+		}
+		bls.CopyG1(&points[j], bls.LinCombG1(basis[:len(values)], shares))
+	}
+	return bls.LinCombG1(points, net.lambdas), nil
+}
+
+// lagrangeAtZero sets dst to prod_{k != j} points[k] / (points[k] - points[j]).
+func lagrangeAtZero(dst *bls.Fr, points []bls.Fr, j int) {
+	num, den := bls.ONE, bls.ONE
+	for k := range points {
+		if k == j {
+			continue
+		}
+		var diff bls.Fr
+		bls.MulModFr(&num, &num, &points[k])
+		bls.SubModFr(&diff, &points[k], &points[j])
+		bls.MulModFr(&den, &den, &diff)
+	}
+	bls.DivModFr(dst, &num, &den)
+}
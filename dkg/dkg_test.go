@@ -0,0 +1,65 @@
+package dkg_test
+
+import (
+	"testing"
+
+	"example.com/kzg-demo/dkg"
+	"example.com/kzg-demo/kzgtest"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+func TestInterpolateMatchesSetup(t *testing.T) {
+	for _, hops := range []int{3, 4, 7} {
+		f, err := kzgtest.NewFixture(hops, int64(39+hops))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ys := f.Ys()
+
+		net, err := dkg.NewNetwork(hops)
+		if err != nil {
+			t.Fatal(err)
+		}
+		route, err := dkg.Interpolate(net, f.Secrets, ys)
+		if err != nil {
+			t.Fatalf("%v hops: %v", hops, err)
+		}
+		ks := f.Controller.KzgSettings
+		commitment, err := route.Commit(ks.SecretG1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bls.EqualG1(commitment, f.Controller.Commit()) {
+			t.Fatalf("%v hops: shared commitment differs from Controller.Setup", hops)
+		}
+
+		openings, err := route.Openings(ks.SecretG1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, secret := range f.Secrets {
+			if !bls.EqualG1(openings[i], ks.ComputeProofSingle(f.Controller.Polynomial, secret)) {
+				t.Errorf("%v hops: opening of hop %v differs from the plaintext one", hops, i)
+			}
+			var x bls.Fr
+			bls.AsFr(&x, secret)
+			if !ks.CheckProofSingle(commitment, openings[i], &x, &ys[i]) {
+				t.Errorf("%v hops: opening of hop %v does not verify", hops, i)
+			}
+		}
+	}
+}
+
+func TestInterpolateRejectsDuplicateSecrets(t *testing.T) {
+	net, err := dkg.NewNetwork(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ys := make([]bls.Fr, 3)
+	for i := range ys {
+		bls.AsFr(&ys[i], uint64(i+1))
+	}
+	if _, err := dkg.Interpolate(net, []uint64{5, 6, 5}, ys); err == nil {
+		t.Error("duplicate secrets were interpolated")
+	}
+}
@@ -0,0 +1,182 @@
+package dkg
+
+import (
+	"fmt"
+
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// Route is the polynomial of a route with its coefficients and hop secrets still shared among the
+// route nodes.
+type Route struct {
+	net          *Network
+	xs           []Shared
+	coefficients []Shared
+}
+
+// Interpolate computes the coefficients of the polynomial through (x_i, ys[i]) for the hops of a
+// route, where x_i is the secret of hop i and is passed to party i only. The ys are public:
+// positions 1..n or position labels. The coefficients are not opened, see Commit and Openings.
+//
+// The Lagrange form sum_i ys[i] * (Z(X) / (X - x_i)) / Z'(x_i), with Z(X) = prod (X - x_i), is
+// evaluated on shares: Z and the quotients take one multiplication round per hop, the
+// denominators are inverted with masked openings, and the final sum is one more round.
+func Interpolate(net *Network, secrets []uint64, ys []bls.Fr) (*Route, error) {
+	n := len(secrets)
+	if n != net.Parties || n != len(ys) {
+		return nil, fmt.Errorf("%v secrets and %v values for %v parties", n, len(ys), net.Parties)
+	}
+
+	// every node shares its own secret
+	xs := make([]Shared, n)
+	for i, secret := range secrets {
+		var x bls.Fr
+		bls.AsFr(&x, secret)
+		xs[i] = net.Share(i, &x)
+	}
+
+	// Z(X) = prod (X - x_i), one factor per round
+	z := []Shared{net.Public(&bls.ONE)}
+	for _, x := range xs {
+		products := net.MulBatch(z, repeat(x, len(z)))
+		next := make([]Shared, len(z)+1)
+		next[0] = net.Public(&bls.ZERO)
+		for j := range z {
+			next[j+1] = z[j]
+			next[j] = net.Sub(next[j], products[j])
+		}
+		z = next
+	}
+
+	// q_i(X) = Z(X) / (X - x_i) by synthetic division, all hops in the same rounds
+	quotients := make([][]Shared, n)
+	for i := range quotients {
+		quotients[i] = make([]Shared, n)
+		quotients[i][n-1] = z[n]
+	}
+	for m := n - 1; m > 0; m-- {
+		a := make([]Shared, n)
+		for i := range a {
+			a[i] = quotients[i][m]
+		}
+		products := net.MulBatch(a, xs)
+		for i := range quotients {
+			quotients[i][m-1] = net.Add(z[m], products[i])
+		}
+	}
+
+	// Z'(x_i) = prod_{j != i} (x_i - x_j)
+	denominators := make([]Shared, n)
+	for i := range denominators {
+		denominators[i] = net.Public(&bls.ONE)
+	}
+	for step := 1; step < n; step++ {
+		diffs := make([]Shared, n)
+		for i := range diffs {
+			diffs[i] = net.Sub(xs[i], xs[(i+step)%n])
+		}
+		denominators = net.MulBatch(denominators, diffs)
+	}
+	inverses, err := net.InverseBatch(denominators)
+	if err != nil {
+		return nil, fmt.Errorf("hop secrets must be unique: %w", err)
+	}
+
+	// P(X) = sum_i ys[i] / Z'(x_i) * q_i(X)
+	a := make([]Shared, 0, n*n)
+	b := make([]Shared, 0, n*n)
+	for i := range quotients {
+		weight := net.Scale(inverses[i], &ys[i])
+		for m := range quotients[i] {
+			a = append(a, weight)
+			b = append(b, quotients[i][m])
+		}
+	}
+	products := net.MulBatch(a, b)
+	coefficients := make([]Shared, n)
+	for m := range coefficients {
+		coefficients[m] = net.Public(&bls.ZERO)
+		for i := 0; i < n; i++ {
+			coefficients[m] = net.Add(coefficients[m], products[i*n+m])
+		}
+	}
+
+	return &Route{net: net, xs: xs, coefficients: coefficients}, nil
+}
+
+// Commit opens the commitment to the route polynomial under the setup points [s^m], e.g., to the
+// controller, which signs and distributes it.
+func (r *Route) Commit(setup []bls.G1Point) (*bls.G1Point, error) {
+	return r.net.OpenG1(r.coefficients, setup)
+}
+
+// Openings computes the opening of every hop at its secret, [(P(X) - y_i) / (X - x_i)](s), and
+// opens it to that hop only. The quotients are divided out on shares, one multiplication round
+// per coefficient for all hops at once.
+func (r *Route) Openings(setup []bls.G1Point) ([]*bls.G1Point, error) {
+	n := len(r.coefficients)
+	quotients := make([][]Shared, len(r.xs))
+	for i := range quotients {
+		quotients[i] = make([]Shared, n-1)
+		quotients[i][n-2] = r.coefficients[n-1]
+	}
+	for m := n - 2; m > 0; m-- {
+		a := make([]Shared, len(r.xs))
+		for i := range a {
+			a[i] = quotients[i][m]
+		}
+		products := r.net.MulBatch(a, r.xs)
+		for i := range quotients {
+			quotients[i][m-1] = r.net.Add(r.coefficients[m], products[i])
+		}
+	}
+
+	openings := make([]*bls.G1Point, len(r.xs))
+	for i := range openings {
+		opening, err := r.net.OpenG1(quotients[i], setup)
+		if err != nil {
+			return nil, err
+		}
+		openings[i] = opening
+	}
+	r.net.Rounds -= len(openings) - 1
+	return openings, nil
+}
+
+// InverseBatch inverts several shared values in the rounds of one inversion.
+func (net *Network) InverseBatch(values []Shared) ([]Shared, error) {
+	masks := make([]Shared, len(values))
+	for i := range masks {
+		masks[i] = net.Random()
+	}
+	net.Rounds -= len(masks) - 1
+	masked := net.OpenBatch(net.MulBatch(values, masks))
+	inverses := make([]Shared, len(values))
+	for i := range masked {
+		if bls.EqualZero(&masked[i]) {
+			return nil, fmt.Errorf("cannot invert zero")
+		}
+		var inverse bls.Fr
+		bls.InvModFr(&inverse, &masked[i])
+		inverses[i] = net.Scale(masks[i], &inverse)
+	}
+	return inverses, nil
+}
+
+// OpenBatch reveals several shared values in one round.
+func (net *Network) OpenBatch(values []Shared) []bls.Fr {
+	out := make([]bls.Fr, len(values))
+	for i := range values {
+		bls.CopyFr(&out[i], net.Open(values[i]))
+	}
+	net.Rounds -= len(values) - 1
+	return out
+}
+
+func repeat(s Shared, n int) []Shared {
+	out := make([]Shared, n)
+	for i := range out {
+		out[i] = s
+	}
+	return out
+}
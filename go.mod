@@ -4,8 +4,10 @@ go 1.21.0
 
 require (
 	github.com/SadPencil/go-lagrange-interpolation v0.0.0-20230827172720-9514a96e3fe6
+	github.com/kilic/bls12-381 v0.1.1-0.20220929213557-ca162e8a70f4
 	github.com/pkg/profile v1.7.0
 	github.com/protolambda/go-kzg v0.0.0-20221224134646-c91cee5e954e
+	golang.org/x/crypto v0.21.0
 )
 
 require (
@@ -13,6 +15,5 @@ require (
 	github.com/google/pprof v0.0.0-20211214055906-6f57359322fd // indirect
 	github.com/herumi/bls-eth-go-binary v1.28.1 // indirect
 	github.com/holiman/uint256 v1.2.1 // indirect
-	github.com/kilic/bls12-381 v0.1.1-0.20220929213557-ca162e8a70f4 // indirect
-	golang.org/x/sys v0.0.0-20220818161305-2296e01440c6 // indirect
+	golang.org/x/sys v0.18.0 // indirect
 )
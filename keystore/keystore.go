@@ -0,0 +1,170 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"example.com/kzg-demo/utils"
+	"golang.org/x/crypto/scrypt"
+)
+
+const Redacted = "<redacted>"
+
+const (
+	formatVersion = 1
+	kdfScrypt     = "scrypt"
+	keyLen        = 32 // AES-256
+	saltLen       = 16
+)
+
+// scrypt cost parameters, as recommended for interactive logins in 2017
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var ErrDecrypt = errors.New("keystore: wrong passphrase or corrupted data")
+
+type envelope struct {
+	Version    int
+	KDF        string
+	N          int
+	R          int
+	P          int
+	Salt       []byte
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+// Seal encrypts plaintext with AES-256-GCM under a key derived from the passphrase with scrypt.
+// The KDF parameters are stored alongside the ciphertext and authenticated as associated data.
+func Seal(passphrase []byte, plaintext []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("keystore: empty passphrase")
+	}
+
+	env := envelope{
+		Version: formatVersion,
+		KDF:     kdfScrypt,
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    make([]byte, saltLen),
+	}
+	if _, err := rand.Read(env.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(passphrase, &env)
+	if err != nil {
+		return nil, err
+	}
+	env.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(env.Nonce); err != nil {
+		return nil, err
+	}
+	env.Ciphertext = aead.Seal(nil, env.Nonce, plaintext, associatedData(&env))
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// Open reverses Seal.
+func Open(passphrase []byte, sealed []byte) ([]byte, error) {
+	var env envelope
+	if err := json.Unmarshal(sealed, &env); err != nil {
+		return nil, fmt.Errorf("keystore: malformed envelope: %w", err)
+	}
+	if env.Version != formatVersion || env.KDF != kdfScrypt {
+		return nil, fmt.Errorf("keystore: unsupported envelope version %v (%v)", env.Version, env.KDF)
+	}
+	// the parameters are only authenticated after the key is derived, so anything but what Seal
+	// writes is refused before scrypt runs
+	if env.N != scryptN || env.R != scryptR || env.P != scryptP || len(env.Salt) != saltLen {
+		return nil, fmt.Errorf("keystore: unsupported scrypt parameters N=%v r=%v p=%v", env.N, env.R, env.P)
+	}
+
+	aead, err := newAEAD(passphrase, &env)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, associatedData(&env))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// IsSealed reports whether data looks like the output of Seal.
+func IsSealed(data []byte) bool {
+	var env envelope
+	return json.Unmarshal(data, &env) == nil && env.KDF == kdfScrypt && len(env.Ciphertext) > 0
+}
+
+func newAEAD(passphrase []byte, env *envelope) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, env.Salt, env.N, env.R, env.P, keyLen)
+	if err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func associatedData(env *envelope) []byte {
+	return []byte(fmt.Sprintf("vcpot-keystore/v%v/%v/%v/%v/%v/%x", env.Version, env.KDF, env.N, env.R, env.P, env.Salt))
+}
+
+// Keystore stores a JSON value encrypted at rest in a single file.
+type Keystore struct {
+	Path       string
+	passphrase []byte
+}
+
+func New(path string, passphrase []byte) *Keystore {
+	return &Keystore{Path: path, passphrase: passphrase}
+}
+
+// PassphraseFromEnv reads a passphrase from an environment variable, so it never shows up in
+// the process list or shell history.
+func PassphraseFromEnv(name string) ([]byte, error) {
+	passphrase := os.Getenv(name)
+	if passphrase == "" {
+		return nil, fmt.Errorf("environment variable %v is not set", name)
+	}
+	return []byte(passphrase), nil
+}
+
+func (k *Keystore) Save(v any) error {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	sealed, err := Seal(k.passphrase, plaintext)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(k.Path, sealed)
+}
+
+// Load decrypts the file into v. A missing file is reported as os.ErrNotExist.
+func (k *Keystore) Load(v any) error {
+	sealed, err := os.ReadFile(k.Path)
+	if err != nil {
+		return err
+	}
+	plaintext, err := Open(k.passphrase, sealed)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plaintext, v)
+}
@@ -0,0 +1,96 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	plaintext := []byte(`{"Secret":1234}`)
+	sealed, err := Seal([]byte("passphrase"), plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Fatal("sealed data contains the plaintext")
+	}
+	opened, err := Open([]byte("passphrase"), sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Fatalf("got %q, want %q", opened, plaintext)
+	}
+	if _, err := Open([]byte("wrong"), sealed); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("wrong passphrase: got %v, want ErrDecrypt", err)
+	}
+	if _, err := Seal(nil, plaintext); err == nil {
+		t.Error("sealed with an empty passphrase")
+	}
+}
+
+func TestOpenRefusesTampering(t *testing.T) {
+	sealed, err := Seal([]byte("passphrase"), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		tamper func(env *envelope)
+		want   error // nil for any error
+	}{
+		{"ciphertext", func(env *envelope) { env.Ciphertext[0] ^= 1 }, ErrDecrypt},
+		{"nonce", func(env *envelope) { env.Nonce[0] ^= 1 }, ErrDecrypt},
+		{"salt", func(env *envelope) { env.Salt[0] ^= 1 }, ErrDecrypt},
+		{"short nonce", func(env *envelope) { env.Nonce = env.Nonce[:4] }, ErrDecrypt},
+		{"version", func(env *envelope) { env.Version = 2 }, nil},
+		{"kdf", func(env *envelope) { env.KDF = "argon2id" }, nil},
+		{"huge N", func(env *envelope) { env.N = 1 << 40 }, nil},
+		{"smaller N", func(env *envelope) { env.N = 1 << 10 }, nil},
+		{"huge r", func(env *envelope) { env.R = 1 << 20 }, nil},
+		{"huge p", func(env *envelope) { env.P = 1 << 20 }, nil},
+		{"short salt", func(env *envelope) { env.Salt = env.Salt[:1] }, nil},
+	}
+	for _, test := range tests {
+		var env envelope
+		if err := json.Unmarshal(sealed, &env); err != nil {
+			t.Fatal(err)
+		}
+		test.tamper(&env)
+		tampered, err := json.Marshal(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Open([]byte("passphrase"), tampered)
+		if err == nil || (test.want != nil && !errors.Is(err, test.want)) {
+			t.Errorf("%v: got %v", test.name, err)
+		}
+	}
+	if _, err := Open([]byte("passphrase"), []byte("not json")); err == nil {
+		t.Error("opened a malformed envelope")
+	}
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	type state struct {
+		Secrets map[string]uint64
+	}
+	saved := state{Secrets: map[string]uint64{"A": 1234, "B": 56789}}
+	if err := New(path, []byte("passphrase")).Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	var loaded state
+	if err := New(path, []byte("passphrase")).Load(&loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Secrets["A"] != 1234 || loaded.Secrets["B"] != 56789 {
+		t.Errorf("loaded %v", loaded)
+	}
+	if err := New(path, []byte("wrong")).Load(&loaded); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("wrong passphrase: got %v", err)
+	}
+}
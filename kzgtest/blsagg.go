@@ -0,0 +1,87 @@
+package kzgtest
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"example.com/kzg-demo/pot"
+	"example.com/kzg-demo/utils"
+	bls12381 "github.com/kilic/bls12-381"
+)
+
+// RunBLS measures BLS aggregate-signature proof-of-transit on a route of n hops, in the same
+// format as Run.
+func RunBLS(n int) {
+	var startTime time.Time
+	var duration time.Duration
+
+	nodesCount := max(n, 3)
+	fmt.Printf("[n=%v] begin bls setup\n", nodesCount)
+
+	startTime = time.Now()
+	keys := make([]*pot.BLSKey, nodesCount)
+	route := &pot.BLSRoute{FlowID: "bench", Keys: make([]*bls12381.PointG2, nodesCount)}
+	for i := range keys {
+		key, err := pot.NewBLSKey()
+		if err != nil {
+			panic(err)
+		}
+		keys[i] = key
+		route.Keys[i] = key.Public
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] setup %v\n", nodesCount, duration)
+
+	packet := make([]byte, 1500)
+	if _, err := rand.Read(packet); err != nil {
+		panic(err)
+	}
+	header := pot.NewBLSHeader(packet)
+
+	startTime = time.Now()
+	for i, key := range keys {
+		if err := key.Sign(route.FlowID, i, header); err != nil {
+			panic(err)
+		}
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] prove %v\n", nodesCount, utils.DurationDivideBy(duration, nodesCount))
+
+	startTime = time.Now()
+	verified, err := route.Verify(header)
+	if err != nil {
+		panic(err)
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] verify %v (%v)\n", nodesCount, duration, verified)
+
+	// a per-hop check of the predecessors grows with the position, unlike a KZG check
+	startTime = time.Now()
+	if _, err := route.VerifyPrefix(header, nodesCount/2); err != nil {
+		panic(err)
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] verify prefix of %v hops %v\n", nodesCount, nodesCount/2, duration)
+
+	// swapping two hops must not verify
+	swapped := pot.NewBLSHeader(packet)
+	for i := range keys {
+		j := i
+		if i == 0 || i == 1 {
+			j = 1 - i
+		}
+		if err := keys[j].Sign(route.FlowID, i, swapped); err != nil {
+			panic(err)
+		}
+	}
+	swappedVerified, err := route.Verify(swapped)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("[n=%v] swapped hops rejected: %v\n", nodesCount, !swappedVerified)
+
+	fmt.Printf("[n=%v] header %v bytes\n", nodesCount, pot.BLSHeaderSize)
+
+	fmt.Printf("done\n")
+}
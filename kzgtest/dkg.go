@@ -0,0 +1,79 @@
+package kzgtest
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"example.com/kzg-demo/dkg"
+	"example.com/kzg-demo/types"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// RunDKG interpolates a route of n hops among in-process parties, opens only the commitment and
+// every hop's opening, and checks them against a Controller.Setup that was given the secrets in
+// plaintext.
+func RunDKG(n int) {
+	var startTime time.Time
+	var duration time.Duration
+
+	nodesCount := max(n, 3)
+	fmt.Printf("[n=%v] begin dkg\n", nodesCount)
+
+	secrets := make([]uint64, 0, nodesCount)
+	nodesPrivateData := make([]uint32, 0, nodesCount)
+	used := make(map[uint64]bool)
+	for len(secrets) < nodesCount {
+		data := uint64(rand.Int31())
+		if !used[data] {
+			used[data] = true
+			secrets = append(secrets, data)
+			nodesPrivateData = append(nodesPrivateData, uint32(data))
+		}
+	}
+	controller := types.Controller{}
+	ys := make([]bls.Fr, nodesCount)
+	for i := range ys {
+		bls.CopyFr(&ys[i], controller.Position(i))
+	}
+	ks := types.NewKzgSettings(nodesCount)
+
+	net, err := dkg.NewNetwork(nodesCount)
+	if err != nil {
+		panic(err)
+	}
+	startTime = time.Now()
+	route, err := dkg.Interpolate(net, secrets, ys)
+	if err != nil {
+		panic(err)
+	}
+	commitment, err := route.Commit(ks.SecretG1)
+	if err != nil {
+		panic(err)
+	}
+	openings, err := route.Openings(ks.SecretG1)
+	if err != nil {
+		panic(err)
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] interpolate, commit and open %v, %v rounds, %v messages, tolerates %v colluding nodes\n",
+		nodesCount, duration, net.Rounds, net.Messages, net.Threshold)
+
+	// every node checks the opening it received against the commitment
+	verified := true
+	for i, secret := range secrets {
+		var x bls.Fr
+		bls.AsFr(&x, secret)
+		verified = ks.CheckProofSingle(commitment, openings[i], &x, &ys[i]) && verified
+	}
+	fmt.Printf("[n=%v] all hops verify: %v\n", nodesCount, verified)
+
+	startTime = time.Now()
+	if _, _, err := controller.Setup(nodesPrivateData); err != nil {
+		panic(err)
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] plaintext setup %v, same commitment: %v\n", nodesCount, duration, bls.EqualG1(commitment, controller.Commit()))
+
+	fmt.Printf("done\n")
+}
@@ -0,0 +1,95 @@
+package kzgtest
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"math/rand"
+
+	"example.com/kzg-demo/types"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// Fixture is a route committed with Controller.Setup and the opening of every hop, for the
+// package tests. Each test draws its own, so they do not all exercise one route.
+type Fixture struct {
+	Controller *types.Controller
+	Nodes      []string // A, B, C, ... in route order
+	Secrets    []uint64
+	HopKeys    []ed25519.PrivateKey
+	Public     []ed25519.PublicKey
+}
+
+// NewFixture commits a route of n hops to distinct secrets drawn from seed, and draws a fresh hop
+// key for every hop.
+func NewFixture(n int, seed int64) (*Fixture, error) {
+	if n < 1 || n > 26 {
+		return nil, fmt.Errorf("route of %v hops, want 1 to 26", n)
+	}
+	r := rand.New(rand.NewSource(seed))
+	f := &Fixture{
+		Controller: &types.Controller{},
+		Nodes:      make([]string, n),
+		Secrets:    make([]uint64, n),
+		HopKeys:    make([]ed25519.PrivateKey, n),
+		Public:     make([]ed25519.PublicKey, n),
+	}
+	data := make([]uint32, 0, n)
+	used := make(map[uint32]bool)
+	for len(data) < n {
+		// secrets clear of the positions 1..n, which the polynomial evaluates to
+		secret := uint32(r.Int31n(1<<30)) + uint32(n) + 1
+		if !used[secret] {
+			used[secret] = true
+			data = append(data, secret)
+		}
+	}
+	if _, _, err := f.Controller.Setup(data); err != nil {
+		return nil, err
+	}
+	for i := range f.Nodes {
+		f.Nodes[i] = string(rune('A' + i))
+		f.Secrets[i] = uint64(data[i])
+		var err error
+		if f.Public[i], f.HopKeys[i], err = ed25519.GenerateKey(nil); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// Open returns the unbound opening of hop i, made by the node at that hop.
+func (f *Fixture) Open(i int) *types.Proof {
+	var x bls.Fr
+	bls.AsFr(&x, f.Secrets[i])
+	c := f.Controller
+	return &types.Proof{
+		FlowID: "f",
+		Node:   f.Nodes[i],
+		X:      x.String(),
+		Y:      c.Position(i).String(),
+		Proof:  c.KzgSettings.ComputeProofSingle(c.Polynomial, f.Secrets[i]),
+		Seq:    1,
+	}
+}
+
+// Chain opens every hop for one packet and binds each opening to the previous one with its hop's
+// key, as the nodes of the route do.
+func (f *Fixture) Chain(packetDigest []byte) []*types.Proof {
+	var prev []byte
+	proofs := make([]*types.Proof, len(f.Nodes))
+	for i := range proofs {
+		proofs[i] = f.Open(i)
+		proofs[i].Bind(f.HopKeys[i], prev, packetDigest)
+		prev = proofs[i].Chain
+	}
+	return proofs
+}
+
+// Ys returns the evaluation target of every hop.
+func (f *Fixture) Ys() []bls.Fr {
+	ys := make([]bls.Fr, len(f.Nodes))
+	for i := range ys {
+		bls.CopyFr(&ys[i], f.Controller.Position(i))
+	}
+	return ys
+}
@@ -0,0 +1,83 @@
+package kzgtest
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"example.com/kzg-demo/types"
+	"example.com/kzg-demo/utils"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// RunIPA commits the same route polynomial as Run with the transparent IPA backend and measures
+// setup, prove and verify time and the proof size, in the same format as Run.
+func RunIPA(n int) {
+	var startTime time.Time
+	var duration time.Duration
+
+	nodesCount := max(n, 3)
+	fmt.Printf("[n=%v] begin ipa setup\n", nodesCount)
+
+	controller := types.Controller{}
+	nodesPrivateData := make([]uint32, 0, nodesCount)
+	used := make(map[uint32]bool)
+	for len(nodesPrivateData) < nodesCount {
+		data := uint32(rand.Int31())
+		if !used[data] {
+			used[data] = true
+			nodesPrivateData = append(nodesPrivateData, data)
+		}
+	}
+	if _, _, err := controller.Setup(nodesPrivateData); err != nil {
+		panic(err)
+	}
+
+	// generators only, no trusted party
+	startTime = time.Now()
+	settings, err := types.NewIPASettings(len(controller.Polynomial))
+	if err != nil {
+		panic(err)
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] setup %v\n", nodesCount, duration)
+
+	startTime = time.Now()
+	commitment, err := settings.Commit(controller.Polynomial)
+	if err != nil {
+		panic(err)
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] commit %v\n", nodesCount, duration)
+
+	xs := make([]bls.Fr, nodesCount)
+	for i, data := range nodesPrivateData {
+		bls.AsFr(&xs[i], uint64(data))
+	}
+
+	proofs := make([]*types.IPAProof, nodesCount)
+	startTime = time.Now()
+	for i := range proofs {
+		proofs[i], err = settings.Open(controller.Polynomial, commitment, &xs[i])
+		if err != nil {
+			panic(err)
+		}
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] prove %v\n", nodesCount, utils.DurationDivideBy(duration, nodesCount))
+
+	verified := true
+	startTime = time.Now()
+	for i := range proofs {
+		verified = settings.Verify(commitment, proofs[i], &xs[i], controller.Position(i)) && verified
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] verify %v (%v)\n", nodesCount, utils.DurationDivideBy(duration, nodesCount), verified)
+
+	// a proof replayed at the wrong position must not verify
+	fmt.Printf("[n=%v] wrong position rejected: %v\n", nodesCount, !settings.Verify(commitment, proofs[0], &xs[0], controller.Position(1)))
+
+	fmt.Printf("[n=%v] proof %v bytes (kzg: 48)\n", nodesCount, proofs[0].Size())
+
+	fmt.Printf("done\n")
+}
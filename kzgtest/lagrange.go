@@ -0,0 +1,116 @@
+package kzgtest
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"example.com/kzg-demo/types"
+	"example.com/kzg-demo/utils"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// RunLagrange checks incremental insert/remove/replace on a route set up in Lagrange form against
+// a fresh Controller.Setup of the updated route, and compares their cost with a full
+// interpolating Controller.Setup.
+func RunLagrange(n int) {
+	var startTime time.Time
+	var duration time.Duration
+
+	nodesCount := max(n, 3)
+	fmt.Printf("[n=%v] begin lagrange\n", nodesCount)
+
+	scale := uint8(1)
+	for 1<<scale < 4*(nodesCount+1) {
+		scale++
+	}
+	settings, err := types.NewLagrangeSettings(scale)
+	if err != nil {
+		panic(err)
+	}
+
+	used := make(map[uint32]bool)
+	newSecret := func() uint32 {
+		for {
+			data := uint32(rand.Int31())
+			if data != 0 && !used[data] {
+				used[data] = true
+				return data
+			}
+		}
+	}
+	nodesPrivateData := make([]uint32, nodesCount)
+	for i := range nodesPrivateData {
+		nodesPrivateData[i] = newSecret()
+	}
+
+	startTime = time.Now()
+	interpolated := types.Controller{}
+	if _, _, err := interpolated.Setup(nodesPrivateData); err != nil {
+		panic(err)
+	}
+	interpolated.Commit()
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] coefficient setup+commit %v\n", nodesCount, duration)
+
+	startTime = time.Now()
+	controller := types.Controller{Lagrange: settings}
+	if _, _, err := controller.Setup(nodesPrivateData); err != nil {
+		panic(err)
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] lagrange setup+open %v\n", nodesCount, duration)
+
+	updates := []struct {
+		name  string
+		apply func() error
+	}{
+		{"insert", func() error { return controller.Insert(nodesCount/2, newSecret()) }},
+		{"remove", func() error { return controller.Remove(0) }},
+		{"replace", func() error { return controller.Replace(len(controller.Slots)-1, newSecret()) }},
+	}
+	for _, update := range updates {
+		startTime = time.Now()
+		if err := update.apply(); err != nil {
+			panic(err)
+		}
+		duration = time.Since(startTime)
+
+		data := make([]uint32, len(controller.Route.Secrets))
+		for i, secret := range controller.Route.Secrets {
+			data[i] = uint32(secret)
+		}
+		startTime = time.Now()
+		fresh := types.Controller{Lagrange: settings, Slots: controller.Slots}
+		if _, _, err := fresh.Setup(data); err != nil {
+			panic(err)
+		}
+		freshDuration := time.Since(startTime)
+
+		if !bls.EqualG1(fresh.Commit(), controller.Commit()) {
+			panic(fmt.Sprintf("[n=%v] %v: incremental commitment differs from a fresh Setup", nodesCount, update.name))
+		}
+		freshOpenings := fresh.Route.Openings()
+		for i, opening := range controller.Route.Openings() {
+			if !bls.EqualG1(opening.Proof, freshOpenings[i].Proof) {
+				panic(fmt.Sprintf("[n=%v] %v: opening of hop %v differs from a fresh Setup", nodesCount, update.name, i))
+			}
+		}
+		fmt.Printf("[n=%v] %v %v (fresh Setup %v), all %v openings match a fresh Setup\n", nodesCount, update.name, duration, freshDuration, len(freshOpenings))
+	}
+
+	openings := controller.Route.Openings()
+	startTime = time.Now()
+	for i, opening := range openings {
+		if !settings.Verify(controller.Commit(), opening.Slot, opening.Secret, opening.Proof) {
+			panic(fmt.Sprintf("[n=%v] opening of hop %v does not verify", nodesCount, i))
+		}
+		if settings.Verify(controller.Commit(), opening.Slot, opening.Secret+1, opening.Proof) {
+			panic(fmt.Sprintf("[n=%v] opening of hop %v verifies a wrong secret", nodesCount, i))
+		}
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] verify %v\n", nodesCount, utils.DurationDivideBy(duration, 2*len(openings)))
+
+	fmt.Printf("done\n")
+}
@@ -0,0 +1,71 @@
+package kzgtest
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"example.com/kzg-demo/pot"
+	"example.com/kzg-demo/utils"
+)
+
+// RunShamir measures the IETF SFC Shamir proof-of-transit scheme on a route of n hops, in the
+// same format as Run, so the two can be compared side by side.
+func RunShamir(n int) {
+	var startTime time.Time
+	var duration time.Duration
+
+	nodesCount := max(n, 3)
+	fmt.Printf("[n=%v] begin shamir setup\n", nodesCount)
+
+	used := make(map[uint64]bool)
+	xs := make([]uint64, 0, nodesCount)
+	for len(xs) < nodesCount {
+		data := uint64(rand.Int31())
+		if data != 0 && !used[data] {
+			used[data] = true
+			xs = append(xs, data)
+		}
+	}
+
+	startTime = time.Now()
+	route, err := pot.NewShamirRoute(xs)
+	if err != nil {
+		panic(err)
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] setup %v\n", nodesCount, duration)
+
+	header, err := pot.NewShamirHeader()
+	if err != nil {
+		panic(err)
+	}
+	startTime = time.Now()
+	for i := range route.Hops {
+		route.Hops[i].Update(header)
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] prove %v\n", nodesCount, utils.DurationDivideBy(duration, nodesCount))
+
+	startTime = time.Now()
+	verified := route.Verify(header)
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] verify %v (%v)\n", nodesCount, duration, verified)
+
+	// a packet that skips a hop must not verify
+	skipped, err := pot.NewShamirHeader()
+	if err != nil {
+		panic(err)
+	}
+	for i := range route.Hops {
+		if i != nodesCount/2 {
+			route.Hops[i].Update(skipped)
+		}
+	}
+	fmt.Printf("[n=%v] skipped hop rejected: %v\n", nodesCount, !route.Verify(skipped))
+
+	// unlike KZG, which checks every hop with a 48-byte proof, only the egress verifies
+	fmt.Printf("[n=%v] header %v bytes\n", nodesCount, pot.ShamirHeaderSize)
+
+	fmt.Printf("done\n")
+}
@@ -0,0 +1,88 @@
+package kzgtest
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"example.com/kzg-demo/snark"
+	"example.com/kzg-demo/types"
+	"example.com/kzg-demo/utils"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// RunPathSNARK compares the chain of n ComputeProofSingle openings a packet carries with one
+// Groth16 path proof of the same route, in the same format as Run.
+func RunPathSNARK(n int) {
+	var startTime time.Time
+	var duration time.Duration
+
+	nodesCount := max(n, 3)
+	fmt.Printf("[n=%v] begin path snark setup\n", nodesCount)
+
+	nodesPrivateData := make([]uint32, 0, nodesCount)
+	used := make(map[uint32]bool)
+	for len(nodesPrivateData) < nodesCount {
+		data := uint32(rand.Int31())
+		if !used[data] {
+			used[data] = true
+			nodesPrivateData = append(nodesPrivateData, data)
+		}
+	}
+	controller := types.Controller{}
+	if _, _, err := controller.Setup(nodesPrivateData); err != nil {
+		panic(err)
+	}
+	ks := controller.KzgSettings
+	commitment := controller.Commit()
+	xs := make([]bls.Fr, nodesCount)
+	ys := make([]bls.Fr, nodesCount)
+	for i, data := range nodesPrivateData {
+		bls.AsFr(&xs[i], uint64(data))
+		bls.CopyFr(&ys[i], controller.Position(i))
+	}
+
+	// the chain: every hop opens at its secret and the next one checks it
+	proofs := make([]*bls.G1Point, nodesCount)
+	startTime = time.Now()
+	for i, data := range nodesPrivateData {
+		proofs[i] = ks.ComputeProofSingle(controller.Polynomial, uint64(data))
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] chain prove %v (%v per hop)\n", nodesCount, duration, utils.DurationDivideBy(duration, nodesCount))
+	startTime = time.Now()
+	for i := range proofs {
+		if !ks.CheckProofSingle(commitment, proofs[i], &xs[i], &ys[i]) {
+			panic(fmt.Sprintf("opening of hop %v does not verify", i+1))
+		}
+	}
+	duration = time.Since(startTime)
+	// a proof carries its opening, X and Y, see types.Proof
+	fmt.Printf("[n=%v] chain verify %v, %v bytes\n", nodesCount, duration, nodesCount*(48+32+32))
+
+	startTime = time.Now()
+	pk, vk, err := snark.PathSetup(nodesCount, len(controller.Polynomial))
+	if err != nil {
+		panic(err)
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] snark setup %v, %v constraints, domain %v\n", nodesCount, duration, pk.Constraints, pk.Domain)
+
+	packet := types.PacketDigest([]byte("bench"))
+	startTime = time.Now()
+	path, err := snark.ProvePath(pk, ks, controller.Polynomial, xs, ys, packet)
+	if err != nil {
+		panic(err)
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] snark prove %v\n", nodesCount, duration)
+
+	startTime = time.Now()
+	if err := snark.VerifyPath(vk, ks, commitment, ys, packet, path); err != nil {
+		panic(err)
+	}
+	duration = time.Since(startTime)
+	fmt.Printf("[n=%v] snark verify %v, %v bytes\n", nodesCount, duration, snark.PathProofSize)
+
+	fmt.Printf("done\n")
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"bufio"
+	"crypto/ed25519"
+	crand "crypto/rand"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
@@ -16,20 +19,40 @@ import (
 	"syscall"
 	"time"
 
+	"example.com/kzg-demo/diagnose"
+	"example.com/kzg-demo/policy"
+	"example.com/kzg-demo/replay"
+	"example.com/kzg-demo/reputation"
 	"example.com/kzg-demo/utils"
 
+	"example.com/kzg-demo/pot"
 	"example.com/kzg-demo/types"
+	bls12381 "github.com/kilic/bls12-381"
 	"github.com/protolambda/go-kzg/bls"
 )
 
 const PipesNum = 9 // do not change this value
 
+// demoFlowID names the single flow of the demo in the controller's signatures.
+const demoFlowID = "demo"
+
+// reputations is kept by the controller across runs of the demo, so failures add up.
+var reputations *reputation.Tracker
+
 var inputs []*bufio.Scanner
 var _inputFiles []*os.File
 var outputs []*bufio.Writer
 var _outputFiles []*os.File
 var _startTime time.Time = time.Now()
 
+var paddedDegree = flag.Int("pad-degree", 0, "pad the polynomial to this degree to hide the route length; 0 disables")
+var scheme = flag.String("scheme", "kzg", "proof-of-transit scheme: kzg, shamir for the IETF SFC scheme, bls for aggregate signatures, or ipa for the transparent-setup commitment")
+var hidePositions = flag.Bool("hide-positions", false, "replace the hop indices 1..n with position labels derived from a route key")
+var showSecrets = flag.Bool("show-secrets", false, "print node secrets, the secret X of every proof and the polynomial coefficients; for debugging only")
+var failurePolicy = flag.String("policy", "mark+alert", "what a verifier does with a packet whose proof failed: drop, mark or quarantine, optionally with +alert")
+var reputationThreshold = flag.Int("reputation-threshold", 3, "failures reported against a node, across runs of the demo, at which the controller reroutes around it; 0 disables")
+var replayWindow = flag.Int("replay-window", replay.DefaultWindow, "sequence numbers each verifier tracks to refuse replayed proofs; 0 disables the check")
+
 func handleSignal() {
 	// Create a channel to receive signals
 	sigChan := make(chan os.Signal, 1)
@@ -131,7 +154,13 @@ func demo() error {
 		return errors.New("number of nodes should be in range from 3 to 8")
 	}
 
-	controller := types.Controller{}
+	controller := types.Controller{PaddedDegree: *paddedDegree}
+	if *hidePositions {
+		controller.RouteKey, err = types.NewRouteKey()
+		if err != nil {
+			return err
+		}
+	}
 	nodes := make([]types.Node, nodesCount)
 
 	// input & parse the route
@@ -146,22 +175,33 @@ func demo() error {
 		routeStr := inputs[0].Text()
 		routeStr = strings.Trim(routeStr, "\x00") // workaround
 		routeStr = strings.TrimSpace(routeStr)
-		if len(routeStr) != nodesCount {
-			return fmt.Errorf("unexpected route. %v letters are expected, got %v", nodesCount, len(routeStr))
+		if len(routeStr) < nodesCount {
+			return fmt.Errorf("unexpected route. At least %v letters are expected, got %v", nodesCount, len(routeStr))
 		}
 
-		// parse the route
-		routeUsed := make(map[int]bool)
+		// parse the route; a node may be visited more than once
 		for _, ch := range routeStr {
 			nodeId := int(ch - 65)
 			if nodeId < 0 || nodeId >= nodesCount {
 				return fmt.Errorf("unexpected route. Unexpected character %v", string(rune(ch)))
 			}
-			if _, contains := routeUsed[nodeId]; contains {
-				return fmt.Errorf("unexpected route. Duplicated character %v", string(rune(ch)))
-			}
 			route = append(route, nodeId)
-			routeUsed[nodeId] = true
+		}
+
+		// every configured node holds a share of the polynomial, so each must be on the
+		// route at least once; revisits only add positions
+		visits := make([]int, nodesCount)
+		for _, nodeId := range route {
+			visits[nodeId]++
+		}
+		missing := make([]string, 0)
+		for nodeId, count := range visits {
+			if count == 0 {
+				missing = append(missing, string(rune(65+nodeId)))
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("unexpected route. Node(s) %v not visited", strings.Join(missing, ", "))
 		}
 	}
 
@@ -186,7 +226,9 @@ func demo() error {
 			nodes[i].Secret = uint64(data)
 			nodesPrivateData = append(nodesPrivateData, uint32(data))
 
-			Output(i+1, fmt.Sprintf("[%v] Private data: %v\n", nodeName, data))
+			if *showSecrets {
+				Output(i+1, fmt.Sprintf("[%v] Private data: %v\n", nodeName, data))
+			}
 		}
 	} else if choiceStr == "B" {
 		// read private content of each node
@@ -212,7 +254,9 @@ func demo() error {
 			nodes[i].Secret = uint64(data)
 			nodesPrivateData = append(nodesPrivateData, uint32(data))
 
-			Output(i+1, fmt.Sprintf("[%v] Private data: %v\n", nodeName, data))
+			if *showSecrets {
+				Output(i+1, fmt.Sprintf("[%v] Private data: %v\n", nodeName, data))
+			}
 		}
 	} else {
 		return fmt.Errorf("invalid choice. A or B expected, got %v", choiceStr)
@@ -222,19 +266,38 @@ func demo() error {
 		return fmt.Errorf("invalid private data. Private data must be unique for each node")
 	}
 
+	switch *scheme {
+	case "kzg":
+	case "shamir":
+		return demoShamir(route, nodes)
+	case "bls":
+		return demoBLS(route, nodesCount)
+	case "ipa":
+		return demoIPA(&controller, route, nodes)
+	default:
+		return fmt.Errorf("unknown scheme %v", *scheme)
+	}
+
 	Output(0, "Demo begins.\n")
 
 	// controller: initialize polynomial
 	procedureSetupBeginTime := time.Now()
 
-	_, _, err = controller.Setup(nodesPrivateData)
+	// every visit of a node is committed with its own secret
+	routePrivateData := make([]uint32, 0, len(route))
+	for i, visit := range types.Visits(route) {
+		routePrivateData = append(routePrivateData, uint32(types.VisitSecret(nodes[route[i]].Secret, visit)))
+	}
+
+	_, _, err = controller.Setup(routePrivateData)
 	if err != nil {
 		return err
 	}
-	Output(0, "[0] KZG setup completed. Polynomial generated: \n")
-
-	for k, coeff := range controller.Polynomial {
-		Output(0, fmt.Sprintf("Polynomial-%v: %v\n", k, coeff.String()))
+	Output(0, fmt.Sprintf("[0] KZG setup completed. Polynomial of degree %v generated\n", len(controller.Polynomial)-1))
+	if *showSecrets {
+		for k, coeff := range controller.Polynomial {
+			Output(0, fmt.Sprintf("Polynomial-%v: %v\n", k, coeff.String()))
+		}
 	}
 
 	Output(0, "[0] KZG setup parameter -- SecretG1: \n")
@@ -264,65 +327,33 @@ func demo() error {
 	// controller: commit polynomial
 	Output(0, fmt.Sprintf("[0] Commit polynomial:\n%v\n", bls.StrG1(public.PolynomialCommitment)))
 
+	// controller: sign the public parameters; nodes hold its public key and refuse unsigned ones
+	controllerKey, signingKey, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		return err
+	}
+	public.Sign(signingKey, demoFlowID, 0, 0)
+	Output(0, fmt.Sprintf("[0] Signed public parameters with controller key %x\n", controllerKey))
+	for i := 0; i < nodesCount; i++ {
+		nodeName := string(rune(65 + i))
+		if !public.Verify(controllerKey, demoFlowID, 0, 0) {
+			Output(i+1, fmt.Sprintf("[%v] \033[0;31mParameters are not signed by the controller, refusing them\033[0m\n", nodeName))
+			return fmt.Errorf("node %v refused the public parameters", nodeName)
+		}
+		Output(i+1, fmt.Sprintf("[%v] Controller signature on parameters verified\n", nodeName))
+	}
+
 	procedureSetupInterval := time.Since(procedureSetupBeginTime)
 	Output(0, fmt.Sprintf("Setup time cost: %v ms\n", procedureSetupInterval.Milliseconds()))
 
 	Output(0, fmt.Sprintf("Press Enter key to send packets...\n"))
 	inputs[0].Scan()
 
-	// input & parse the route
-	realRoute := make([]int, 0)
-	{
-
-		routeExample := "ABCDEFGH"[:nodesCount]
-
-		Output(0, fmt.Sprintf("Input the real route, e.g., %v: ", routeExample))
-
-		inputs[0].Scan()
-		routeStr := inputs[0].Text()
-		routeStr = strings.Trim(routeStr, "\x00") // workaround
-		routeStr = strings.TrimSpace(routeStr)
-		//if len(routeStr) != nodesCount {
-		//	return fmt.Errorf("unexpected route. %v letters are expected, got %v", nodesCount, len(routeStr))
-		//}
-
-		// parse the route
-		//routeUsed := make(map[int]bool)
-		for _, ch := range routeStr {
-			nodeId := int(ch - 65)
-
-			// at least route should be a letter
-			if nodeId < 0 || nodeId >= 26 {
-				return fmt.Errorf("unexpected route. Unexpected character %v", string(rune(ch)))
-			}
-
-			//if nodeId < 0 || nodeId >= nodesCount {
-			//return fmt.Errorf("unexpected route. Unexpected character %v", string(rune(ch)))
-			//}
-			//if _, contains := routeUsed[nodeId]; contains {
-			//	return fmt.Errorf("unexpected route. Duplicated character %v", string(rune(ch)))
-			//}
-			realRoute = append(realRoute, nodeId)
-			//routeUsed[nodeId] = true
-		}
-	}
-
-	// compute node ID
-	routeConsoleID := make(map[int]int)
-	{
-		realRouteCopy := make([]int, len(realRoute))
-		copy(realRouteCopy, realRoute)
-		realRouteCopy = append(realRouteCopy, route...)
-		sort.Ints(realRouteCopy)
-
-		// assign console ID
-		for _, nodeID := range realRouteCopy {
-			if _, contains := routeConsoleID[nodeID]; !contains {
-				routeConsoleID[nodeID] = len(routeConsoleID)%(PipesNum-1) + 1
-			}
-		}
+	realRoute, err := inputRealRoute(nodesCount)
+	if err != nil {
+		return err
 	}
-
+	routeConsoleID := assignConsoleIDs(realRoute, route)
 	// prepare up to 26 nodes
 	for i := nodesCount; i < 26; i++ {
 		data := rand.Int31()
@@ -338,10 +369,89 @@ func demo() error {
 		nodes = append(nodes, node)
 	}
 
+	// every hop chains its proof to the packet and to the proof it received
+	packet := make([]byte, 64)
+	if _, err := crand.Read(packet); err != nil {
+		return err
+	}
+	packetDigest := types.PacketDigest(packet)
+	Output(0, fmt.Sprintf("[0] Packet digest: %x\n", packetDigest))
+	var chain []*types.Proof
+
+	// the ingress numbers the packet, every verifier keeps a replay window per flow
+	const seq uint64 = 1
+	Output(0, fmt.Sprintf("[0] Packet sequence number: %v\n", seq))
+	detectors := make(map[int]*replay.Detector)
+	if *replayWindow > 0 {
+		for _, nodeID := range realRoute {
+			detectors[nodeID] = replay.NewDetector(*replayWindow)
+		}
+	}
+
+	// every node signs its chain links with a hop key of its own, the controller vouches for the
+	// public halves
+	hopKeys := make([]ed25519.PrivateKey, 26)
+	linkKeys := make(map[string]ed25519.PublicKey)
+	for i := range hopKeys {
+		hopPublic, hopKey, err := ed25519.GenerateKey(crand.Reader)
+		if err != nil {
+			return err
+		}
+		hopKeys[i] = hopKey
+		linkKeys[string(rune(65+i))] = hopPublic
+	}
+
+	// the intended route, to explain deviations from it
+	intended := &diagnose.Route{
+		Nodes:      make([]string, len(route)),
+		Ys:         make([]bls.Fr, len(route)),
+		Commitment: public.PolynomialCommitment,
+		Settings:   public.KzgSettings,
+		Keys:       linkKeys,
+	}
+	routeKeys := make([]ed25519.PublicKey, len(route))
+	for i, nodeID := range route {
+		intended.Nodes[i] = string(rune(65 + nodeID))
+		bls.CopyFr(&intended.Ys[i], controller.Position(i))
+		routeKeys[i] = linkKeys[intended.Nodes[i]]
+	}
+	routeVisits := types.Visits(route)
+
+	// every verifier applies the flow's failure policy, alerts go to the controller's console
+	flowPolicy, err := policy.Parse(*failurePolicy)
+	if err != nil {
+		return err
+	}
+	Output(0, fmt.Sprintf("[0] Failure policy: %v\n", flowPolicy))
+	engines := make(map[int]*policy.Engine)
+	for _, nodeID := range realRoute {
+		engines[nodeID] = policy.NewEngine(flowPolicy)
+		engines[nodeID].Alert = func(alert policy.Alert) {
+			Output(0, fmt.Sprintf("[0] Alert from %v: proof from %v (seq %v): %v\n", alert.Node, alert.Sender, alert.Seq, alert.Reason))
+			observeAlert(alert, intended.Nodes)
+		}
+	}
+	decide := func(nodeID int, visit int, proof *types.Proof, failure error) policy.Decision {
+		previous := ""
+		if hop := configuredHop(route, routeVisits, nodeID, visit); hop > 0 {
+			previous = string(rune(65 + route[hop-1]))
+		}
+		return engines[nodeID].Decide(policy.Alert{
+			Node:     string(rune(65 + nodeID)),
+			Flow:     demoFlowID,
+			Seq:      proof.Seq,
+			Sender:   proof.Node,
+			Previous: previous,
+		}, failure)
+	}
+	droppedBy := ""
+	marked := false
+
 	// verify the previous node's proof and generate my proof
 	var lastProof *bls.G1Point = nil
 	var lastNodeName = "0"
 	var lastNodeSecret *bls.Fr = nil
+	realVisits := types.Visits(realRoute)
 
 	for j := 0; j < len(realRoute); j++ {
 		thisNodeID := realRoute[j]
@@ -360,7 +470,12 @@ func demo() error {
 		// verifying last node's proof
 		if j != 0 {
 			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Received and verifying %v's proof: \n", thisNodeName, lastNodeName))
-			Output(thisNodeConsoleID, fmt.Sprintf("x=%v, y=%v\n", lastNodeSecret.String(), j-1+1))
+			y := controller.Position(j - 1)
+			if *showSecrets {
+				Output(thisNodeConsoleID, fmt.Sprintf("x=%v, y=%v\n", lastNodeSecret.String(), y.String()))
+			} else {
+				Output(thisNodeConsoleID, fmt.Sprintf("y=%v\n", y.String()))
+			}
 			Output(thisNodeConsoleID, fmt.Sprintf("proof:\n%v\n", lastProof.String()))
 
 			var proofVerified bool
@@ -368,9 +483,6 @@ func demo() error {
 
 			procedureVerifyStartTime := time.Now()
 			for k := 0; k < REPEAT_COUNT; k++ {
-				y := new(bls.Fr)
-				bls.AsFr(y, uint64(j-1+1))
-
 				proofVerified = public.KzgSettings.CheckProofSingle(
 					public.PolynomialCommitment, lastProof, lastNodeSecret, y)
 			}
@@ -382,41 +494,121 @@ func demo() error {
 				Output(thisNodeConsoleID, fmt.Sprintf("[%v] Verification result: \033[0;31m%v\033[0m\n", thisNodeName, proofVerified))
 			}
 			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Verification time cost: %.2f ms\n", thisNodeName, procedureVerifyInterval))
+
+			// compare the predecessor with the one intended at setup; a node off the route
+			// expects the position its real index would have
+			expected := j
+			if hop := configuredHop(route, routeVisits, thisNodeID, realVisits[j]); hop >= 0 {
+				expected = hop
+			}
+
+			// the link must be signed by the predecessor intended at setup
+			linked := expected > 0 && expected <= len(route) && chain[len(chain)-1].CheckLink(routeKeys[expected-1], packetDigest)
+			if linked {
+				Output(thisNodeConsoleID, fmt.Sprintf("[%v] Chain link bound to this packet: \033[0;32m%v\033[0m\n", thisNodeName, linked))
+			} else {
+				Output(thisNodeConsoleID, fmt.Sprintf("[%v] Chain link bound to this packet: \033[0;31m%v\033[0m\n", thisNodeName, linked))
+			}
+			finding := diagnose.DiagnoseHop(intended, expected, chain[len(chain)-1], packetDigest)
+			if finding.Kind != diagnose.OK {
+				Output(thisNodeConsoleID, fmt.Sprintf("[%v] Diagnosis: \033[0;31m%v\033[0m\n", thisNodeName, finding))
+			}
+
+			// the first failed check decides what happens to the packet
+			var failure error
+			switch {
+			case !proofVerified:
+				failure = errors.New("proof does not open the commitment")
+			case !linked:
+				failure = errors.New("chain link is not bound to this packet by the intended predecessor")
+			case finding.Kind != diagnose.OK:
+				failure = errors.New(finding.String())
+			}
+
+			// only proofs that verified may move the replay window
+			if detector := detectors[thisNodeID]; detector != nil && proofVerified && linked {
+				received := chain[len(chain)-1]
+				if err := detector.Accept(demoFlowID, strconv.Itoa(realVisits[j]), received.Seq); err != nil {
+					Output(thisNodeConsoleID, fmt.Sprintf("[%v] Replay window: \033[0;31msequence number %v refused: %v\033[0m\n", thisNodeName, received.Seq, err))
+					if failure == nil {
+						failure = fmt.Errorf("sequence number %v: %w", received.Seq, err)
+					}
+				} else {
+					Output(thisNodeConsoleID, fmt.Sprintf("[%v] Replay window: \033[0;32msequence number %v accepted\033[0m\n", thisNodeName, received.Seq))
+				}
+			}
+
+			decision := decide(thisNodeID, realVisits[j], chain[len(chain)-1], failure)
+			switch decision.Outcome {
+			case policy.Forward:
+				Output(thisNodeConsoleID, fmt.Sprintf("[%v] Policy decision: \033[0;32m%v\033[0m\n", thisNodeName, decision))
+			case policy.ForwardMarked:
+				Output(thisNodeConsoleID, fmt.Sprintf("[%v] Policy decision: \033[0;33m%v\033[0m\n", thisNodeName, decision))
+				marked = true
+			case policy.Dropped:
+				Output(thisNodeConsoleID, fmt.Sprintf("[%v] Policy decision: \033[0;31m%v\033[0m\n", thisNodeName, decision))
+			}
+			if decision.Outcome == policy.Dropped {
+				droppedBy = thisNodeName
+				break
+			}
 		}
 
 		// generating my proof
 		{
-			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Generating my proof: \n", thisNodeName))
-			Output(thisNodeConsoleID, fmt.Sprintf("x=%v, y=%v\n", nodes[thisNodeID].Secret, j+1))
+			secret := types.VisitSecret(nodes[thisNodeID].Secret, realVisits[j])
+			secretFr := new(bls.Fr)
+			bls.AsFr(secretFr, secret)
+
+			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Generating my proof (visit %v): \n", thisNodeName, realVisits[j]+1))
+			if *showSecrets {
+				Output(thisNodeConsoleID, fmt.Sprintf("x=%v, y=%v\n", secret, controller.Position(j).String()))
+			} else {
+				Output(thisNodeConsoleID, fmt.Sprintf("y=%v\n", controller.Position(j).String()))
+			}
 
 			REPEAT_COUNT := 100
 
 			procedureProveStartTime := time.Now()
 			for k := 0; k < REPEAT_COUNT; k++ {
-				proof := public.KzgSettings.ComputeProofSingle(nodes[thisNodeID].Polynomial, nodes[thisNodeID].Secret)
+				proof := public.KzgSettings.ComputeProofSingle(nodes[thisNodeID].Polynomial, secret)
 				lastProof = proof
 				lastNodeName = thisNodeName
-				lastNodeSecret = nodes[thisNodeID].SecretFr
+				lastNodeSecret = secretFr
 			}
 			procedureProveInterval := float64(time.Since(procedureProveStartTime).Nanoseconds()) / float64(1000000) / float64(REPEAT_COUNT)
 
 			Output(thisNodeConsoleID, fmt.Sprintf("proof:\n%v\n", lastProof.String()))
 
 			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Prove time cost: %.2f ms\n", thisNodeName, procedureProveInterval))
+
+			link := &types.Proof{
+				FlowID: demoFlowID,
+				Node:   thisNodeName,
+				X:      secretFr.String(),
+				Y:      controller.Position(j).String(),
+				Proof:  lastProof,
+				Seq:    seq,
+			}
+			var prev []byte
+			if len(chain) > 0 {
+				prev = chain[len(chain)-1].Chain
+			}
+			link.Bind(hopKeys[thisNodeID], prev, packetDigest)
+			chain = append(chain, link)
+			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Chained proof: %x\n", thisNodeName, link.Chain))
 		}
 
 		// self-verifying my proof
 		{
-			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Self-verifying %v's proof with y=%v\n", thisNodeName, lastNodeName, j+1))
+			y := controller.Position(j)
+			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Self-verifying %v's proof with y=%v\n", thisNodeName, lastNodeName, y.String()))
 
 			var proofVerified bool
 			REPEAT_COUNT := 100
 
 			procedureVerifyStartTime := time.Now()
 			for k := 0; k < REPEAT_COUNT; k++ {
-				y := new(bls.Fr)
-				bls.AsFr(y, uint64(j+1))
-
 				proofVerified = public.KzgSettings.CheckProofSingle(
 					public.PolynomialCommitment, lastProof, lastNodeSecret, y)
 			}
@@ -434,12 +626,509 @@ func demo() error {
 		time.Sleep(500 * time.Millisecond)
 	}
 
+	// the egress checks the whole chain against the packet it forwarded, unless a verifier dropped it
+	switch {
+	case droppedBy != "":
+		Output(0, fmt.Sprintf("[0] Packet dropped by %v, the egress never received it\n", droppedBy))
+	case marked:
+		Output(0, "[0] Egress received the packet \033[0;33mmarked as failed\033[0m\n")
+	}
+	if droppedBy == "" {
+		if err := types.CheckChain(routeKeys, chain, packetDigest); err != nil {
+			Output(0, fmt.Sprintf("[0] End-to-end chain verification: \033[0;31mfalse\033[0m (%v)\n", err))
+		} else {
+			Output(0, fmt.Sprintf("[0] End-to-end chain verification: \033[0;32mtrue\033[0m (%v hops)\n", len(chain)))
+		}
+		if report := diagnose.Diagnose(intended, chain, packetDigest); report.OK() {
+			Output(0, fmt.Sprintf("[0] Path diagnosis: \033[0;32m%v\033[0m\n", report))
+		} else {
+			Output(0, fmt.Sprintf("[0] Path diagnosis: \033[0;31m%v\033[0m\n", report))
+		}
+	}
+
+	// an attacker records the first hop's proof and replays the packet to the second hop; the
+	// proof and its chain link still verify, the replay window does not accept it twice
+	var detector *replay.Detector
+	if len(realRoute) > 1 {
+		detector = detectors[realRoute[1]]
+	}
+	if detector != nil && len(chain) > 1 {
+		replayed := chain[0]
+		name := chain[1].Node
+		var x bls.Fr
+		if err := types.FrFromString(&x, replayed.X); err != nil {
+			return err
+		}
+		valid := replayed.CheckLink(linkKeys[replayed.Node], packetDigest) && public.KzgSettings.CheckProofSingle(public.PolynomialCommitment, replayed.Proof, &x, controller.Position(0))
+		Output(0, fmt.Sprintf("[0] Replayed proof and chain link still verify: %v\n", valid))
+		err := detector.Accept(demoFlowID, strconv.Itoa(realVisits[1]), replayed.Seq)
+		if err != nil {
+			Output(0, fmt.Sprintf("[0] Replaying %v's proof to %v: \033[0;32mrefused\033[0m (%v)\n", replayed.Node, name, err))
+			err = fmt.Errorf("sequence number %v: %w", replayed.Seq, err)
+		} else {
+			Output(0, fmt.Sprintf("[0] Replaying %v's proof to %v: \033[0;31maccepted\033[0m\n", replayed.Node, name))
+		}
+		Output(0, fmt.Sprintf("[0] %v's decision on the replay: %v\n", name, decide(realRoute[1], realVisits[1], replayed, err)))
+		reported := make(map[int]bool)
+		for _, nodeID := range realRoute[1:] {
+			if reported[nodeID] {
+				continue
+			}
+			reported[nodeID] = true
+			stats := detectors[nodeID].Stats()[demoFlowID]
+			Output(0, fmt.Sprintf("[0] %v replay counters: accepted %v, replayed %v, too old %v, unsequenced %v\n",
+				string(rune(65+nodeID)), stats.Accepted, stats.Replayed, stats.TooOld, stats.Unsequenced))
+		}
+	}
+
+	if len(realRoute) > 1 {
+		reported := make(map[int]bool)
+		for _, nodeID := range realRoute[1:] {
+			if reported[nodeID] {
+				continue
+			}
+			reported[nodeID] = true
+			stats, ok := engines[nodeID].Stats()[demoFlowID]
+			if !ok {
+				continue
+			}
+			line := fmt.Sprintf("[0] %v decisions: forwarded %v, marked %v, dropped %v, alerts %v", string(rune(65+nodeID)), stats.Forwarded, stats.Marked, stats.Dropped, stats.Alerts)
+			if stats.Quarantined != "" {
+				line += ", flow quarantined"
+			}
+			Output(0, line+"\n")
+		}
+	}
+
+	if reputations != nil {
+		for _, standing := range reputations.Reputations(time.Now()) {
+			Output(0, fmt.Sprintf("[0] Reputation of %v\n", standing))
+		}
+	}
+
+	Output(0, "Demo ends.\n")
+
+	return nil
+}
+
+// observeAlert counts an alert against the upstream hop it blames, and shows how the controller
+// would reroute the flow once the hop crosses the failure threshold.
+func observeAlert(alert policy.Alert, route []string) {
+	if reputations == nil {
+		return
+	}
+	report, err := reputation.Attribute(alert, route)
+	if err != nil {
+		Output(0, fmt.Sprintf("[0] Alert refused: %v\n", err))
+		return
+	}
+	standing, crossed, err := reputations.Observe(report)
+	if err != nil {
+		Output(0, fmt.Sprintf("[0] Alert not counted: %v\n", err))
+		return
+	}
+	Output(0, fmt.Sprintf("[0] Failure attributed to %v, %v of %v failures\n", standing.Node, standing.Recent, reputations.Threshold))
+	if !crossed {
+		return
+	}
+	// every node of the demo is on the route, so there are no spares to replace the hop with
+	avoided, err := reputation.Avoid(route, standing.Node, nil)
+	if err != nil {
+		Output(0, fmt.Sprintf("[0] \033[0;31m%v crossed the failure threshold\033[0m, but %v\n", standing.Node, err))
+		return
+	}
+	Output(0, fmt.Sprintf("[0] \033[0;31m%v crossed the failure threshold\033[0m, the controller reroutes flow %v as %v\n", standing.Node, demoFlowID, strings.Join(avoided, "")))
+}
+
+// demoShamir runs the route demo with the IETF SFC Shamir proof-of-transit scheme instead of KZG.
+// The node private data serve as the share identifiers, and the egress of the configured route is
+// the verifier.
+func demoShamir(route []int, nodes []types.Node) error {
+	Output(0, "Demo begins (Shamir proof-of-transit).\n")
+
+	procedureSetupBeginTime := time.Now()
+
+	visits := types.Visits(route)
+	xs := make([]uint64, 0, len(route))
+	for i, visit := range visits {
+		xs = append(xs, types.VisitSecret(nodes[route[i]].Secret, visit))
+	}
+	shamirRoute, err := pot.NewShamirRoute(xs)
+	if err != nil {
+		return err
+	}
+	Output(0, "[0] Shamir setup completed. Hop parameters: \n")
+	for i, hop := range shamirRoute.Hops {
+		if *showSecrets {
+			Output(0, fmt.Sprintf("Hop-%v: %v, x=%v, public=%v, lpc=%v\n", i, string(rune(65+route[i])), hop.X, hop.Public, hop.LPC))
+		} else {
+			Output(0, fmt.Sprintf("Hop-%v: %v, public=%v, lpc=%v\n", i, string(rune(65+route[i])), hop.Public, hop.LPC))
+		}
+	}
+	for i := 0; i < len(nodes); i++ {
+		Output(i+1, fmt.Sprintf("[%v] Parameters received\n", string(rune(65+i))))
+	}
+
+	procedureSetupInterval := time.Since(procedureSetupBeginTime)
+	Output(0, fmt.Sprintf("Setup time cost: %v ms\n", procedureSetupInterval.Milliseconds()))
+
+	Output(0, fmt.Sprintf("Press Enter key to send packets...\n"))
+	inputs[0].Scan()
+
+	realRoute, err := inputRealRoute(len(nodes))
+	if err != nil {
+		return err
+	}
+	routeConsoleID := assignConsoleIDs(realRoute, route)
+	realVisits := types.Visits(realRoute)
+
+	header, err := pot.NewShamirHeader()
+	if err != nil {
+		return err
+	}
+	Output(0, fmt.Sprintf("[0] Packet RND=%v\n", header.RND))
+
+	lastHop := -1
+	for j := 0; j < len(realRoute); j++ {
+		thisNodeID := realRoute[j]
+		thisNodeName := string(rune(65 + thisNodeID))
+		thisNodeConsoleID := routeConsoleID[thisNodeID]
+
+		// nodes off the configured route forge a configuration
+		lastHop = configuredHop(route, visits, thisNodeID, realVisits[j])
+		var hop pot.ShamirHop
+		if lastHop >= 0 {
+			hop = shamirRoute.Hops[lastHop]
+		} else {
+			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Not on the configured route, forging a share\n", thisNodeName))
+			hop = pot.ShamirHop{X: uint64(rand.Int31()), Share: rand.Uint64(), LPC: rand.Uint64()}
+		}
+
+		Output(thisNodeConsoleID, fmt.Sprintf("[%v] Received CML=%v (visit %v)\n", thisNodeName, header.CML, realVisits[j]+1))
+
+		REPEAT_COUNT := 100
+
+		updated := *header
+		procedureProveStartTime := time.Now()
+		for k := 0; k < REPEAT_COUNT; k++ {
+			updated = *header
+			hop.Update(&updated)
+		}
+		procedureProveInterval := float64(time.Since(procedureProveStartTime).Nanoseconds()) / float64(1000000) / float64(REPEAT_COUNT)
+		header = &updated
+
+		Output(thisNodeConsoleID, fmt.Sprintf("[%v] Updated CML=%v\n", thisNodeName, header.CML))
+		Output(thisNodeConsoleID, fmt.Sprintf("[%v] Update time cost: %.4f ms\n", thisNodeName, procedureProveInterval))
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	// the egress of the configured route holds the secret and verifies
+	egressName := string(rune(65 + route[len(route)-1]))
+	egressConsoleID := routeConsoleID[route[len(route)-1]]
+	verified := lastHop == len(route)-1 && shamirRoute.Verify(header)
+	if verified {
+		Output(egressConsoleID, fmt.Sprintf("[%v] Verification result: \033[0;32m%v\033[0m\n", egressName, verified))
+	} else {
+		Output(egressConsoleID, fmt.Sprintf("[%v] Verification result: \033[0;31m%v\033[0m\n", egressName, verified))
+	}
+	Output(0, fmt.Sprintf("Header size: %v bytes\n", pot.ShamirHeaderSize))
+
+	Output(0, "Demo ends.\n")
+
+	return nil
+}
+
+// demoBLS runs the route demo with BLS aggregate signatures: every hop adds its signature for its
+// position to the packet, verifies the aggregate of its predecessors, and the egress verifies all.
+func demoBLS(route []int, nodesCount int) error {
+	Output(0, "Demo begins (BLS aggregate-signature proof-of-transit).\n")
+
+	procedureSetupBeginTime := time.Now()
+
+	keys := make([]*pot.BLSKey, 26)
+	for i := range keys {
+		key, err := pot.NewBLSKey()
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+	blsRoute := &pot.BLSRoute{FlowID: "demo", Keys: make([]*bls12381.PointG2, len(route))}
+	for i, nodeID := range route {
+		blsRoute.Keys[i] = keys[nodeID].Public
+	}
+	Output(0, "[0] Public keys of the route registered: \n")
+	for i, nodeID := range route {
+		Output(0, fmt.Sprintf("Hop-%v: %v, pk=%x\n", i, string(rune(65+nodeID)), bls12381.NewG2().ToCompressed(blsRoute.Keys[i])))
+	}
+	for i := 0; i < nodesCount; i++ {
+		Output(i+1, fmt.Sprintf("[%v] Key pair generated\n", string(rune(65+i))))
+	}
+
+	procedureSetupInterval := time.Since(procedureSetupBeginTime)
+	Output(0, fmt.Sprintf("Setup time cost: %v ms\n", procedureSetupInterval.Milliseconds()))
+
+	Output(0, fmt.Sprintf("Press Enter key to send packets...\n"))
+	inputs[0].Scan()
+
+	realRoute, err := inputRealRoute(nodesCount)
+	if err != nil {
+		return err
+	}
+	routeConsoleID := assignConsoleIDs(realRoute, route)
+	visits := types.Visits(route)
+	realVisits := types.Visits(realRoute)
+
+	packet := make([]byte, 64)
+	rand.Read(packet)
+	header := pot.NewBLSHeader(packet)
+	Output(0, fmt.Sprintf("[0] Packet digest=%x\n", header.Digest))
+
+	for j := 0; j < len(realRoute); j++ {
+		thisNodeID := realRoute[j]
+		thisNodeName := string(rune(65 + thisNodeID))
+		thisNodeConsoleID := routeConsoleID[thisNodeID]
+
+		// a node signs the position it was configured at; nodes off the route claim this one
+		position := configuredHop(route, visits, thisNodeID, realVisits[j])
+		if position < 0 {
+			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Not on the configured route\n", thisNodeName))
+			position = j
+		}
+
+		// verifying the predecessors' aggregate
+		if j != 0 {
+			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Received and verifying the aggregate of %v hops: \n", thisNodeName, min(position, len(route))))
+
+			var proofVerified bool
+			REPEAT_COUNT := 10
+
+			procedureVerifyStartTime := time.Now()
+			for k := 0; k < REPEAT_COUNT; k++ {
+				proofVerified, err = blsRoute.VerifyPrefix(header, position)
+				if err != nil {
+					proofVerified = false
+				}
+			}
+			procedureVerifyInterval := float64(time.Since(procedureVerifyStartTime).Nanoseconds()) / float64(1000000) / float64(REPEAT_COUNT)
+
+			if proofVerified {
+				Output(thisNodeConsoleID, fmt.Sprintf("[%v] Verification result: \033[0;32m%v\033[0m\n", thisNodeName, proofVerified))
+			} else {
+				Output(thisNodeConsoleID, fmt.Sprintf("[%v] Verification result: \033[0;31m%v\033[0m\n", thisNodeName, proofVerified))
+			}
+			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Verification time cost: %.2f ms\n", thisNodeName, procedureVerifyInterval))
+		}
+
+		// adding my signature
+		{
+			procedureProveStartTime := time.Now()
+			if err := keys[thisNodeID].Sign(blsRoute.FlowID, position, header); err != nil {
+				return err
+			}
+			procedureProveInterval := float64(time.Since(procedureProveStartTime).Nanoseconds()) / float64(1000000)
+
+			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Signed position %v, aggregate:\n%x\n", thisNodeName, position, bls12381.NewG1().ToCompressed(header.Signature)))
+			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Sign time cost: %.2f ms\n", thisNodeName, procedureProveInterval))
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	// the egress checks that every hop of the configured route signed
+	lastNodeName := string(rune(65 + realRoute[len(realRoute)-1]))
+	lastConsoleID := routeConsoleID[realRoute[len(realRoute)-1]]
+	verified, err := blsRoute.Verify(header)
+	if err != nil {
+		return err
+	}
+	if verified {
+		Output(lastConsoleID, fmt.Sprintf("[%v] Egress verification result: \033[0;32m%v\033[0m\n", lastNodeName, verified))
+	} else {
+		Output(lastConsoleID, fmt.Sprintf("[%v] Egress verification result: \033[0;31m%v\033[0m\n", lastNodeName, verified))
+	}
+	Output(0, fmt.Sprintf("Header size: %v bytes\n", pot.BLSHeaderSize))
+
 	Output(0, "Demo ends.\n")
 
 	return nil
 }
 
+// demoIPA runs the route demo with the same polynomial committed by the transparent IPA backend:
+// no trusted setup, but larger proofs.
+func demoIPA(controller *types.Controller, route []int, nodes []types.Node) error {
+	Output(0, "Demo begins (IPA commitment, transparent setup).\n")
+
+	procedureSetupBeginTime := time.Now()
+
+	visits := types.Visits(route)
+	routePrivateData := make([]uint32, 0, len(route))
+	for i, visit := range visits {
+		routePrivateData = append(routePrivateData, uint32(types.VisitSecret(nodes[route[i]].Secret, visit)))
+	}
+	_, polynomial, err := controller.Setup(routePrivateData)
+	if err != nil {
+		return err
+	}
+	settings, err := types.NewIPASettings(len(polynomial))
+	if err != nil {
+		return err
+	}
+	commitment, err := settings.Commit(polynomial)
+	if err != nil {
+		return err
+	}
+	Output(0, fmt.Sprintf("[0] %v generators hashed to the curve, no trusted setup\n", settings.Width))
+	Output(0, fmt.Sprintf("[0] Commit polynomial:\n%v\n", bls.StrG1(commitment)))
+	for i := 0; i < len(nodes); i++ {
+		Output(i+1, fmt.Sprintf("[%v] Parameters received\n", string(rune(65+i))))
+	}
+
+	procedureSetupInterval := time.Since(procedureSetupBeginTime)
+	Output(0, fmt.Sprintf("Setup time cost: %v ms\n", procedureSetupInterval.Milliseconds()))
+
+	Output(0, fmt.Sprintf("Press Enter key to send packets...\n"))
+	inputs[0].Scan()
+
+	realRoute, err := inputRealRoute(len(nodes))
+	if err != nil {
+		return err
+	}
+	routeConsoleID := assignConsoleIDs(realRoute, route)
+	realVisits := types.Visits(realRoute)
+
+	// nodes off the configured route have secrets that are not on the polynomial
+	secrets := make([]uint64, 26)
+	for i := range secrets {
+		if i < len(nodes) {
+			secrets[i] = nodes[i].Secret
+		} else {
+			secrets[i] = uint64(rand.Int31())
+		}
+	}
+
+	var lastProof *types.IPAProof
+	var lastNodeName string
+	var lastNodeSecret bls.Fr
+	for j := 0; j < len(realRoute); j++ {
+		thisNodeID := realRoute[j]
+		thisNodeName := string(rune(65 + thisNodeID))
+		thisNodeConsoleID := routeConsoleID[thisNodeID]
+
+		if j != 0 {
+			y := controller.Position(j - 1)
+			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Received and verifying %v's proof: \n", thisNodeName, lastNodeName))
+			if *showSecrets {
+				Output(thisNodeConsoleID, fmt.Sprintf("x=%v, y=%v\n", lastNodeSecret.String(), y.String()))
+			} else {
+				Output(thisNodeConsoleID, fmt.Sprintf("y=%v\n", y.String()))
+			}
+
+			procedureVerifyStartTime := time.Now()
+			proofVerified := settings.Verify(commitment, lastProof, &lastNodeSecret, y)
+			procedureVerifyInterval := float64(time.Since(procedureVerifyStartTime).Nanoseconds()) / float64(1000000)
+
+			if proofVerified {
+				Output(thisNodeConsoleID, fmt.Sprintf("[%v] Verification result: \033[0;32m%v\033[0m\n", thisNodeName, proofVerified))
+			} else {
+				Output(thisNodeConsoleID, fmt.Sprintf("[%v] Verification result: \033[0;31m%v\033[0m\n", thisNodeName, proofVerified))
+			}
+			Output(thisNodeConsoleID, fmt.Sprintf("[%v] Verification time cost: %.2f ms\n", thisNodeName, procedureVerifyInterval))
+		}
+
+		bls.AsFr(&lastNodeSecret, types.VisitSecret(secrets[thisNodeID], realVisits[j]))
+		lastNodeName = thisNodeName
+
+		procedureProveStartTime := time.Now()
+		lastProof, err = settings.Open(polynomial, commitment, &lastNodeSecret)
+		if err != nil {
+			return err
+		}
+		procedureProveInterval := float64(time.Since(procedureProveStartTime).Nanoseconds()) / float64(1000000)
+
+		Output(thisNodeConsoleID, fmt.Sprintf("[%v] Generated my proof (%v bytes)\n", thisNodeName, lastProof.Size()))
+		Output(thisNodeConsoleID, fmt.Sprintf("[%v] Prove time cost: %.2f ms\n", thisNodeName, procedureProveInterval))
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	Output(0, "Demo ends.\n")
+
+	return nil
+}
+
+// configuredHop returns the position of a node's visit on the configured route, or -1.
+func configuredHop(route []int, visits []int, nodeID int, visit int) int {
+	for k := range route {
+		if route[k] == nodeID && visits[k] == visit {
+			return k
+		}
+	}
+	return -1
+}
+
+// inputRealRoute reads the route the packets actually take. It may differ from the committed one.
+func inputRealRoute(nodesCount int) ([]int, error) {
+	realRoute := make([]int, 0)
+
+	routeExample := "ABCDEFGH"[:nodesCount]
+
+	Output(0, fmt.Sprintf("Input the real route, e.g., %v: ", routeExample))
+
+	inputs[0].Scan()
+	routeStr := inputs[0].Text()
+	routeStr = strings.Trim(routeStr, "\x00") // workaround
+	routeStr = strings.TrimSpace(routeStr)
+	//if len(routeStr) != nodesCount {
+	//	return nil, fmt.Errorf("unexpected route. %v letters are expected, got %v", nodesCount, len(routeStr))
+	//}
+
+	// parse the route
+	//routeUsed := make(map[int]bool)
+	for _, ch := range routeStr {
+		nodeId := int(ch - 65)
+
+		// at least route should be a letter
+		if nodeId < 0 || nodeId >= 26 {
+			return nil, fmt.Errorf("unexpected route. Unexpected character %v", string(rune(ch)))
+		}
+
+		//if nodeId < 0 || nodeId >= nodesCount {
+		//return nil, fmt.Errorf("unexpected route. Unexpected character %v", string(rune(ch)))
+		//}
+		//if _, contains := routeUsed[nodeId]; contains {
+		//	return nil, fmt.Errorf("unexpected route. Duplicated character %v", string(rune(ch)))
+		//}
+		realRoute = append(realRoute, nodeId)
+		//routeUsed[nodeId] = true
+	}
+	return realRoute, nil
+}
+
+// assignConsoleIDs maps every node on either route to an output console.
+func assignConsoleIDs(realRoute []int, route []int) map[int]int {
+	routeConsoleID := make(map[int]int)
+
+	realRouteCopy := make([]int, len(realRoute))
+	copy(realRouteCopy, realRoute)
+	realRouteCopy = append(realRouteCopy, route...)
+	sort.Ints(realRouteCopy)
+
+	// assign console ID
+	for _, nodeID := range realRouteCopy {
+		if _, contains := routeConsoleID[nodeID]; !contains {
+			routeConsoleID[nodeID] = len(routeConsoleID)%(PipesNum-1) + 1
+		}
+	}
+	return routeConsoleID
+}
+
 func main() {
+	flag.Parse()
+	if *reputationThreshold > 0 {
+		reputations = reputation.NewTracker(*reputationThreshold, 0)
+	}
 	onStart()
 
 	for {
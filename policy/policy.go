@@ -0,0 +1,266 @@
+// Package policy decides what a verifying node does with a packet whose proof failed: drop it,
+// forward it marked, or quarantine the flow, and optionally alert the controller. Policies are set
+// per flow by the controller; a node falls back to its default policy for flows that have none.
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Action int
+
+const (
+	Drop       Action = iota // drop the packet
+	Mark                     // forward the packet, marked as failed
+	Quarantine               // drop the packet and every later packet of the flow, until released
+)
+
+func (a Action) String() string {
+	switch a {
+	case Drop:
+		return "drop"
+	case Mark:
+		return "mark"
+	case Quarantine:
+		return "quarantine"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// Policy is what a node does when a proof of the flow fails verification.
+type Policy struct {
+	Action Action
+	Alert  bool // report the failure to the controller as well
+}
+
+// Parse reads a policy such as "drop", "mark", "quarantine" or "mark+alert". "alert" on its own
+// drops the packet and alerts the controller.
+func Parse(s string) (Policy, error) {
+	var p Policy
+	action := ""
+	for _, part := range strings.Split(strings.TrimSpace(s), "+") {
+		switch part = strings.TrimSpace(part); part {
+		case "alert":
+			p.Alert = true
+		case "drop", "mark", "quarantine":
+			if action != "" {
+				return Policy{}, fmt.Errorf("policy %q has more than one action", s)
+			}
+			action = part
+		default:
+			return Policy{}, fmt.Errorf("unknown policy %q, expected drop, mark or quarantine, optionally with +alert", part)
+		}
+	}
+	switch action {
+	case "mark":
+		p.Action = Mark
+	case "quarantine":
+		p.Action = Quarantine
+	}
+	return p, nil
+}
+
+func (p Policy) String() string {
+	if p.Alert {
+		return p.Action.String() + "+alert"
+	}
+	return p.Action.String()
+}
+
+type Outcome string
+
+const (
+	Forward       Outcome = "forward"
+	ForwardMarked Outcome = "forward-marked"
+	Dropped       Outcome = "drop"
+)
+
+// Decision is what the node did with one packet, and why.
+type Decision struct {
+	Flow        string
+	Outcome     Outcome
+	Reason      string `json:",omitempty"`
+	Policy      string `json:",omitempty"` // policy applied, empty when the proof verified
+	Quarantined bool   `json:",omitempty"` // the flow is quarantined at this node
+	Alerted     bool   `json:",omitempty"`
+}
+
+func (d Decision) String() string {
+	s := string(d.Outcome)
+	if d.Reason != "" {
+		s += ": " + d.Reason
+	}
+	if d.Policy != "" {
+		s += fmt.Sprintf(" (policy %v)", d.Policy)
+	}
+	if d.Alerted {
+		s += ", controller alerted"
+	}
+	return s
+}
+
+// Alert reports a failed proof to the controller.
+type Alert struct {
+	Node     string // the verifying node
+	Flow     string
+	Epoch    uint64
+	Version  uint64
+	Seq      uint64
+	Sender   string // node named in the failed proof
+	Previous string // hop the route commits before the verifier, if the verifier knows it
+	Reason   string
+	Time     time.Time
+}
+
+// Stats counts the decisions of one flow at a node.
+type Stats struct {
+	Forwarded    uint64
+	Marked       uint64
+	Dropped      uint64
+	Quarantines  uint64 // times the flow was quarantined
+	Alerts       uint64
+	LastDecision string `json:",omitempty"`
+	LastReason   string `json:",omitempty"`
+	Quarantined  string `json:",omitempty"` // why the flow is quarantined now, if it is
+}
+
+// Engine applies the policies of a node.
+type Engine struct {
+	Default Policy
+	// Alert delivers alerts to the controller; it is called outside of the engine's lock and
+	// should not block the data plane.
+	Alert func(Alert)
+
+	mu          sync.Mutex
+	policies    map[string]Policy
+	quarantined map[string]string // flow -> reason
+	stats       map[string]*Stats
+}
+
+func NewEngine(def Policy) *Engine {
+	return &Engine{
+		Default:     def,
+		policies:    make(map[string]Policy),
+		quarantined: make(map[string]string),
+		stats:       make(map[string]*Stats),
+	}
+}
+
+func (e *Engine) SetPolicy(flow string, p Policy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.policies[flow] = p
+}
+
+// SetPolicies replaces the policies of all flows.
+func (e *Engine) SetPolicies(policies map[string]Policy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.policies = policies
+}
+
+// Policy returns the policy of a flow, the default one if it has none.
+func (e *Engine) Policy(flow string) Policy {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.policyLocked(flow)
+}
+
+func (e *Engine) policyLocked(flow string) Policy {
+	if p, ok := e.policies[flow]; ok {
+		return p
+	}
+	return e.Default
+}
+
+// Decide applies the flow's policy to a packet whose proof failed with failure, or verified if
+// failure is nil. alert describes the proof; its Reason is filled in from failure.
+func (e *Engine) Decide(alert Alert, failure error) Decision {
+	e.mu.Lock()
+	flow := alert.Flow
+	stats, ok := e.stats[flow]
+	if !ok {
+		stats = &Stats{}
+		e.stats[flow] = stats
+	}
+
+	decision := Decision{Flow: flow, Outcome: Forward}
+	reason, quarantined := e.quarantined[flow]
+	switch {
+	case failure == nil && quarantined:
+		decision.Outcome = Dropped
+		decision.Reason = "flow is quarantined: " + reason
+		decision.Quarantined = true
+	case failure != nil:
+		p := e.policyLocked(flow)
+		decision.Reason = failure.Error()
+		decision.Policy = p.String()
+		switch p.Action {
+		case Drop:
+			decision.Outcome = Dropped
+		case Mark:
+			decision.Outcome = ForwardMarked
+		case Quarantine:
+			decision.Outcome = Dropped
+			decision.Quarantined = true
+			if !quarantined {
+				e.quarantined[flow] = decision.Reason
+				stats.Quarantines++
+				stats.Quarantined = decision.Reason
+			}
+		}
+		decision.Alerted = p.Alert && e.Alert != nil
+	}
+
+	switch decision.Outcome {
+	case Forward:
+		stats.Forwarded++
+	case ForwardMarked:
+		stats.Marked++
+	case Dropped:
+		stats.Dropped++
+	}
+	if decision.Alerted {
+		stats.Alerts++
+	}
+	stats.LastDecision = string(decision.Outcome)
+	stats.LastReason = decision.Reason
+	e.mu.Unlock()
+
+	if decision.Alerted {
+		alert.Reason = decision.Reason
+		if alert.Time.IsZero() {
+			alert.Time = time.Now().UTC()
+		}
+		e.Alert(alert)
+	}
+	return decision
+}
+
+// Release lifts the quarantine of a flow; it reports whether the flow was quarantined.
+func (e *Engine) Release(flow string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, ok := e.quarantined[flow]
+	delete(e.quarantined, flow)
+	if stats, found := e.stats[flow]; found {
+		stats.Quarantined = ""
+	}
+	return ok
+}
+
+// Stats returns the counters of every flow.
+func (e *Engine) Stats() map[string]Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	out := make(map[string]Stats, len(e.stats))
+	for flow, stats := range e.stats {
+		out[flow] = *stats
+	}
+	return out
+}
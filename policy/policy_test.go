@@ -0,0 +1,136 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s     string
+		want  Policy
+		valid bool
+	}{
+		{"drop", Policy{Action: Drop}, true},
+		{"mark", Policy{Action: Mark}, true},
+		{"quarantine", Policy{Action: Quarantine}, true},
+		{"alert", Policy{Action: Drop, Alert: true}, true},
+		{"mark+alert", Policy{Action: Mark, Alert: true}, true},
+		{" alert + quarantine ", Policy{Action: Quarantine, Alert: true}, true},
+		{"", Policy{}, false},
+		{"forward", Policy{}, false},
+		{"drop+mark", Policy{}, false},
+		{"mark+", Policy{}, false},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.s)
+		if (err == nil) != test.valid || got != test.want {
+			t.Errorf("%q: got %v, %v; want %v", test.s, got, err, test.want)
+		}
+		if test.valid {
+			if again, err := Parse(got.String()); err != nil || again != got {
+				t.Errorf("%q: %v does not round trip: %v, %v", test.s, got, again, err)
+			}
+		}
+	}
+}
+
+func TestDecide(t *testing.T) {
+	failure := errors.New("proof does not verify")
+	tests := []struct {
+		name        string
+		policy      Policy
+		failure     error
+		outcome     Outcome
+		quarantined bool
+		alerted     bool
+	}{
+		{"verified", Policy{Action: Drop, Alert: true}, nil, Forward, false, false},
+		{"drop", Policy{Action: Drop}, failure, Dropped, false, false},
+		{"mark", Policy{Action: Mark}, failure, ForwardMarked, false, false},
+		{"quarantine", Policy{Action: Quarantine}, failure, Dropped, true, false},
+		{"drop and alert", Policy{Action: Drop, Alert: true}, failure, Dropped, false, true},
+		{"mark and alert", Policy{Action: Mark, Alert: true}, failure, ForwardMarked, false, true},
+	}
+	for _, test := range tests {
+		var alerts []Alert
+		e := NewEngine(Policy{Action: Mark})
+		e.Alert = func(a Alert) { alerts = append(alerts, a) }
+		e.SetPolicy("f", test.policy)
+
+		d := e.Decide(Alert{Node: "C", Flow: "f", Seq: 4, Sender: "B"}, test.failure)
+		if d.Outcome != test.outcome || d.Quarantined != test.quarantined || d.Alerted != test.alerted {
+			t.Errorf("%v: got %+v", test.name, d)
+		}
+		if test.failure != nil && (d.Reason != failure.Error() || d.Policy != test.policy.String()) {
+			t.Errorf("%v: reason %q, policy %q", test.name, d.Reason, d.Policy)
+		}
+		if test.alerted {
+			if len(alerts) != 1 || alerts[0].Reason != failure.Error() || alerts[0].Sender != "B" || alerts[0].Time.IsZero() {
+				t.Errorf("%v: alerts %+v", test.name, alerts)
+			}
+		} else if len(alerts) != 0 {
+			t.Errorf("%v: alerted %+v", test.name, alerts)
+		}
+
+		stats := e.Stats()["f"]
+		if stats.LastDecision != string(test.outcome) || stats.Alerts != uint64(len(alerts)) {
+			t.Errorf("%v: stats %+v", test.name, stats)
+		}
+	}
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	e := NewEngine(Policy{Action: Mark})
+	e.SetPolicies(map[string]Policy{"f": {Action: Drop}})
+	failure := errors.New("proof does not verify")
+	if d := e.Decide(Alert{Flow: "f"}, failure); d.Outcome != Dropped {
+		t.Errorf("flow with a policy: %v", d)
+	}
+	if d := e.Decide(Alert{Flow: "g"}, failure); d.Outcome != ForwardMarked {
+		t.Errorf("flow without a policy: %v", d)
+	}
+	// without a way to reach the controller, nothing is reported alerted
+	e.SetPolicy("g", Policy{Action: Drop, Alert: true})
+	if d := e.Decide(Alert{Flow: "g"}, failure); d.Alerted {
+		t.Errorf("alerted without an Alert func: %v", d)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	e := NewEngine(Policy{Action: Quarantine})
+	first := errors.New("first failure")
+	steps := []struct {
+		name    string
+		failure error
+		release bool
+		outcome Outcome
+	}{
+		{"before the failure", nil, false, Forward},
+		{"failure", first, false, Dropped},
+		{"verified while quarantined", nil, false, Dropped},
+		{"another failure", errors.New("second failure"), false, Dropped},
+		{"released", nil, true, Forward},
+	}
+	for _, step := range steps {
+		if step.release && !e.Release("f") {
+			t.Errorf("%v: flow was not quarantined", step.name)
+		}
+		if d := e.Decide(Alert{Flow: "f"}, step.failure); d.Outcome != step.outcome {
+			t.Errorf("%v: got %v, want %v", step.name, d, step.outcome)
+		}
+	}
+	if e.Release("f") {
+		t.Error("released twice")
+	}
+
+	// the first failure is the reason of the quarantine, and it counts once
+	stats := e.Stats()["f"]
+	want := Stats{Forwarded: 2, Dropped: 3, Quarantines: 1, LastDecision: string(Forward)}
+	if stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+	if d := e.Decide(Alert{Flow: "g"}, nil); d.Outcome != Forward {
+		t.Errorf("another flow: %v", d)
+	}
+}
@@ -0,0 +1,110 @@
+package pot
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	bls12381 "github.com/kilic/bls12-381"
+
+	"example.com/kzg-demo/keystore"
+)
+
+// BLSDomain separates proof-of-transit signatures from any other use of the node keys.
+var BLSDomain = []byte("KZG-DEMO-POT-BLS12381G1_XMD:SHA-256_SSWU_RO_")
+
+// BLSHeaderSize is the size of the aggregate signature carried by a packet: one compressed G1
+// point, like a KZG proof, however long the route is.
+const BLSHeaderSize = 48
+
+// BLSKey is a node's signing key. Signatures live in G1 to keep the header small, public keys in G2.
+type BLSKey struct {
+	secret *bls12381.Fr
+	Public *bls12381.PointG2
+}
+
+func (k BLSKey) String() string {
+	return fmt.Sprintf("BLSKey{Secret: %v}", keystore.Redacted)
+}
+
+func (k BLSKey) GoString() string {
+	return k.String()
+}
+
+func NewBLSKey() (*BLSKey, error) {
+	secret, err := bls12381.NewFr().Rand(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	g2 := bls12381.NewG2()
+	public := g2.New()
+	g2.MulScalar(public, g2.One(), secret)
+	return &BLSKey{secret: secret, Public: public}, nil
+}
+
+// BLSRoute is what verifiers know about a flow: the public key of the node at every position.
+type BLSRoute struct {
+	FlowID string
+	Keys   []*bls12381.PointG2
+}
+
+// BLSHeader is the per-packet proof-of-transit data: the aggregate of the signatures of the hops
+// so far. Digest identifies the packet and is recomputed by verifiers, it is not carried.
+type BLSHeader struct {
+	Digest    [32]byte
+	Signature *bls12381.PointG1
+}
+
+// NewBLSHeader starts a packet at the ingress with an empty aggregate.
+func NewBLSHeader(packet []byte) *BLSHeader {
+	return &BLSHeader{Digest: sha256.Sum256(packet), Signature: bls12381.NewG1().Zero()}
+}
+
+// Sign adds this node's signature for the given position to the aggregate. Hop i signs
+// (flow, packet, i), so the aggregate only verifies if every position was signed by its node.
+func (k *BLSKey) Sign(flowID string, position int, header *BLSHeader) error {
+	g1 := bls12381.NewG1()
+	point, err := g1.HashToCurve(blsMessage(flowID, position, header.Digest), BLSDomain)
+	if err != nil {
+		return err
+	}
+	g1.MulScalar(point, point, k.secret)
+	g1.Add(header.Signature, header.Signature, point)
+	return nil
+}
+
+// Verify checks that all hops of the route signed the packet, with one multi-pairing of
+// len(Keys)+1 pairs. This is what the egress runs. Aggregation is commutative, so on its own it
+// cannot tell in which order the hops were visited; see VerifyPrefix.
+func (r *BLSRoute) Verify(header *BLSHeader) (bool, error) {
+	return r.VerifyPrefix(header, len(r.Keys))
+}
+
+// VerifyPrefix checks that the first n hops signed the packet. A hop verifying what it received
+// from its predecessor passes its own position, counted from 0, which enforces the order like the
+// per-hop KZG checks at the cost of one more pairing per preceding hop.
+func (r *BLSRoute) VerifyPrefix(header *BLSHeader, n int) (bool, error) {
+	if n < 1 || n > len(r.Keys) {
+		return false, fmt.Errorf("prefix of %v hops on a route of %v", n, len(r.Keys))
+	}
+	g1 := bls12381.NewG1()
+	engine := bls12381.NewEngine()
+	engine.AddPairInv(header.Signature, bls12381.NewG2().One())
+	for i := 0; i < n; i++ {
+		point, err := g1.HashToCurve(blsMessage(r.FlowID, i, header.Digest), BLSDomain)
+		if err != nil {
+			return false, err
+		}
+		engine.AddPair(point, r.Keys[i])
+	}
+	return engine.Check(), nil
+}
+
+func blsMessage(flowID string, position int, digest [32]byte) []byte {
+	msg := make([]byte, 0, len(flowID)+1+len(digest)+4)
+	msg = append(msg, flowID...)
+	msg = append(msg, 0)
+	msg = append(msg, digest[:]...)
+	return binary.BigEndian.AppendUint32(msg, uint32(position))
+}
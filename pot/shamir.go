@@ -0,0 +1,208 @@
+// Package pot implements proof-of-transit schemes that the KZG scheme is compared against.
+package pot
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"example.com/kzg-demo/keystore"
+)
+
+// Prime is the field of the Shamir scheme. The IETF SFC proof-of-transit draft carries 64-bit
+// RND and CML fields, so the largest 64-bit prime, 2^64-59, is used.
+var Prime = new(big.Int).SetUint64(18446744073709551557)
+
+// ShamirHeader is the per-packet proof-of-transit data: the random number chosen at the ingress
+// and the cumulative value updated by every hop.
+type ShamirHeader struct {
+	RND uint64
+	CML uint64
+}
+
+// ShamirHeaderSize is the encoded size of a ShamirHeader in bytes.
+const ShamirHeaderSize = 16
+
+// ShamirHop is the configuration the controller hands to one hop of a route.
+//
+// POLY-1 is the secret polynomial whose constant term only the verifier knows; the hop holds one
+// share of it. POLY-2 is public except for its constant term, which is the per-packet RND. The
+// Lagrange polynomial constant weighs the hop's contribution so that the sum over all hops
+// interpolates both polynomials at 0.
+//
+// For ordered proof-of-transit, the cumulative value travels masked between adjacent hops, so a
+// hop can only unmask what its direct predecessor sent.
+type ShamirHop struct {
+	X          uint64 // hop identifier, the x of its share
+	Share      uint64 // POLY-1(X)
+	Public     uint64 // POLY-2(X) without the constant term
+	LPC        uint64 // Lagrange polynomial constant of X at 0
+	Upstream   []byte // mask key shared with the previous hop, nil for the ingress
+	Downstream []byte // mask key shared with the next hop, nil for the egress
+}
+
+func (h ShamirHop) String() string {
+	return fmt.Sprintf("ShamirHop{X: %v, Share: %v}", h.X, keystore.Redacted)
+}
+
+func (h ShamirHop) GoString() string {
+	return h.String()
+}
+
+// ShamirRoute is the controller's view of a route: one hop configuration per position and the
+// verifier's secret, the constant term of POLY-1.
+type ShamirRoute struct {
+	Hops   []ShamirHop
+	Secret uint64
+}
+
+// NewShamirRoute prepares the polynomials, shares and masks of a route whose hops are identified
+// by xs. Like the KZG scheme, a route of n hops uses polynomials of degree n-1, so all hops are
+// needed to reconstruct the secret.
+func NewShamirRoute(xs []uint64) (*ShamirRoute, error) {
+	if len(xs) < 2 {
+		return nil, fmt.Errorf("a route needs at least 2 hops, got %v", len(xs))
+	}
+	used := make(map[uint64]bool)
+	for _, x := range xs {
+		if x == 0 || new(big.Int).SetUint64(x).Cmp(Prime) >= 0 {
+			return nil, fmt.Errorf("hop identifier %v is out of range", x)
+		}
+		if used[x] {
+			return nil, fmt.Errorf("hop identifiers must be unique")
+		}
+		used[x] = true
+	}
+
+	secretPoly, err := randomPoly(len(xs))
+	if err != nil {
+		return nil, err
+	}
+	publicPoly, err := randomPoly(len(xs))
+	if err != nil {
+		return nil, err
+	}
+	publicPoly[0] = new(big.Int) // the constant term is the per-packet RND
+
+	route := &ShamirRoute{
+		Hops:   make([]ShamirHop, len(xs)),
+		Secret: secretPoly[0].Uint64(),
+	}
+	for i, x := range xs {
+		route.Hops[i] = ShamirHop{
+			X:      x,
+			Share:  evalPoly(secretPoly, x).Uint64(),
+			Public: evalPoly(publicPoly, x).Uint64(),
+			LPC:    lagrangeConstant(xs, i).Uint64(),
+		}
+	}
+	for i := 1; i < len(xs); i++ {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		route.Hops[i-1].Downstream = key
+		route.Hops[i].Upstream = key
+	}
+	return route, nil
+}
+
+// NewShamirHeader starts a packet at the ingress with a fresh random number.
+func NewShamirHeader() (*ShamirHeader, error) {
+	rnd, err := rand.Int(rand.Reader, Prime)
+	if err != nil {
+		return nil, err
+	}
+	return &ShamirHeader{RND: rnd.Uint64()}, nil
+}
+
+// Update adds this hop's contribution to the cumulative value:
+// CML += LPC * (Share + Public + RND) mod Prime.
+func (h *ShamirHop) Update(header *ShamirHeader) {
+	cml := header.CML
+	if h.Upstream != nil {
+		cml ^= mask(h.Upstream, header.RND)
+	}
+
+	term := new(big.Int).SetUint64(h.Share)
+	term.Add(term, new(big.Int).SetUint64(h.Public))
+	term.Add(term, new(big.Int).SetUint64(header.RND))
+	term.Mul(term, new(big.Int).SetUint64(h.LPC))
+	sum := new(big.Int).SetUint64(cml)
+	sum.Add(sum, term)
+	cml = sum.Mod(sum, Prime).Uint64()
+
+	if h.Downstream != nil {
+		cml ^= mask(h.Downstream, header.RND)
+	}
+	header.CML = cml
+}
+
+// Verify checks the cumulative value after the egress hop: the hops together interpolate
+// POLY-1 + POLY-2 at 0, which is Secret + RND.
+func (r *ShamirRoute) Verify(header *ShamirHeader) bool {
+	return VerifyShamir(r.Secret, header)
+}
+
+// VerifyShamir is Verify for a verifier that only holds the secret.
+func VerifyShamir(secret uint64, header *ShamirHeader) bool {
+	expected := new(big.Int).SetUint64(secret)
+	expected.Add(expected, new(big.Int).SetUint64(header.RND))
+	expected.Mod(expected, Prime)
+	return expected.Uint64() == header.CML
+}
+
+// mask derives the per-packet mask of a hop pair, so a mask is never reused across packets.
+func mask(key []byte, rnd uint64) uint64 {
+	var data [8]byte
+	binary.LittleEndian.PutUint64(data[:], rnd)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data[:])
+	return binary.LittleEndian.Uint64(mac.Sum(nil))
+}
+
+func randomPoly(n int) ([]*big.Int, error) {
+	poly := make([]*big.Int, n)
+	for i := range poly {
+		coeff, err := rand.Int(rand.Reader, Prime)
+		if err != nil {
+			return nil, err
+		}
+		poly[i] = coeff
+	}
+	return poly, nil
+}
+
+func evalPoly(poly []*big.Int, x uint64) *big.Int {
+	bx := new(big.Int).SetUint64(x)
+	y := new(big.Int)
+	for i := len(poly) - 1; i >= 0; i-- {
+		y.Mul(y, bx)
+		y.Add(y, poly[i])
+		y.Mod(y, Prime)
+	}
+	return y
+}
+
+// lagrangeConstant returns prod_{j != i} x_j / (x_j - x_i) mod Prime, the value of the i-th
+// Lagrange basis polynomial at 0.
+func lagrangeConstant(xs []uint64, i int) *big.Int {
+	num := big.NewInt(1)
+	den := big.NewInt(1)
+	xi := new(big.Int).SetUint64(xs[i])
+	for j, x := range xs {
+		if j == i {
+			continue
+		}
+		xj := new(big.Int).SetUint64(x)
+		num.Mul(num, xj)
+		num.Mod(num, Prime)
+		diff := new(big.Int).Sub(xj, xi)
+		den.Mul(den, diff.Mod(diff, Prime))
+		den.Mod(den, Prime)
+	}
+	return num.Mul(num, den.ModInverse(den, Prime)).Mod(num, Prime)
+}
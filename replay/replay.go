@@ -0,0 +1,156 @@
+// Package replay detects replayed proofs at a verifier. The ingress numbers the packets of a flow,
+// every hop carries the number in its proof, and each verifier keeps a sliding window over the
+// numbers it has accepted, as IPsec does (RFC 4303, section 3.4.3): a number is accepted once,
+// numbers ahead of the window slide it forward, and numbers that fell behind it are refused.
+//
+// The window takes the number as the proof states it, so callers feed it only numbers they have
+// authenticated. Only a chained proof checked against the packet digest authenticates it: the
+// number is covered by the chain link, see types.ChainLink, and re-binding a renumbered proof
+// takes the previous hop's hop key. A number that was not checked this way could be anything,
+// and one far ahead, e.g., the largest, would slide the window past every real packet.
+package replay
+
+import (
+	"errors"
+	"sync"
+)
+
+// DefaultWindow is the window size used by agents unless configured otherwise, as in IPsec.
+const DefaultWindow = 64
+
+var (
+	ErrUnsequenced = errors.New("proof carries no sequence number")
+	ErrReplayed    = errors.New("sequence number was already accepted")
+	ErrTooOld      = errors.New("sequence number is behind the replay window")
+)
+
+// Window is the anti-replay window of one flow. Sequence numbers start from 1.
+type Window struct {
+	size   uint64
+	top    uint64   // highest sequence number accepted, 0 before the first one
+	bitmap []uint64 // bit i is set if top-i was accepted
+}
+
+func NewWindow(size int) *Window {
+	size = max(size, 1)
+	return &Window{size: uint64(size), bitmap: make([]uint64, (size+63)/64)}
+}
+
+func (w *Window) bit(offset uint64) (word int, mask uint64) {
+	return int(offset / 64), uint64(1) << (offset % 64)
+}
+
+// Check reports whether seq would be accepted, without recording it.
+func (w *Window) Check(seq uint64) error {
+	switch {
+	case seq == 0:
+		return ErrUnsequenced
+	case seq > w.top:
+		return nil
+	case w.top-seq >= w.size:
+		return ErrTooOld
+	}
+	word, mask := w.bit(w.top - seq)
+	if w.bitmap[word]&mask != 0 {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// Accept records seq if Check accepts it. Call it only after the proof itself verified, so that
+// forged proofs cannot move the window.
+func (w *Window) Accept(seq uint64) error {
+	if err := w.Check(seq); err != nil {
+		return err
+	}
+	if seq > w.top {
+		w.shift(seq - w.top)
+		w.top = seq
+	}
+	word, mask := w.bit(w.top - seq)
+	w.bitmap[word] |= mask
+	return nil
+}
+
+// shift moves the window forward by n positions.
+func (w *Window) shift(n uint64) {
+	if n >= w.size {
+		clear(w.bitmap)
+		return
+	}
+	words, bits := int(n/64), n%64
+	for i := len(w.bitmap) - 1; i >= 0; i-- {
+		var v uint64
+		if j := i - words; j >= 0 {
+			v = w.bitmap[j] << bits
+			if bits > 0 && j > 0 {
+				v |= w.bitmap[j-1] >> (64 - bits)
+			}
+		}
+		w.bitmap[i] = v
+	}
+}
+
+// Stats counts the decisions of a detector for one flow.
+type Stats struct {
+	Accepted    uint64
+	Replayed    uint64
+	TooOld      uint64
+	Unsequenced uint64
+}
+
+// Detector keeps a window for every flow a verifier sees. A flow may need several windows whose
+// numbering is independent, e.g., one per epoch or per visit of a node; scope tells them apart.
+type Detector struct {
+	Size int
+
+	mu      sync.Mutex
+	windows map[string]*Window
+	stats   map[string]*Stats
+}
+
+func NewDetector(size int) *Detector {
+	return &Detector{Size: size, windows: make(map[string]*Window), stats: make(map[string]*Stats)}
+}
+
+// Accept checks and records the sequence number of a verified proof.
+func (d *Detector) Accept(flow string, scope string, seq uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := flow + "/" + scope
+	window, ok := d.windows[key]
+	if !ok {
+		window = NewWindow(d.Size)
+		d.windows[key] = window
+	}
+	stats, ok := d.stats[flow]
+	if !ok {
+		stats = &Stats{}
+		d.stats[flow] = stats
+	}
+	err := window.Accept(seq)
+	switch {
+	case err == nil:
+		stats.Accepted++
+	case errors.Is(err, ErrReplayed):
+		stats.Replayed++
+	case errors.Is(err, ErrTooOld):
+		stats.TooOld++
+	case errors.Is(err, ErrUnsequenced):
+		stats.Unsequenced++
+	}
+	return err
+}
+
+// Stats returns the counters of every flow.
+func (d *Detector) Stats() map[string]Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make(map[string]Stats, len(d.stats))
+	for flow, stats := range d.stats {
+		out[flow] = *stats
+	}
+	return out
+}
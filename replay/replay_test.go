@@ -0,0 +1,71 @@
+package replay
+
+import (
+	"errors"
+	"testing"
+
+	"example.com/kzg-demo/kzgtest"
+	"example.com/kzg-demo/types"
+)
+
+func TestWindow(t *testing.T) {
+	w := NewWindow(128)
+	steps := []struct {
+		seq  uint64
+		want error
+	}{
+		{0, ErrUnsequenced},
+		{1, nil},
+		{1, ErrReplayed},
+		{3, nil},
+		{2, nil},
+		{2, ErrReplayed},
+		{200, nil}, // slides the window past 1, 2 and 3
+		{3, ErrTooOld},
+		{73, nil},
+		{72, ErrTooOld},
+		{230, nil}, // shifts by less than a word
+		{73, ErrTooOld},
+		{130, nil},
+		{130, ErrReplayed},
+		{200, ErrReplayed}, // kept across the shift
+	}
+	for i, step := range steps {
+		if err := w.Accept(step.seq); !errors.Is(err, step.want) {
+			t.Errorf("step %v: seq %v: got %v, want %v", i, step.seq, err, step.want)
+		}
+	}
+}
+
+// A replay renumbered past the window gets through the window; only the chain link, checked
+// against the packet, catches it.
+func TestRenumberedReplay(t *testing.T) {
+	f, err := kzgtest.NewFixture(4, 48)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := types.PacketDigest([]byte("packet"))
+	// a hop in the middle of the route, whose link covers its predecessor's
+	proof, public := f.Chain(packet)[2], f.Public[2]
+
+	d := NewDetector(DefaultWindow)
+	if err := d.Accept("f", "0", proof.Seq); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Accept("f", "0", proof.Seq); !errors.Is(err, ErrReplayed) {
+		t.Errorf("replay with the same number: got %v", err)
+	}
+
+	renumbered := *proof
+	renumbered.Seq = 2
+	if err := d.Accept("f", "0", renumbered.Seq); err != nil {
+		t.Errorf("the window refused a fresh number: %v", err)
+	}
+	if renumbered.CheckLink(public, packet) {
+		t.Error("renumbered proof kept its chain link")
+	}
+	renumbered.Chain = types.ChainLink(renumbered.Prev, packet, &renumbered)
+	if renumbered.CheckLink(public, packet) {
+		t.Error("renumbered proof re-hashed without the hop key checked")
+	}
+}
@@ -0,0 +1,277 @@
+// Package reputation scores nodes by the verification failures other nodes report about them.
+// A verifier reports the proofs it refused, see policy.Alert; each report is attributed to the
+// upstream hop that handed the packet over, and counts against it for a window of time. A node
+// with as many recent failures as the threshold is flagged, once, so that the controller can
+// route around it or revoke it.
+//
+// An alert is only attributed if its reporter verifies a hop of the committed route and blames
+// the hop committed just before it, see Attribute; the controller also authenticates the
+// reporter. That still lets a verifier frame its own predecessor. Tracker.MinReporters counts
+// distinct verifiers, and a hop has one successor per route, so it does not stop a single framing
+// node. Reports from flagged nodes are ignored.
+package reputation
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"example.com/kzg-demo/policy"
+)
+
+// Action is what the controller does with a flagged node.
+type Action int
+
+const (
+	Reroute Action = iota // re-commit the flows through the node on routes that avoid it
+	Revoke                // revoke the node, then reroute its flows
+)
+
+func (a Action) String() string {
+	switch a {
+	case Reroute:
+		return "reroute"
+	case Revoke:
+		return "revoke"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+func ParseAction(s string) (Action, error) {
+	switch s {
+	case "reroute":
+		return Reroute, nil
+	case "revoke":
+		return Revoke, nil
+	}
+	return 0, fmt.Errorf("unknown action %q, expected reroute or revoke", s)
+}
+
+// Report is one failure a verifier attributes to another node.
+type Report struct {
+	Reporter string // the verifying node
+	Suspect  string // the upstream hop blamed for the failure
+	Flow     string
+	Reason   string
+	Time     time.Time
+}
+
+// Attribute blames the upstream hop of an alert on a flow committed along route. The reporter
+// must verify a hop of the route, i.e., visit it after the first position, and the suspect must
+// be the hop the route commits just before one of its visits: the node named in the failed proof,
+// or the reporter's predecessor if the proof names none. Neither is authenticated, so an alert
+// naming any other node, e.g., after a skipped hop, is refused rather than counted.
+func Attribute(alert policy.Alert, route []string) (Report, error) {
+	var predecessors []string
+	for i := 1; i < len(route); i++ {
+		if route[i] == alert.Node {
+			predecessors = append(predecessors, route[i-1])
+		}
+	}
+	if len(predecessors) == 0 {
+		return Report{}, fmt.Errorf("%v verifies no hop of flow %v", alert.Node, alert.Flow)
+	}
+	suspect := alert.Sender
+	if suspect == "" {
+		suspect = alert.Previous
+	}
+	if suspect == "" && !slices.ContainsFunc(predecessors, func(p string) bool { return p != predecessors[0] }) {
+		suspect = predecessors[0]
+	}
+	if !slices.Contains(predecessors, suspect) {
+		return Report{}, fmt.Errorf("%v is not the hop before %v on flow %v", suspect, alert.Node, alert.Flow)
+	}
+	return Report{Reporter: alert.Node, Suspect: suspect, Flow: alert.Flow, Reason: alert.Reason, Time: alert.Time}, nil
+}
+
+// Reputation is the standing of one node.
+type Reputation struct {
+	Node       string
+	Score      float64  // 1 without recent failures, 0 at the threshold
+	Recent     int      // failures reported within the window
+	Failures   uint64   // failures reported in total
+	Reporters  []string // distinct nodes that reported it
+	LastReason string   `json:",omitempty"`
+	LastReport time.Time
+	Flagged    bool // the node reached the threshold and was handed to the controller
+}
+
+func (r Reputation) String() string {
+	s := fmt.Sprintf("%v: score %.2f, %v failures reported by %v", r.Node, r.Score, r.Failures, r.Reporters)
+	if r.Flagged {
+		s += ", flagged"
+	}
+	return s
+}
+
+type standing struct {
+	recent     []time.Time // times of the failures within the window, oldest first
+	failures   uint64
+	reporters  map[string]bool
+	lastReason string
+	lastReport time.Time
+	flagged    bool
+}
+
+// expire drops the failures that fell out of the window ending at now.
+func (st *standing) expire(now time.Time, window time.Duration) {
+	if window <= 0 {
+		return
+	}
+	i := 0
+	for i < len(st.recent) && !st.recent[i].After(now.Add(-window)) {
+		i++
+	}
+	st.recent = st.recent[i:]
+}
+
+// Tracker keeps the reputation of every node reported so far.
+type Tracker struct {
+	// Threshold is the number of failures within the window at which a node is flagged.
+	Threshold int
+	// Window is how long a failure counts against a node; failures never expire if zero.
+	Window time.Duration
+	// MinReporters is the number of distinct verifiers that must have reported a node before it
+	// is flagged.
+	MinReporters int
+
+	mu    sync.Mutex
+	nodes map[string]*standing
+}
+
+func NewTracker(threshold int, window time.Duration) *Tracker {
+	return &Tracker{Threshold: threshold, Window: window, MinReporters: 1, nodes: make(map[string]*standing)}
+}
+
+// Observe counts a report against its suspect. It returns the suspect's reputation, and whether
+// the report made the suspect cross the threshold; that happens once per node until Reset.
+func (t *Tracker) Observe(r Report) (Reputation, bool, error) {
+	if r.Suspect == "" {
+		return Reputation{}, false, fmt.Errorf("report from %v names no upstream hop", r.Reporter)
+	}
+	if r.Suspect == r.Reporter {
+		return Reputation{}, false, fmt.Errorf("%v reported itself", r.Reporter)
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if reporter, ok := t.nodes[r.Reporter]; ok && reporter.flagged {
+		return Reputation{}, false, fmt.Errorf("ignoring report from flagged node %v", r.Reporter)
+	}
+	st, ok := t.nodes[r.Suspect]
+	if !ok {
+		st = &standing{reporters: make(map[string]bool)}
+		t.nodes[r.Suspect] = st
+	}
+	st.expire(r.Time, t.Window)
+	st.recent = append(st.recent, r.Time)
+	st.failures++
+	st.reporters[r.Reporter] = true
+	st.lastReason = r.Reason
+	st.lastReport = r.Time
+
+	crossed := false
+	if !st.flagged && len(st.recent) >= t.Threshold && len(st.reporters) >= t.MinReporters {
+		st.flagged = true
+		crossed = true
+	}
+	return t.reputationLocked(r.Suspect, st), crossed, nil
+}
+
+func (t *Tracker) reputationLocked(node string, st *standing) Reputation {
+	score := 1.0
+	if t.Threshold > 0 {
+		score = max(0, 1-float64(len(st.recent))/float64(t.Threshold))
+	}
+	reporters := make([]string, 0, len(st.reporters))
+	for reporter := range st.reporters {
+		reporters = append(reporters, reporter)
+	}
+	sort.Strings(reporters)
+	return Reputation{
+		Node:       node,
+		Score:      score,
+		Recent:     len(st.recent),
+		Failures:   st.failures,
+		Reporters:  reporters,
+		LastReason: st.lastReason,
+		LastReport: st.lastReport,
+		Flagged:    st.flagged,
+	}
+}
+
+// Reputations returns the reputation of every reported node as of now, sorted by node.
+func (t *Tracker) Reputations(now time.Time) []Reputation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	nodes := make([]string, 0, len(t.nodes))
+	for node := range t.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	reputations := make([]Reputation, 0, len(nodes))
+	for _, node := range nodes {
+		st := t.nodes[node]
+		st.expire(now, t.Window)
+		reputations = append(reputations, t.reputationLocked(node, st))
+	}
+	return reputations
+}
+
+// Flagged reports whether a node crossed the threshold.
+func (t *Tracker) Flagged(node string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.nodes[node]
+	return ok && st.flagged
+}
+
+// Reset forgets the failures of a node, e.g., after the operator fixed it; it reports whether the
+// node had any.
+func (t *Tracker) Reset(node string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.nodes[node]
+	delete(t.nodes, node)
+	return ok
+}
+
+// Avoid returns a route without suspect: every visit of it is replaced by the first spare not on
+// the route yet, or left out if there are no spares and the route keeps at least three hops.
+func Avoid(route []string, suspect string, spares []string) ([]string, error) {
+	onRoute := make(map[string]bool)
+	for _, hop := range route {
+		onRoute[hop] = true
+	}
+	replacement := ""
+	for _, spare := range spares {
+		if spare != suspect && !onRoute[spare] {
+			replacement = spare
+			break
+		}
+	}
+
+	avoided := make([]string, 0, len(route))
+	for _, hop := range route {
+		switch {
+		case hop != suspect:
+			avoided = append(avoided, hop)
+		case replacement != "":
+			avoided = append(avoided, replacement)
+		}
+	}
+	if len(avoided) < 3 {
+		return nil, fmt.Errorf("no route avoids %v: no spare node, and %v hops would be left", suspect, len(avoided))
+	}
+	return avoided, nil
+}
@@ -0,0 +1,197 @@
+package reputation
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"example.com/kzg-demo/policy"
+)
+
+func TestAttribute(t *testing.T) {
+	route := []string{"A", "B", "C", "B", "D"}
+	tests := []struct {
+		name    string
+		alert   policy.Alert
+		suspect string // empty if refused
+	}{
+		{"sender", policy.Alert{Node: "C", Flow: "f", Sender: "B"}, "B"},
+		{"previous", policy.Alert{Node: "C", Flow: "f", Previous: "B"}, "B"},
+		{"predecessor from the route", policy.Alert{Node: "D", Flow: "f"}, "B"},
+		{"either predecessor of a node visited twice", policy.Alert{Node: "B", Flow: "f", Sender: "C"}, "C"},
+		{"ambiguous predecessor", policy.Alert{Node: "B", Flow: "f"}, ""},
+		{"first hop", policy.Alert{Node: "A", Flow: "f", Sender: "D"}, ""},
+		{"reporter off the route", policy.Alert{Node: "E", Flow: "f", Sender: "D"}, ""},
+		{"skipped hop", policy.Alert{Node: "D", Flow: "f", Sender: "C"}, ""},
+	}
+	for _, test := range tests {
+		r, err := Attribute(test.alert, route)
+		if test.suspect == "" {
+			if err == nil {
+				t.Errorf("%v: attributed to %v", test.name, r.Suspect)
+			}
+			continue
+		}
+		if err != nil || r.Suspect != test.suspect || r.Reporter != test.alert.Node {
+			t.Errorf("%v: got %+v, %v; want %v", test.name, r, err, test.suspect)
+		}
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		threshold    int
+		window       time.Duration
+		minReporters int
+		reports      []Report
+		crossed      int // report that flags B, -1 if none does
+		recent       int // failures against B within the window at the last report
+	}{
+		{
+			"at the threshold", 2, time.Hour, 1,
+			[]Report{{Reporter: "C", Suspect: "B"}, {Reporter: "C", Suspect: "B"}, {Reporter: "C", Suspect: "B"}},
+			1, 3,
+		},
+		{
+			"below the threshold", 3, time.Hour, 1,
+			[]Report{{Reporter: "C", Suspect: "B"}, {Reporter: "C", Suspect: "B"}},
+			-1, 2,
+		},
+		{
+			"failures expire", 2, time.Minute, 1,
+			[]Report{{Reporter: "C", Suspect: "B"}, {Reporter: "C", Suspect: "B", Time: start.Add(2 * time.Minute)}},
+			-1, 1,
+		},
+		{
+			"failures never expire without a window", 2, 0, 1,
+			[]Report{{Reporter: "C", Suspect: "B"}, {Reporter: "C", Suspect: "B", Time: start.Add(24 * time.Hour)}},
+			1, 2,
+		},
+		{
+			"too few reporters", 2, time.Hour, 2,
+			[]Report{{Reporter: "C", Suspect: "B"}, {Reporter: "C", Suspect: "B"}, {Reporter: "C", Suspect: "B"}},
+			-1, 3,
+		},
+		{
+			"enough reporters", 2, time.Hour, 2,
+			[]Report{{Reporter: "C", Suspect: "B"}, {Reporter: "C", Suspect: "B"}, {Reporter: "D", Suspect: "B"}},
+			2, 3,
+		},
+		{
+			"other suspects do not count", 2, time.Hour, 1,
+			[]Report{{Reporter: "C", Suspect: "B"}, {Reporter: "D", Suspect: "C"}, {Reporter: "C", Suspect: "B"}},
+			2, 2,
+		},
+	}
+	for _, test := range tests {
+		tracker := NewTracker(test.threshold, test.window)
+		tracker.MinReporters = test.minReporters
+		crossed := -1
+		var last Reputation
+		for i, r := range test.reports {
+			if r.Time.IsZero() {
+				r.Time = start.Add(time.Duration(i) * time.Second)
+			}
+			rep, ok, err := tracker.Observe(r)
+			if err != nil {
+				t.Fatalf("%v: report %v: %v", test.name, i, err)
+			}
+			if ok {
+				if crossed >= 0 {
+					t.Errorf("%v: flagged again at report %v", test.name, i)
+				}
+				crossed = i
+			}
+			if r.Suspect == "B" {
+				last = rep
+			}
+		}
+		if crossed != test.crossed {
+			t.Errorf("%v: flagged at report %v, want %v", test.name, crossed, test.crossed)
+		}
+		if last.Recent != test.recent || last.Flagged != (test.crossed >= 0) || tracker.Flagged("B") != last.Flagged {
+			t.Errorf("%v: got %v", test.name, last)
+		}
+		if want := max(0, 1-float64(test.recent)/float64(test.threshold)); last.Score != want {
+			t.Errorf("%v: score %v, want %v", test.name, last.Score, want)
+		}
+	}
+}
+
+func TestObserve(t *testing.T) {
+	tracker := NewTracker(1, time.Hour)
+	now := time.Now()
+	if _, _, err := tracker.Observe(Report{Reporter: "C", Time: now}); err == nil {
+		t.Error("report without a suspect counted")
+	}
+	if _, _, err := tracker.Observe(Report{Reporter: "C", Suspect: "C", Time: now}); err == nil {
+		t.Error("self-report counted")
+	}
+	if _, crossed, err := tracker.Observe(Report{Reporter: "C", Suspect: "B", Reason: "bad proof", Time: now}); err != nil || !crossed {
+		t.Fatalf("first report: %v, %v", crossed, err)
+	}
+	// a flagged node can no longer frame others
+	if _, _, err := tracker.Observe(Report{Reporter: "B", Suspect: "A", Time: now}); err == nil {
+		t.Error("report from a flagged node counted")
+	}
+
+	reputations := tracker.Reputations(now.Add(2 * time.Hour))
+	if len(reputations) != 1 {
+		t.Fatalf("reputations %v", reputations)
+	}
+	got := reputations[0]
+	if got.Node != "B" || got.Recent != 0 || got.Failures != 1 || got.Score != 1 || !got.Flagged ||
+		!slices.Equal(got.Reporters, []string{"C"}) || got.LastReason != "bad proof" {
+		t.Errorf("after the window: %v", got)
+	}
+
+	if !tracker.Reset("B") || tracker.Reset("B") {
+		t.Error("reset did not forget B exactly once")
+	}
+	if tracker.Flagged("B") {
+		t.Error("B still flagged after a reset")
+	}
+	if _, crossed, err := tracker.Observe(Report{Reporter: "B", Suspect: "A", Time: now}); err != nil || !crossed {
+		t.Errorf("report from B after its reset: %v, %v", crossed, err)
+	}
+}
+
+func TestAvoid(t *testing.T) {
+	tests := []struct {
+		name   string
+		route  []string
+		spares []string
+		want   []string // nil if no route avoids B
+	}{
+		{"spare", []string{"A", "B", "C"}, []string{"B", "A", "D"}, []string{"A", "D", "C"}},
+		{"every visit replaced", []string{"A", "B", "C", "B"}, []string{"D"}, []string{"A", "D", "C", "D"}},
+		{"left out", []string{"A", "B", "C", "D"}, nil, []string{"A", "C", "D"}},
+		{"too short", []string{"A", "B", "C"}, []string{"C"}, nil},
+		{"not on the route", []string{"A", "C", "D"}, nil, []string{"A", "C", "D"}},
+	}
+	for _, test := range tests {
+		got, err := Avoid(test.route, "B", test.spares)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("%v: got %v", test.name, got)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, test.want) {
+			t.Errorf("%v: got %v, %v; want %v", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	for _, action := range []Action{Reroute, Revoke} {
+		if got, err := ParseAction(action.String()); err != nil || got != action {
+			t.Errorf("%v: got %v, %v", action, got, err)
+		}
+	}
+	if _, err := ParseAction("ban"); err == nil {
+		t.Error("unknown action parsed")
+	}
+}
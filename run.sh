@@ -79,11 +79,11 @@ function main() {
   done
   tmux select-pane -t "$SESSION:0.0"
 
-  # run the program
-  tmux new-session -s "$PROG_SESSION" -d "/usr/local/go/bin/go run main.go; echo Program terminated; sleep infinity"
+  # run the program, forwarding the arguments of this script, e.g., -pad-degree 8
+  tmux new-session -s "$PROG_SESSION" -d "/usr/local/go/bin/go run main.go $*; echo Program terminated; sleep infinity"
 
   # show demonstration window
   tmux attach-session -t "$SESSION"
 }
 
-main
+main "$@"
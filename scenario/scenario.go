@@ -0,0 +1,264 @@
+// Package scenario runs scripted attacks against the KZG route demo and checks each verdict
+// against the expected one, so the security properties of the scheme can be shown and
+// regression-tested without typing routes by hand.
+//
+// A run follows the demo: the controller sets up and signs the route, the nodes check the
+// signature, every hop verifies its predecessor's opening and chain link and adds its own, and the
+// egress checks the whole chain against the packet and diagnoses it against the intended route.
+package scenario
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	mrand "math/rand"
+	"strings"
+
+	"example.com/kzg-demo/diagnose"
+	"example.com/kzg-demo/replay"
+	"example.com/kzg-demo/types"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+type Verdict int
+
+const (
+	Accepted Verdict = iota
+	Rejected
+)
+
+func (v Verdict) String() string {
+	if v == Accepted {
+		return "accepted"
+	}
+	return "rejected"
+}
+
+// Outsider is a node that is not on any scenario route.
+const Outsider = "X"
+
+// Scenario is one scripted run. Attack builds the chain of proofs the egress receives, and may
+// tamper with the world before the nodes check their parameters.
+type Scenario struct {
+	Name        string
+	Description string
+	Route       string // intended route, one letter per node
+	Expect      Verdict
+	// ExpectKind is the first finding of the egress diagnosis for rejected paths, when the path
+	// gets that far.
+	ExpectKind diagnose.Kind
+	Attack     func(w *World) []*types.Proof
+}
+
+// World is the state of one run: the committed route, the node secrets and the packet.
+type World struct {
+	Route         []string
+	Controller    types.Controller
+	Public        types.PublicStorage
+	ControllerKey ed25519.PublicKey
+	Secrets       map[string]uint64             // every route node and the Outsider
+	HopKeys       map[string]ed25519.PrivateKey // keys the nodes sign their chain links with
+	Packet        []byte
+	Seq           uint64 // sequence number the ingress gave the packet
+	Intended      *diagnose.Route
+	Colluding     map[string]bool             // nodes that accept whatever their predecessor sends
+	Replay        map[string]*replay.Detector // replay windows of the verifying nodes
+}
+
+func newWorld(route string) (*World, error) {
+	w := &World{Route: strings.Split(route, ""), Secrets: make(map[string]uint64), HopKeys: make(map[string]ed25519.PrivateKey),
+		Seq: 1, Colluding: make(map[string]bool), Replay: make(map[string]*replay.Detector)}
+	keys := make(map[string]ed25519.PublicKey)
+	used := make(map[uint64]bool)
+	for _, name := range append(append([]string(nil), w.Route...), Outsider) {
+		if _, ok := w.HopKeys[name]; !ok {
+			public, key, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, err
+			}
+			w.HopKeys[name] = key
+			keys[name] = public
+		}
+		for w.Secrets[name] == 0 {
+			secret := uint64(mrand.Int31())
+			if !used[secret] {
+				used[secret] = true
+				w.Secrets[name] = secret
+			}
+		}
+	}
+
+	nodesPrivateData := make([]uint32, len(w.Route))
+	for i, name := range w.Route {
+		nodesPrivateData[i] = uint32(w.Secrets[name])
+	}
+	if _, _, err := w.Controller.Setup(nodesPrivateData); err != nil {
+		return nil, err
+	}
+	w.Public = types.PublicStorage{KzgSettings: w.Controller.KzgSettings, PolynomialCommitment: w.Controller.Commit()}
+	controllerKey, signingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	w.ControllerKey = controllerKey
+	w.Public.Sign(signingKey, "scenario", 0, 0)
+
+	w.Packet = w.NewPacket()
+	w.Intended = &diagnose.Route{
+		Nodes:      w.Route,
+		Ys:         make([]bls.Fr, len(w.Route)),
+		Commitment: w.Public.PolynomialCommitment,
+		Settings:   w.Public.KzgSettings,
+		Keys:       keys,
+	}
+	for i := range w.Route {
+		bls.CopyFr(&w.Intended.Ys[i], w.Controller.Position(i))
+	}
+	return w, nil
+}
+
+// RouteKeys returns the hop keys the egress checks the chain links with, in route order.
+func (w *World) RouteKeys() []ed25519.PublicKey {
+	keys := make([]ed25519.PublicKey, len(w.Route))
+	for i, name := range w.Route {
+		keys[i] = w.Intended.Keys[name]
+	}
+	return keys
+}
+
+func (w *World) NewPacket() []byte {
+	packet := make([]byte, 64)
+	if _, err := rand.Read(packet); err != nil {
+		panic(err)
+	}
+	return packet
+}
+
+// position returns the intended position of a node, from 1; 0 if it is not on the route.
+func (w *World) position(name string) int {
+	for i, hop := range w.Route {
+		if hop == name {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Open computes the opening of node name at secret x with the committed polynomial, claiming the
+// position of name, or the next position for the Outsider, and chains it to prev and the packet
+// with the hop key of name.
+func (w *World) Open(name string, x uint64, prev *types.Proof, packet []byte) *types.Proof {
+	position := w.position(name)
+	if position == 0 {
+		position = min(len(w.Route), 1+w.position(prev.Node))
+	}
+	var xFr bls.Fr
+	bls.AsFr(&xFr, x)
+	proof := &types.Proof{
+		FlowID: "scenario",
+		Node:   name,
+		X:      xFr.String(),
+		Y:      w.Controller.Position(position - 1).String(),
+		Proof:  w.Public.KzgSettings.ComputeProofSingle(w.Controller.Polynomial, x),
+		Seq:    w.Seq,
+	}
+	var chain []byte
+	if prev != nil {
+		chain = prev.Chain
+	}
+	proof.Bind(w.HopKeys[name], chain, types.PacketDigest(packet))
+	return proof
+}
+
+// Hop is an honest hop: it proves with its own secret for the run's packet.
+func (w *World) Hop(name string, prev *types.Proof) *types.Proof {
+	return w.Open(name, w.Secrets[name], prev, w.Packet)
+}
+
+// Honest is the path the named nodes produce for the run's packet.
+func (w *World) Honest(names ...string) []*types.Proof {
+	path := make([]*types.Proof, 0, len(names))
+	var prev *types.Proof
+	for _, name := range names {
+		prev = w.Hop(name, prev)
+		path = append(path, prev)
+	}
+	return path
+}
+
+// Result is the outcome of one scenario.
+type Result struct {
+	Scenario Scenario
+	Verdict  Verdict
+	Reason   string // why the path was rejected, or what the egress concluded
+	Report   *diagnose.Report
+	Passed   bool
+}
+
+func (r Result) String() string {
+	status := "PASS"
+	if !r.Passed {
+		status = "FAIL"
+	}
+	return fmt.Sprintf("[%v] %v: expected %v, got %v: %v", status, r.Scenario.Name, r.Scenario.Expect, r.Verdict, r.Reason)
+}
+
+// Run plays a scenario and compares the verdict with the expected one.
+func Run(s Scenario) (Result, error) {
+	w, err := newWorld(s.Route)
+	if err != nil {
+		return Result{}, err
+	}
+	path := s.Attack(w)
+	result := Result{Scenario: s}
+	result.Verdict, result.Reason, result.Report = w.Deliver(path)
+
+	result.Passed = result.Verdict == s.Expect
+	if result.Passed && s.Expect == Rejected && result.Report != nil && s.ExpectKind != diagnose.OK {
+		result.Passed = len(result.Report.Findings) > 0 && result.Report.Findings[0].Kind == s.ExpectKind
+	}
+	return result, nil
+}
+
+// Deliver runs the checks of the demo over a path. The replay windows of the nodes keep what they
+// accepted, so an attack can deliver earlier packets first.
+func (w *World) Deliver(path []*types.Proof) (Verdict, string, *diagnose.Report) {
+	if !w.Public.Verify(w.ControllerKey, "scenario", 0, 0) {
+		return Rejected, "the nodes refused parameters that are not signed by the controller", nil
+	}
+
+	digest := types.PacketDigest(w.Packet)
+	reasons := make([]string, 0)
+	for j := 1; j < len(path); j++ {
+		verifier := path[j].Node
+		expected := w.position(verifier) - 1
+		if expected < 0 || w.Colluding[verifier] {
+			// a node off the route, or a colluding one, forwards without verifying
+			continue
+		}
+		if finding := diagnose.DiagnoseHop(w.Intended, expected, path[j-1], digest); finding.Kind != diagnose.OK {
+			reasons = append(reasons, fmt.Sprintf("%v refused %v's proof: %v", verifier, path[j-1].Node, finding))
+			continue
+		}
+		detector, ok := w.Replay[verifier]
+		if !ok {
+			detector = replay.NewDetector(replay.DefaultWindow)
+			w.Replay[verifier] = detector
+		}
+		if err := detector.Accept("scenario", "0", path[j-1].Seq); err != nil {
+			reasons = append(reasons, fmt.Sprintf("%v refused %v's proof: sequence number %v: %v", verifier, path[j-1].Node, path[j-1].Seq, err))
+		}
+	}
+
+	report := diagnose.Diagnose(w.Intended, path, digest)
+	if err := types.CheckChain(w.RouteKeys(), path, digest); err != nil {
+		reasons = append(reasons, "egress: "+err.Error())
+	}
+	if !report.OK() {
+		reasons = append(reasons, "egress: "+report.Findings[0].String())
+	}
+	if len(reasons) > 0 {
+		return Rejected, strings.Join(reasons, "; "), report
+	}
+	return Accepted, "every hop and the egress accepted the path", report
+}
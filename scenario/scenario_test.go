@@ -0,0 +1,17 @@
+package scenario
+
+import "testing"
+
+func TestScenarios(t *testing.T) {
+	for _, s := range All() {
+		t.Run(s.Name, func(t *testing.T) {
+			result, err := Run(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Passed {
+				t.Error(result)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package scenario
+
+import (
+	mrand "math/rand"
+	"strconv"
+
+	"example.com/kzg-demo/diagnose"
+	"example.com/kzg-demo/types"
+)
+
+// All returns the built-in scenarios, honest run first.
+func All() []Scenario {
+	return []Scenario{
+		{
+			Name:        "honest",
+			Description: "every node of the route proves in order",
+			Route:       "ABCD",
+			Expect:      Accepted,
+			Attack: func(w *World) []*types.Proof {
+				return w.Honest("A", "B", "C", "D")
+			},
+		},
+		{
+			Name:        "skip",
+			Description: "B forwards straight to D, C never sees the packet",
+			Route:       "ABCD",
+			Expect:      Rejected,
+			ExpectKind:  diagnose.SkippedHop,
+			Attack: func(w *World) []*types.Proof {
+				return w.Honest("A", "B", "D")
+			},
+		},
+		{
+			Name:        "insert",
+			Description: "the packet takes a detour through X, which proves with its own secret",
+			Route:       "ABCD",
+			Expect:      Rejected,
+			ExpectKind:  diagnose.InsertedNode,
+			Attack: func(w *World) []*types.Proof {
+				return w.Honest("A", "B", Outsider, "C", "D")
+			},
+		},
+		{
+			Name:        "reorder",
+			Description: "the packet visits C before B",
+			Route:       "ABCD",
+			Expect:      Rejected,
+			ExpectKind:  diagnose.ReorderedHops,
+			Attack: func(w *World) []*types.Proof {
+				return w.Honest("A", "C", "B", "D")
+			},
+		},
+		{
+			Name:        "forge",
+			Description: "B does not know its secret and opens the polynomial at a guessed point",
+			Route:       "ABCD",
+			Expect:      Rejected,
+			ExpectKind:  diagnose.WrongCommitment,
+			Attack: func(w *World) []*types.Proof {
+				a := w.Hop("A", nil)
+				b := w.Open("B", uint64(mrand.Int31()), a, w.Packet)
+				c := w.Hop("C", b)
+				return []*types.Proof{a, b, c, w.Hop("D", c)}
+			},
+		},
+		{
+			Name:        "replay",
+			Description: "C is bypassed and its valid proof from an earlier packet is replayed",
+			Route:       "ABCD",
+			Expect:      Rejected,
+			ExpectKind:  diagnose.ReplayedProof,
+			Attack: func(w *World) []*types.Proof {
+				path := w.Honest("A", "B")
+				c := w.Open("C", w.Secrets["C"], path[1], w.NewPacket())
+				return append(path, c, w.Hop("D", c))
+			},
+		},
+		{
+			Name:        "replay-packet",
+			Description: "a packet that was already delivered is sent again, unchanged",
+			Route:       "ABCD",
+			Expect:      Rejected,
+			Attack: func(w *World) []*types.Proof {
+				// the copy is bound to the same packet, only the replay windows catch it
+				path := w.Honest("A", "B", "C", "D")
+				w.Deliver(path)
+				return path
+			},
+		},
+		{
+			Name:        "substitute",
+			Description: "an attacker swaps the published commitment for one over a route through X",
+			Route:       "ABCD",
+			Expect:      Rejected,
+			Attack: func(w *World) []*types.Proof {
+				var fake types.Controller
+				if _, _, err := fake.Setup([]uint32{uint32(w.Secrets["A"]), uint32(w.Secrets[Outsider]), uint32(w.Secrets["D"])}); err != nil {
+					panic(err)
+				}
+				w.Public.PolynomialCommitment = fake.Commit()
+				return w.Honest("A", "B", "C", "D")
+			},
+		},
+		{
+			Name:        "collude",
+			Description: "B forwards straight to D, which accepts B's proof without complaint",
+			Route:       "ABCDE",
+			Expect:      Rejected,
+			ExpectKind:  diagnose.SkippedHop,
+			Attack: func(w *World) []*types.Proof {
+				w.Colluding["D"] = true
+				return w.Honest("A", "B", "D", "E")
+			},
+		},
+		{
+			// proofs reveal X in the clear and nodes hold the polynomial, so once C has proven a
+			// single packet its neighbours can open C's position; the link still needs C's hop key
+			Name:        "collude-leaked-secret",
+			Description: "B and D collude to skip C, using C's secret revealed by an earlier packet",
+			Route:       "ABCD",
+			Expect:      Rejected,
+			ExpectKind:  diagnose.ReplayedProof,
+			Attack: func(w *World) []*types.Proof {
+				earlier := w.Honest("A", "B", "C")
+				leaked, err := leakedSecret(earlier[2])
+				if err != nil {
+					panic(err)
+				}
+				a := w.Hop("A", nil)
+				b := w.Hop("B", a)
+				c := w.Open("C", leaked, b, w.Packet)
+				c.Bind(w.HopKeys["B"], b.Chain, types.PacketDigest(w.Packet))
+				return []*types.Proof{a, b, c, w.Hop("D", c)}
+			},
+		},
+	}
+}
+
+// leakedSecret reads the secret a proof reveals.
+func leakedSecret(proof *types.Proof) (uint64, error) {
+	return strconv.ParseUint(proof.X, 10, 64)
+}
@@ -0,0 +1,310 @@
+package snark
+
+import (
+	"fmt"
+	"math/bits"
+
+	bls12381 "github.com/kilic/bls12-381"
+	gozkg "github.com/protolambda/go-kzg"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// Groth16 over BLS12-381, after Groth, "On the Size of Pairing-based Non-interactive Arguments",
+// EUROCRYPT 2016. The constraints are interpolated over the 2^k-th roots of unity, so the
+// quotient polynomial is computed with FFTs.
+
+// ProofSize is the size of a compressed proof: A and C in G1, B in G2.
+const ProofSize = 48 + 96 + 48
+
+// Proof is a Groth16 proof.
+type Proof struct {
+	A *bls.G1Point
+	B *bls.G2Point
+	C *bls.G1Point
+}
+
+// ProvingKey is the circuit-specific part of the setup the prover needs. Setup discards the
+// trapdoor it was derived from.
+type ProvingKey struct {
+	Domain      int // size of the evaluation domain, a power of two
+	Variables   int
+	Public      int // public variables, including the constant one
+	Constraints int
+
+	Alpha1, Beta1, Delta1 *bls.G1Point
+	Beta2, Delta2         *bls.G2Point
+	A, B1                 []bls.G1Point // u_j(τ) and v_j(τ) of every variable
+	B2                    []bls.G2Point
+	L                     []bls.G1Point // (β u_j(τ) + α v_j(τ) + w_j(τ)) / δ of the private variables
+	H                     []bls.G1Point // τ^i t(τ) / δ
+}
+
+// VerifyingKey is the part of the setup an auditor needs.
+type VerifyingKey struct {
+	Alpha1                *bls.G1Point
+	Beta2, Gamma2, Delta2 *bls.G2Point
+	IC                    []bls.G1Point // (β u_j(τ) + α v_j(τ) + w_j(τ)) / γ of the public variables
+}
+
+// domainFFT returns the FFT settings for twice the domain of n constraints, which the prover
+// needs for the product of two polynomials of degree below the domain size.
+func domainFFT(constraints int) (domain int, fs *gozkg.FFTSettings) {
+	scale := max(bits.Len(uint(constraints-1)), 1)
+	return 1 << scale, gozkg.NewFFTSettings(uint8(scale + 1))
+}
+
+// Setup draws a trapdoor and derives the keys of the system's circuit from it. Only the shape of
+// the system is used, not its assignment.
+func Setup(s *System) (*ProvingKey, *VerifyingKey, error) {
+	domain, fs := domainFFT(len(s.constraints))
+
+	var tau, t bls.Fr
+	for {
+		bls.CopyFr(&tau, bls.RandomFr())
+		pow(&t, &tau, uint64(domain))
+		bls.SubModFr(&t, &t, &bls.ONE)
+		if !bls.EqualZero(&t) { // τ must not be in the domain
+			break
+		}
+	}
+	alpha, beta, gamma, delta := bls.RandomFr(), bls.RandomFr(), bls.RandomFr(), bls.RandomFr()
+	if bls.EqualZero(gamma) || bls.EqualZero(delta) {
+		return nil, nil, fmt.Errorf("snark: degenerate trapdoor")
+	}
+
+	// Lagrange basis of the domain at τ: L_i(τ) = ω^i t(τ) / (N (τ - ω^i))
+	var size bls.Fr
+	bls.AsFr(&size, uint64(domain))
+	lagrange := make([]bls.Fr, domain)
+	for i := range lagrange {
+		bls.SubModFr(&lagrange[i], &tau, &fs.ExpandedRootsOfUnity[2*i])
+		bls.MulModFr(&lagrange[i], &lagrange[i], &size)
+	}
+	bls.BatchInvModFr(lagrange)
+	for i := range lagrange {
+		bls.MulModFr(&lagrange[i], &lagrange[i], &fs.ExpandedRootsOfUnity[2*i])
+		bls.MulModFr(&lagrange[i], &lagrange[i], &t)
+	}
+
+	variables := len(s.values)
+	u := make([]bls.Fr, variables)
+	v := make([]bls.Fr, variables)
+	w := make([]bls.Fr, variables)
+	for i, c := range s.constraints {
+		for _, side := range []struct {
+			lc  LinearCombination
+			out []bls.Fr
+		}{{c.A, u}, {c.B, v}, {c.C, w}} {
+			for _, term := range side.lc {
+				var tmp bls.Fr
+				bls.MulModFr(&tmp, &term.c, &lagrange[i])
+				bls.AddModFr(&side.out[term.v], &side.out[term.v], &tmp)
+			}
+		}
+	}
+
+	var gammaInv, deltaInv bls.Fr
+	bls.InvModFr(&gammaInv, gamma)
+	bls.InvModFr(&deltaInv, delta)
+
+	pk := &ProvingKey{
+		Domain:      domain,
+		Variables:   variables,
+		Public:      s.public,
+		Constraints: len(s.constraints),
+		Alpha1:      mulG1(alpha),
+		Beta1:       mulG1(beta),
+		Delta1:      mulG1(delta),
+		Beta2:       mulG2(beta),
+		Delta2:      mulG2(delta),
+		A:           make([]bls.G1Point, variables),
+		B1:          make([]bls.G1Point, variables),
+		B2:          make([]bls.G2Point, variables),
+		L:           make([]bls.G1Point, variables-s.public),
+		H:           make([]bls.G1Point, domain-1),
+	}
+	vk := &VerifyingKey{
+		Alpha1: pk.Alpha1,
+		Beta2:  pk.Beta2,
+		Gamma2: mulG2(gamma),
+		Delta2: pk.Delta2,
+		IC:     make([]bls.G1Point, s.public),
+	}
+	for j := 0; j < variables; j++ {
+		pk.A[j] = *mulG1(&u[j])
+		pk.B1[j] = *mulG1(&v[j])
+		pk.B2[j] = *mulG2(&v[j])
+
+		var k, tmp bls.Fr
+		bls.MulModFr(&k, beta, &u[j])
+		bls.MulModFr(&tmp, alpha, &v[j])
+		bls.AddModFr(&k, &k, &tmp)
+		bls.AddModFr(&k, &k, &w[j])
+		if j < s.public {
+			bls.MulModFr(&k, &k, &gammaInv)
+			vk.IC[j] = *mulG1(&k)
+		} else {
+			bls.MulModFr(&k, &k, &deltaInv)
+			pk.L[j-s.public] = *mulG1(&k)
+		}
+	}
+	var h bls.Fr
+	bls.MulModFr(&h, &t, &deltaInv)
+	for i := range pk.H {
+		pk.H[i] = *mulG1(&h)
+		bls.MulModFr(&h, &h, &tau)
+	}
+	return pk, vk, nil
+}
+
+// Prove proves that the system's assignment satisfies it. The system must have the shape pk was
+// set up for.
+func Prove(pk *ProvingKey, s *System) (*Proof, error) {
+	if len(s.values) != pk.Variables || s.public != pk.Public || len(s.constraints) != pk.Constraints {
+		return nil, fmt.Errorf("snark: the proving key is for another circuit")
+	}
+	if err := s.Satisfied(); err != nil {
+		return nil, err
+	}
+	domain, fs := domainFFT(len(s.constraints))
+
+	// the constraints evaluated on the domain, extended to twice its size
+	extended := make([][]bls.Fr, 3)
+	for k := range extended {
+		evals := make([]bls.Fr, domain)
+		for i, c := range s.constraints {
+			bls.CopyFr(&evals[i], s.Eval([]LinearCombination{c.A, c.B, c.C}[k]))
+		}
+		coeffs, err := fs.FFT(evals, true)
+		if err != nil {
+			return nil, err
+		}
+		coeffs = append(coeffs, make([]bls.Fr, domain)...)
+		if extended[k], err = fs.FFT(coeffs, false); err != nil {
+			return nil, err
+		}
+	}
+	// a b - c = h t with t = X^N - 1, so the coefficients of a b - c from N on are those of h
+	for i := range extended[0] {
+		bls.MulModFr(&extended[0][i], &extended[0][i], &extended[1][i])
+		bls.SubModFr(&extended[0][i], &extended[0][i], &extended[2][i])
+	}
+	product, err := fs.FFT(extended[0], true)
+	if err != nil {
+		return nil, err
+	}
+	h := product[domain : 2*domain-1]
+
+	r, sigma := bls.RandomFr(), bls.RandomFr() // r and s in the paper
+	var tmp1 bls.G1Point
+	var tmp2 bls.G2Point
+
+	a := linComb(pk.A, s.values)
+	bls.AddG1(a, a, pk.Alpha1)
+	bls.MulG1(&tmp1, pk.Delta1, r)
+	bls.AddG1(a, a, &tmp1)
+
+	b := linCombG2(pk.B2, s.values)
+	bls.AddG2(b, b, pk.Beta2)
+	bls.MulG2(&tmp2, pk.Delta2, sigma)
+	bls.AddG2(b, b, &tmp2)
+
+	b1 := linComb(pk.B1, s.values)
+	bls.AddG1(b1, b1, pk.Beta1)
+	bls.MulG1(&tmp1, pk.Delta1, sigma)
+	bls.AddG1(b1, b1, &tmp1)
+
+	c := linComb(pk.L, s.values[s.public:])
+	bls.AddG1(c, c, linComb(pk.H, h))
+	bls.MulG1(&tmp1, a, sigma)
+	bls.AddG1(c, c, &tmp1)
+	bls.MulG1(&tmp1, b1, r)
+	bls.AddG1(c, c, &tmp1)
+	var r2 bls.Fr
+	bls.MulModFr(&r2, r, sigma)
+	bls.MulG1(&tmp1, pk.Delta1, &r2)
+	bls.SubG1(c, c, &tmp1)
+
+	return &Proof{A: a, B: b, C: c}, nil
+}
+
+// Verify checks the proof against the public inputs, without the constant one, in the order the
+// circuit added them.
+func Verify(vk *VerifyingKey, proof *Proof, inputs []bls.Fr) bool {
+	if proof == nil || proof.A == nil || proof.B == nil || proof.C == nil || len(inputs)+1 != len(vk.IC) {
+		return false
+	}
+	ic := linComb(vk.IC[1:], inputs)
+	bls.AddG1(ic, ic, &vk.IC[0])
+
+	// e(A, B) = e(α, β) e(IC, γ) e(C, δ)
+	engine := bls12381.NewEngine()
+	engine.AddPair((*bls12381.PointG1)(proof.A), (*bls12381.PointG2)(proof.B))
+	engine.AddPairInv((*bls12381.PointG1)(vk.Alpha1), (*bls12381.PointG2)(vk.Beta2))
+	engine.AddPairInv((*bls12381.PointG1)(ic), (*bls12381.PointG2)(vk.Gamma2))
+	engine.AddPairInv((*bls12381.PointG1)(proof.C), (*bls12381.PointG2)(vk.Delta2))
+	return engine.Check()
+}
+
+func mulG1(k *bls.Fr) *bls.G1Point {
+	out := new(bls.G1Point)
+	if bls.EqualZero(k) {
+		bls.ClearG1(out)
+		return out
+	}
+	bls.MulG1(out, &bls.GenG1, k)
+	return out
+}
+
+func mulG2(k *bls.Fr) *bls.G2Point {
+	out := new(bls.G2Point)
+	if bls.EqualZero(k) {
+		bls.ClearG2(out)
+		return out
+	}
+	bls.MulG2(out, &bls.GenG2, k)
+	return out
+}
+
+func linComb(points []bls.G1Point, factors []bls.Fr) *bls.G1Point {
+	if len(points) == 0 {
+		out := new(bls.G1Point)
+		bls.ClearG1(out)
+		return out
+	}
+	return bls.LinCombG1(points, factors)
+}
+
+// linCombG2 is bls.LinCombG1 in G2, which go-kzg does not provide.
+func linCombG2(points []bls.G2Point, factors []bls.Fr) *bls.G2Point {
+	out := new(bls12381.PointG2)
+	g2 := bls12381.NewG2()
+	ps := make([]*bls12381.PointG2, len(points))
+	ks := make([]*bls12381.Fr, len(factors))
+	for i := range points {
+		ps[i] = g2.New().Set((*bls12381.PointG2)(&points[i]))
+		k := bls12381.Fr(factors[i])
+		k.FromRed() // bls.Fr is kept in Montgomery form
+		ks[i] = &k
+	}
+	if len(ps) == 0 {
+		return (*bls.G2Point)(g2.Zero())
+	}
+	if _, err := g2.MultiExp(out, ps, ks); err != nil {
+		panic(err) // lengths are equal
+	}
+	return (*bls.G2Point)(out)
+}
+
+func pow(dst *bls.Fr, x *bls.Fr, e uint64) {
+	var acc, base bls.Fr
+	bls.CopyFr(&acc, &bls.ONE)
+	bls.CopyFr(&base, x)
+	for ; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			bls.MulModFr(&acc, &acc, &base)
+		}
+		bls.MulModFr(&base, &base, &base)
+	}
+	bls.CopyFr(dst, &acc)
+}
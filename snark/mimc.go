@@ -0,0 +1,104 @@
+package snark
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// MiMC (Albrecht et al., ASIACRYPT 2016) with the exponent 5, which is a permutation of Fr since
+// 5 does not divide r - 1. A round is three multiplications, so hashing inside a circuit is cheap,
+// unlike SHA-256. Hashes are Miyaguchi-Preneel over the cipher, absorbing one element at a time.
+
+const mimcDomain = "KZG-DEMO-MIMC5-V1"
+
+// mimcRounds is ceil(log_5 r), enough against interpolation attacks.
+const mimcRounds = 110
+
+var mimcConstants = func() []bls.Fr {
+	constants := make([]bls.Fr, mimcRounds) // the first is zero
+	for i := 1; i < mimcRounds; i++ {
+		bls.CopyFr(&constants[i], hashToFr(mimcDomain, binary.BigEndian.AppendUint32(nil, uint32(i))))
+	}
+	return constants
+}()
+
+// hashToFr reduces 512 bits of SHA-256 output modulo the field order, so the bias is negligible.
+func hashToFr(domain string, parts ...[]byte) *bls.Fr {
+	wide := make([]byte, 0, 64)
+	for _, suffix := range []byte{0, 1} {
+		h := sha256.New()
+		h.Write([]byte(domain))
+		for _, part := range parts {
+			h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(part))))
+			h.Write(part)
+		}
+		h.Write([]byte{suffix})
+		wide = h.Sum(wide)
+	}
+	modulus, _ := new(big.Int).SetString(bls.ModulusStr, 10)
+	value := new(big.Int).Mod(new(big.Int).SetBytes(wide), modulus)
+
+	out := new(bls.Fr)
+	bls.SetFr(out, value.String())
+	return out
+}
+
+// mimcEncrypt enciphers x under the key k.
+func mimcEncrypt(k, x *bls.Fr) *bls.Fr {
+	var state, t, t2 bls.Fr
+	bls.CopyFr(&state, x)
+	for i := range mimcConstants {
+		bls.AddModFr(&t, &state, k)
+		bls.AddModFr(&t, &t, &mimcConstants[i])
+		bls.MulModFr(&t2, &t, &t)
+		bls.MulModFr(&t2, &t2, &t2)
+		bls.MulModFr(&state, &t2, &t)
+	}
+	out := new(bls.Fr)
+	bls.AddModFr(out, &state, k)
+	return out
+}
+
+// MiMCHash hashes the values, prefixed with their number.
+func MiMCHash(values []bls.Fr) *bls.Fr {
+	var length bls.Fr
+	bls.AsFr(&length, uint64(len(values)))
+	h := new(bls.Fr)
+	for _, m := range append([]bls.Fr{length}, values...) {
+		next := mimcEncrypt(h, &m)
+		bls.AddModFr(next, next, h)
+		bls.AddModFr(next, next, &m)
+		h = next
+	}
+	return h
+}
+
+// mimcEncrypt constrains the cipher, three constraints per round.
+func (s *System) mimcEncrypt(k, x LinearCombination) LinearCombination {
+	state := x
+	for i := range mimcConstants {
+		t := state.Add(k).Add(Const(&mimcConstants[i]))
+		t2 := s.Mul(t, t)
+		t4 := s.Mul(Var(t2), Var(t2))
+		state = Var(s.Mul(Var(t4), t))
+	}
+	return state.Add(k)
+}
+
+// MiMCHash constrains the hash of the values, see MiMCHash.
+func (s *System) MiMCHash(values []LinearCombination) LinearCombination {
+	var length bls.Fr
+	bls.AsFr(&length, uint64(len(values)))
+	h := LinearCombination{}
+	for _, m := range append([]LinearCombination{Const(&length)}, values...) {
+		// h appears twice in the next one, so it is kept in a variable to stop the combinations
+		// from doubling with every element
+		next := s.mimcEncrypt(h, m).Add(h).Add(m)
+		h = Var(s.Private(s.Eval(next)))
+		s.AssertEqual(next, h)
+	}
+	return h
+}
@@ -0,0 +1,166 @@
+package snark
+
+import (
+	"fmt"
+
+	"example.com/kzg-demo/types"
+	gozkg "github.com/protolambda/go-kzg"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// A path proof replaces the n openings a packet collects on its way with one Groth16 proof that
+// the prover knows points x_1..x_n with P(x_i) = y_i for the positions y_1..y_n, in route order,
+// where P is the polynomial committed in C. A valid opening of C at x to y exists exactly when
+// P(x) = y, so the circuit checks the evaluations instead of n pairing equations, which it could
+// only do with emulated field arithmetic.
+//
+// P is a witness and stays with the prover. The circuit ties it to C without a pairing: the prover
+// hashes P with MiMC, derives a point z from C, the hash and the packet, and opens C at z outside
+// of the circuit. The circuit checks that the witness hashes to the same value and evaluates to
+// the opened value at z. A polynomial other than the committed one, fixed by the hash before z is
+// drawn, agrees with it at z with probability below deg P / r.
+//
+// The statement is bound to the packet digest, so a proof is not valid for another packet. Like a
+// single opening, it shows knowledge of the hop secrets, which the openings carry in the clear,
+// and not who computed them; see types.Proof.Bind for the per-hop chain.
+
+const pathDomain = "KZG-DEMO-PATH-SNARK-V1"
+
+// PathProof is what the prover hands to an auditor besides the packet digest: a constant number
+// of group and field elements, however long the route is.
+type PathProof struct {
+	Hash    string       // decimal MiMC hash of the route polynomial
+	Value   string       // decimal value of the route polynomial at the challenge point
+	Opening *bls.G1Point // opening of the commitment at the challenge point
+	Proof   *Proof
+}
+
+// PathProofSize is the size of a compressed path proof.
+const PathProofSize = 32 + 32 + 48 + ProofSize
+
+// challenge derives the point the commitment is opened at.
+func challenge(commitment *bls.G1Point, hash *bls.Fr, packetDigest []byte, positions []bls.Fr) *bls.Fr {
+	hashBytes := bls.FrTo32(hash)
+	parts := [][]byte{bls.ToCompressedG1(commitment), hashBytes[:], packetDigest}
+	for i := range positions {
+		position := bls.FrTo32(&positions[i])
+		parts = append(parts, position[:])
+	}
+	return hashToFr(pathDomain, parts...)
+}
+
+// pathCircuit builds the circuit of a path for the given assignment. The public inputs are the
+// packet, the hash, the challenge point and value, and the positions, in that order.
+func pathCircuit(polynomial, xs []bls.Fr, packet, hash, point, value *bls.Fr, positions []bls.Fr) *System {
+	s := NewSystem()
+	s.Public(packet) // only bound to the proof, not constrained
+	hashVar := s.Public(hash)
+	pointVar := s.Public(point)
+	valueVar := s.Public(value)
+	positionVars := make([]Variable, len(positions))
+	for i := range positions {
+		positionVars[i] = s.Public(&positions[i])
+	}
+
+	coeffs := make([]LinearCombination, len(polynomial))
+	for i := range polynomial {
+		coeffs[i] = Var(s.Private(&polynomial[i]))
+	}
+	s.AssertEqual(s.MiMCHash(coeffs), Var(hashVar))
+	s.AssertEqual(s.evalPoly(coeffs, Var(pointVar)), Var(valueVar))
+	for i := range xs {
+		x := Var(s.Private(&xs[i]))
+		s.AssertEqual(s.evalPoly(coeffs, x), Var(positionVars[i]))
+	}
+	return s
+}
+
+// evalPoly constrains Horner's rule, one multiplication per coefficient after the first.
+func (s *System) evalPoly(coeffs []LinearCombination, x LinearCombination) LinearCombination {
+	acc := coeffs[len(coeffs)-1]
+	for i := len(coeffs) - 2; i >= 0; i-- {
+		acc = Var(s.Mul(acc, x)).Add(coeffs[i])
+	}
+	return acc
+}
+
+// placeholderPath is the circuit of a path of the given shape, with a zero assignment.
+func placeholderPath(hops, coefficients int) *System {
+	var zero bls.Fr
+	return pathCircuit(make([]bls.Fr, coefficients), make([]bls.Fr, hops), &zero, &zero, &zero, &zero, make([]bls.Fr, hops))
+}
+
+// PathSetup sets up the circuit for routes of the given number of hops, committed in polynomials
+// with the given number of coefficients.
+func PathSetup(hops, coefficients int) (*ProvingKey, *VerifyingKey, error) {
+	if hops < 1 || coefficients < 2 {
+		return nil, nil, fmt.Errorf("snark: a path needs a hop and a polynomial of degree 1 or more")
+	}
+	return Setup(placeholderPath(hops, coefficients))
+}
+
+// PathConstraints returns the number of constraints of the circuit for the given shape.
+func PathConstraints(hops, coefficients int) int {
+	return placeholderPath(hops, coefficients).Constraints()
+}
+
+// ProvePath proves that the hops xs, in order, open the polynomial's commitment to positions,
+// for the packet with the given digest.
+func ProvePath(pk *ProvingKey, ks *gozkg.KZGSettings, polynomial []bls.Fr, xs []bls.Fr, positions []bls.Fr, packetDigest []byte) (*PathProof, error) {
+	if len(xs) != len(positions) {
+		return nil, fmt.Errorf("snark: %v hops for %v positions", len(xs), len(positions))
+	}
+	for i := range xs {
+		var y bls.Fr
+		bls.EvalPolyAt(&y, polynomial, &xs[i])
+		if !bls.EqualFr(&y, &positions[i]) {
+			return nil, fmt.Errorf("snark: hop %v does not open to its position", i+1)
+		}
+	}
+
+	hash := MiMCHash(polynomial)
+	commitment := ks.CommitToPoly(polynomial)
+	point := challenge(commitment, hash, packetDigest, positions)
+	var value bls.Fr
+	bls.EvalPolyAt(&value, polynomial, point)
+	packet := hashToFr(pathDomain, packetDigest)
+
+	proof, err := Prove(pk, pathCircuit(polynomial, xs, packet, hash, point, &value, positions))
+	if err != nil {
+		return nil, err
+	}
+	return &PathProof{
+		Hash:    hash.String(),
+		Value:   value.String(),
+		Opening: types.ComputeProofAt(ks, polynomial, point),
+		Proof:   proof,
+	}, nil
+}
+
+// VerifyPath checks a path proof against the commitment, the positions in route order and the
+// packet digest.
+func VerifyPath(vk *VerifyingKey, ks *gozkg.KZGSettings, commitment *bls.G1Point, positions []bls.Fr, packetDigest []byte, path *PathProof) error {
+	if path == nil || path.Opening == nil || commitment == nil {
+		return fmt.Errorf("snark: incomplete path proof")
+	}
+	if len(vk.IC) != 5+len(positions) {
+		return fmt.Errorf("snark: the verifying key is for another number of hops")
+	}
+	var hash, value bls.Fr
+	if err := types.FrFromString(&hash, path.Hash); err != nil {
+		return fmt.Errorf("snark: hash: %w", err)
+	}
+	if err := types.FrFromString(&value, path.Value); err != nil {
+		return fmt.Errorf("snark: value: %w", err)
+	}
+
+	point := challenge(commitment, &hash, packetDigest, positions)
+	if !ks.CheckProofSingle(commitment, path.Opening, point, &value) {
+		return fmt.Errorf("snark: the value does not open the commitment")
+	}
+	inputs := append([]bls.Fr{*hashToFr(pathDomain, packetDigest), hash, *point, value}, positions...)
+	if !Verify(vk, path.Proof, inputs) {
+		return fmt.Errorf("snark: the proof does not verify")
+	}
+	return nil
+}
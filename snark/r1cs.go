@@ -0,0 +1,137 @@
+package snark
+
+import (
+	"fmt"
+
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// Variable indexes the assignment of a System. Variable 0 is the constant one, the public inputs
+// follow, then the private witness.
+type Variable int
+
+// One is the constant 1 of every system.
+const One Variable = 0
+
+type term struct {
+	v Variable
+	c bls.Fr
+}
+
+// LinearCombination is a sum of variables with constant coefficients.
+type LinearCombination []term
+
+// Var is the linear combination of a single variable.
+func Var(v Variable) LinearCombination {
+	return LinearCombination{{v: v, c: bls.ONE}}
+}
+
+// Const is the linear combination of the constant c.
+func Const(c *bls.Fr) LinearCombination {
+	t := term{v: One}
+	bls.CopyFr(&t.c, c)
+	return LinearCombination{t}
+}
+
+// Add returns l + m.
+func (l LinearCombination) Add(m LinearCombination) LinearCombination {
+	out := make(LinearCombination, 0, len(l)+len(m))
+	return append(append(out, l...), m...)
+}
+
+// Constraint is one rank-1 constraint: <A, z> * <B, z> = <C, z> for the assignment z.
+type Constraint struct {
+	A, B, C LinearCombination
+}
+
+// System is a rank-1 constraint system together with the assignment it was built with. Circuits
+// are built by calling the same code with the witness for proving and with any placeholder for
+// Setup, which only uses the constraints.
+type System struct {
+	constraints []Constraint
+	values      []bls.Fr
+	public      int // variables that are public, including One
+}
+
+func NewSystem() *System {
+	s := &System{values: []bls.Fr{bls.ONE}, public: 1}
+	s.bindInput(One)
+	return s
+}
+
+// bindInput makes the variable appear in A of a trivial constraint v * 0 = 0. Groth16 only binds
+// a proof to the public inputs whose polynomials are linearly independent, and an input that no
+// other constraint uses would have none.
+func (s *System) bindInput(v Variable) {
+	s.constraints = append(s.constraints, Constraint{A: Var(v)})
+}
+
+// Public adds a public input. Public inputs are numbered in the order they are added and must come
+// before any private variable.
+func (s *System) Public(value *bls.Fr) Variable {
+	if len(s.values) != s.public {
+		panic("snark: public inputs must be added before the witness")
+	}
+	v := s.alloc(value)
+	s.public++
+	s.bindInput(v)
+	return v
+}
+
+// Private adds a witness variable.
+func (s *System) Private(value *bls.Fr) Variable {
+	return s.alloc(value)
+}
+
+func (s *System) alloc(value *bls.Fr) Variable {
+	s.values = append(s.values, bls.Fr{})
+	bls.CopyFr(&s.values[len(s.values)-1], value)
+	return Variable(len(s.values) - 1)
+}
+
+// Mul returns a new witness variable constrained to a * b.
+func (s *System) Mul(a, b LinearCombination) Variable {
+	var product bls.Fr
+	bls.MulModFr(&product, s.Eval(a), s.Eval(b))
+	v := s.Private(&product)
+	s.constraints = append(s.constraints, Constraint{A: a, B: b, C: Var(v)})
+	return v
+}
+
+// AssertEqual constrains a = b.
+func (s *System) AssertEqual(a, b LinearCombination) {
+	s.constraints = append(s.constraints, Constraint{A: a, B: Var(One), C: b})
+}
+
+// Eval returns the value of l under the assignment.
+func (s *System) Eval(l LinearCombination) *bls.Fr {
+	out := new(bls.Fr)
+	for _, t := range l {
+		var tmp bls.Fr
+		bls.MulModFr(&tmp, &t.c, &s.values[t.v])
+		bls.AddModFr(out, out, &tmp)
+	}
+	return out
+}
+
+// Constraints returns the number of constraints.
+func (s *System) Constraints() int {
+	return len(s.constraints)
+}
+
+// Inputs returns the values of the public inputs, without the constant one.
+func (s *System) Inputs() []bls.Fr {
+	return append([]bls.Fr(nil), s.values[1:s.public]...)
+}
+
+// Satisfied reports the first constraint the assignment violates.
+func (s *System) Satisfied() error {
+	for i, c := range s.constraints {
+		var ab bls.Fr
+		bls.MulModFr(&ab, s.Eval(c.A), s.Eval(c.B))
+		if !bls.EqualFr(&ab, s.Eval(c.C)) {
+			return fmt.Errorf("snark: constraint %v is not satisfied", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package snark
+
+import (
+	"testing"
+
+	"example.com/kzg-demo/types"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+func fr(v uint64) *bls.Fr {
+	out := new(bls.Fr)
+	bls.AsFr(out, v)
+	return out
+}
+
+// cubic is x^3 + x + 5 = out with the public output out, the usual first Groth16 example.
+func cubic(x, out uint64) *System {
+	s := NewSystem()
+	outVar := s.Public(fr(out))
+	xVar := Var(s.Private(fr(x)))
+	x2 := s.Mul(xVar, xVar)
+	x3 := s.Mul(Var(x2), xVar)
+	s.AssertEqual(Var(x3).Add(xVar).Add(Const(fr(5))), Var(outVar))
+	return s
+}
+
+func TestGroth16(t *testing.T) {
+	pk, vk, err := Setup(cubic(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := Prove(pk, cubic(3, 35))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(vk, proof, []bls.Fr{*fr(35)}) {
+		t.Fatal("valid proof refused")
+	}
+
+	if _, err := Prove(pk, cubic(4, 35)); err == nil {
+		t.Error("proved an unsatisfied assignment")
+	}
+	tampered := *proof
+	tampered.A = new(bls.G1Point)
+	bls.AddG1(tampered.A, proof.A, &bls.GenG1)
+	tests := []struct {
+		name   string
+		proof  *Proof
+		inputs []bls.Fr
+	}{
+		{"wrong input", proof, []bls.Fr{*fr(36)}},
+		{"missing input", proof, nil},
+		{"tampered proof", &tampered, []bls.Fr{*fr(35)}},
+		{"swapped points", &Proof{A: proof.C, B: proof.B, C: proof.A}, []bls.Fr{*fr(35)}},
+		{"no proof", nil, []bls.Fr{*fr(35)}},
+	}
+	for _, test := range tests {
+		if Verify(vk, test.proof, test.inputs) {
+			t.Errorf("%v: verified", test.name)
+		}
+	}
+
+	_, otherVK, err := Setup(cubic(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Verify(otherVK, proof, []bls.Fr{*fr(35)}) {
+		t.Error("verified under the key of another setup")
+	}
+}
+
+func TestMiMCCircuitMatchesHash(t *testing.T) {
+	values := []bls.Fr{*fr(1), *fr(22), *fr(333)}
+	s := NewSystem()
+	lcs := make([]LinearCombination, len(values))
+	for i := range values {
+		lcs[i] = Var(s.Private(&values[i]))
+	}
+	if got := s.Eval(s.MiMCHash(lcs)); !bls.EqualFr(got, MiMCHash(values)) {
+		t.Error("the circuit computes another hash")
+	}
+	if err := s.Satisfied(); err != nil {
+		t.Error(err)
+	}
+	if bls.EqualFr(MiMCHash(values), MiMCHash(values[:2])) || bls.EqualFr(MiMCHash(values), MiMCHash(append(values, bls.ZERO))) {
+		t.Error("hashes of different lengths collide")
+	}
+}
+
+func TestPathProof(t *testing.T) {
+	data := []uint32{98765, 4321, 1111, 2468}
+	c := types.Controller{}
+	if _, _, err := c.Setup(data); err != nil {
+		t.Fatal(err)
+	}
+	xs := make([]bls.Fr, len(data))
+	positions := make([]bls.Fr, len(data))
+	for i := range data {
+		bls.AsFr(&xs[i], uint64(data[i]))
+		bls.CopyFr(&positions[i], c.Position(i))
+	}
+	pk, vk, err := PathSetup(len(data), len(c.Polynomial))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := types.PacketDigest([]byte("packet"))
+	path, err := ProvePath(pk, c.KzgSettings, c.Polynomial, xs, positions, packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyPath(vk, c.KzgSettings, c.Commit(), positions, packet, path); err != nil {
+		t.Fatalf("valid path refused: %v", err)
+	}
+
+	other := types.Controller{}
+	if _, _, err := other.Setup([]uint32{98765, 4321, 1111, 1357}); err != nil {
+		t.Fatal(err)
+	}
+	reordered := append([]bls.Fr(nil), positions...)
+	reordered[1], reordered[2] = reordered[2], reordered[1]
+	wrongValue := *path
+	wrongValue.Value = fr(7).String()
+	wrongHash := *path
+	wrongHash.Hash = MiMCHash(other.Polynomial).String()
+	tests := []struct {
+		name       string
+		commitment *bls.G1Point
+		positions  []bls.Fr
+		packet     []byte
+		path       *PathProof
+	}{
+		{"another packet", c.Commit(), positions, types.PacketDigest([]byte("other packet")), path},
+		{"another commitment", other.Commit(), positions, packet, path},
+		{"reordered positions", c.Commit(), reordered, packet, path},
+		{"fewer hops", c.Commit(), positions[:3], packet, path},
+		{"wrong value", c.Commit(), positions, packet, &wrongValue},
+		{"hash of another polynomial", c.Commit(), positions, packet, &wrongHash},
+		{"no path", c.Commit(), positions, packet, nil},
+	}
+	for _, test := range tests {
+		if err := VerifyPath(vk, c.KzgSettings, test.commitment, test.positions, test.packet, test.path); err == nil {
+			t.Errorf("%v: verified", test.name)
+		}
+	}
+
+	skipped := append([]bls.Fr(nil), xs...)
+	bls.AsFr(&skipped[2], 1357)
+	if _, err := ProvePath(pk, c.KzgSettings, c.Polynomial, skipped, positions, packet); err == nil {
+		t.Error("proved a path with a foreign hop")
+	}
+	if _, err := ProvePath(pk, other.KzgSettings, other.Polynomial, xs[:3], positions[:3], packet); err == nil {
+		t.Error("proved with the key of another shape")
+	}
+}
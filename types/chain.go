@@ -0,0 +1,85 @@
+package types
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// An opening proves that a hop knows its point on the polynomial, but the same opening is valid
+// for every packet, so on its own it can be replayed. Chaining binds each hop's proof to the
+// packet and to the proof it received: Chain = H(Prev, packet digest, proof), with Prev the
+// Chain of the previous hop, and the hop signs Chain with its hop key. Openings travel in the
+// clear, and P can be interpolated from the X and Y of enough of them, so nothing derived from P
+// can authenticate a link; the hop key is held by its node only, and the controller vouches for
+// its public half, see SignHopKey. A link is checked against the key of the node the route
+// commits at that hop, so an opening taken from another packet cannot be bound to this one, a
+// chain with a hop left out or moved does not check, and route nodes cannot bind proofs for each
+// other.
+
+const chainDomain = "KZG-DEMO-PROOF-CHAIN-V1"
+
+// PacketDigest identifies the packet a chain of proofs is bound to.
+func PacketDigest(packet []byte) []byte {
+	digest := sha256.Sum256(packet)
+	return digest[:]
+}
+
+// ChainLink hashes a proof, including its sequence number, together with the previous link and
+// the packet digest.
+func ChainLink(prev []byte, packetDigest []byte, proof *Proof) []byte {
+	h := sha256.New()
+	h.Write([]byte(chainDomain))
+	for _, field := range [][]byte{prev, packetDigest, []byte(proof.FlowID), []byte(proof.Node), []byte(proof.X), []byte(proof.Y)} {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(field))))
+		h.Write(field)
+	}
+	h.Write(binary.BigEndian.AppendUint64(nil, proof.Epoch))
+	h.Write(binary.BigEndian.AppendUint64(nil, proof.Version))
+	h.Write(binary.BigEndian.AppendUint64(nil, proof.Seq))
+	if proof.Proof != nil {
+		h.Write(bls.ToCompressedG1(proof.Proof))
+	}
+	return h.Sum(nil)
+}
+
+// Bind chains the proof to the previous hop's Chain, nil at the first hop, and to the packet, and
+// signs the link with the hop key of the proving node.
+func (p *Proof) Bind(hopKey ed25519.PrivateKey, prev []byte, packetDigest []byte) {
+	p.Prev = prev
+	p.Chain = ChainLink(prev, packetDigest, p)
+	p.Signature = ed25519.Sign(hopKey, p.Chain)
+}
+
+// CheckLink reports whether the proof is bound to the packet and to its claimed Prev by the node
+// holding hopKey.
+func (p *Proof) CheckLink(hopKey ed25519.PublicKey, packetDigest []byte) bool {
+	if len(hopKey) != ed25519.PublicKeySize || len(p.Signature) != ed25519.SignatureSize || len(p.Chain) != sha256.Size {
+		return false
+	}
+	return bytes.Equal(p.Chain, ChainLink(p.Prev, packetDigest, p)) && ed25519.Verify(hopKey, p.Chain, p.Signature)
+}
+
+// CheckChain verifies the links of a whole path, in route order, against the packet; hopKeys
+// holds the hop key of the node the route commits at every hop. It does not check the openings
+// themselves.
+func CheckChain(hopKeys []ed25519.PublicKey, proofs []*Proof, packetDigest []byte) error {
+	if len(proofs) != len(hopKeys) {
+		return fmt.Errorf("path of %v hops, the route has %v", len(proofs), len(hopKeys))
+	}
+	var prev []byte
+	for i, proof := range proofs {
+		if !bytes.Equal(proof.Prev, prev) {
+			return fmt.Errorf("hop %v (%v) is not chained to hop %v", i+1, proof.Node, i)
+		}
+		if !proof.CheckLink(hopKeys[i], packetDigest) {
+			return fmt.Errorf("hop %v (%v) is not bound to this packet by the hop the route commits there", i+1, proof.Node)
+		}
+		prev = proof.Chain
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package types_test
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"example.com/kzg-demo/kzgtest"
+	"example.com/kzg-demo/types"
+)
+
+func TestChainLinksNeedHopKey(t *testing.T) {
+	for _, hops := range []int{3, 5, 8} {
+		f, err := kzgtest.NewFixture(hops, int64(hops))
+		if err != nil {
+			t.Fatal(err)
+		}
+		packet, other := types.PacketDigest([]byte("packet")), types.PacketDigest([]byte("other packet"))
+
+		proofs := f.Chain(packet)
+		if err := types.CheckChain(f.Public, proofs, packet); err != nil {
+			t.Fatalf("%v hops: honest chain: %v", hops, err)
+		}
+		if err := types.CheckChain(f.Public, proofs, other); err == nil {
+			t.Errorf("%v hops: chain checked against another packet", hops)
+		}
+		for skipped := 1; skipped < hops-1; skipped++ {
+			keys := append(append([]ed25519.PublicKey(nil), f.Public[:skipped]...), f.Public[skipped+1:]...)
+			path := append(append([]*types.Proof(nil), proofs[:skipped]...), proofs[skipped+1:]...)
+			if err := types.CheckChain(keys, path, packet); err == nil {
+				t.Errorf("%v hops: chain with hop %v left out checked", hops, skipped)
+			}
+		}
+		if err := types.CheckChain(f.Public, proofs[:hops-1], packet); err == nil {
+			t.Errorf("%v hops: chain shorter than the route checked", hops)
+		}
+
+		// P can be interpolated from the openings on the wire, but re-binding a recorded link for
+		// another packet takes the hop key of the node that made it
+		last := hops - 1
+		rebound := *proofs[last]
+		rebound.Chain = types.ChainLink(rebound.Prev, other, &rebound)
+		if rebound.CheckLink(f.Public[last], other) {
+			t.Errorf("%v hops: recorded link re-hashed for another packet checked", hops)
+		}
+		forged := *proofs[last]
+		forged.Bind(f.HopKeys[0], forged.Prev, other)
+		if forged.CheckLink(f.Public[last], other) {
+			t.Errorf("%v hops: link bound by another route node checked", hops)
+		}
+		if !forged.CheckLink(f.Public[0], other) {
+			t.Errorf("%v hops: link refused under the key that bound it", hops)
+		}
+
+		// the sequence number is part of the link
+		renumbered := *proofs[last]
+		renumbered.Seq++
+		if renumbered.CheckLink(f.Public[last], packet) {
+			t.Errorf("%v hops: renumbered proof kept its link", hops)
+		}
+		unsigned := *proofs[last]
+		unsigned.Signature = nil
+		if unsigned.CheckLink(f.Public[last], packet) {
+			t.Errorf("%v hops: unsigned link checked", hops)
+		}
+	}
+}
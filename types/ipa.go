@@ -0,0 +1,225 @@
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	bls12381 "github.com/kilic/bls12-381"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// IPASettings commits route polynomials with a Pedersen vector commitment, C = sum a_i*G_i, and
+// opens them with a Bulletproofs-style inner product argument. The generators are hashed to the
+// curve from public seeds, so unlike KZG there is no trusted setup and no toxic waste; the price
+// is a proof of 2*log2(Width) points instead of one, and an O(Width) verifier.
+type IPASettings struct {
+	Width int // supported number of coefficients, a power of two
+	G     []bls.G1Point
+	U     bls.G1Point
+}
+
+// ipaDomain separates the generators and challenges of this scheme from other hashes.
+var ipaDomain = []byte("KZG-DEMO-IPA-BLS12381G1_XMD:SHA-256_SSWU_RO_")
+
+// NewIPASettings derives the generators for polynomials of up to width coefficients.
+func NewIPASettings(width int) (*IPASettings, error) {
+	size := 1
+	for size < width {
+		size *= 2
+	}
+	g1 := bls12381.NewG1()
+	settings := &IPASettings{Width: size, G: make([]bls.G1Point, size)}
+	for i := range settings.G {
+		var seed [8]byte
+		binary.BigEndian.PutUint64(seed[:], uint64(i))
+		point, err := g1.HashToCurve(append([]byte("G"), seed[:]...), ipaDomain)
+		if err != nil {
+			return nil, err
+		}
+		settings.G[i] = bls.G1Point(*point)
+	}
+	point, err := g1.HashToCurve([]byte("U"), ipaDomain)
+	if err != nil {
+		return nil, err
+	}
+	settings.U = bls.G1Point(*point)
+	return settings, nil
+}
+
+// IPAProof opens a commitment at one point: the L and R points of every folding round and the
+// final folded coefficient.
+type IPAProof struct {
+	L []bls.G1Point
+	R []bls.G1Point
+	A bls.Fr
+}
+
+// Size returns the encoded size of the proof in bytes.
+func (p *IPAProof) Size() int {
+	return 48*(len(p.L)+len(p.R)) + 32
+}
+
+func (s *IPASettings) Commit(polynomial []bls.Fr) (*bls.G1Point, error) {
+	if len(polynomial) > s.Width {
+		return nil, fmt.Errorf("%v coefficients do not fit in width %v", len(polynomial), s.Width)
+	}
+	return bls.LinCombG1(s.G[:len(polynomial)], polynomial), nil
+}
+
+// Open proves that the committed polynomial evaluates to y at x, like ComputeProofSingle.
+func (s *IPASettings) Open(polynomial []bls.Fr, commitment *bls.G1Point, x *bls.Fr) (*IPAProof, error) {
+	if len(polynomial) > s.Width {
+		return nil, fmt.Errorf("%v coefficients do not fit in width %v", len(polynomial), s.Width)
+	}
+	a := make([]bls.Fr, s.Width)
+	for i := range polynomial {
+		bls.CopyFr(&a[i], &polynomial[i])
+	}
+	b := powers(x, s.Width)
+	g := append([]bls.G1Point(nil), s.G...)
+
+	var y bls.Fr
+	bls.EvalPolyAt(&y, polynomial, x)
+	transcript, u := s.bindU(commitment, x, &y)
+
+	proof := &IPAProof{}
+	for n := s.Width; n > 1; n /= 2 {
+		half := n / 2
+		aL, aR := a[:half], a[half:n]
+		bL, bR := b[:half], b[half:n]
+		gL, gR := g[:half], g[half:n]
+
+		var cL, cR bls.Fr
+		innerProduct(&cL, aL, bR)
+		innerProduct(&cR, aR, bL)
+		var l, r, term bls.G1Point
+		bls.MulG1(&term, &u, &cL)
+		bls.AddG1(&l, bls.LinCombG1(gR, aL), &term)
+		bls.MulG1(&term, &u, &cR)
+		bls.AddG1(&r, bls.LinCombG1(gL, aR), &term)
+		proof.L = append(proof.L, l)
+		proof.R = append(proof.R, r)
+
+		var challenge, inverse bls.Fr
+		transcript, challenge = nextChallenge(transcript, &l, &r)
+		bls.InvModFr(&inverse, &challenge)
+		for i := 0; i < half; i++ {
+			var t1, t2 bls.Fr
+			// a' = u*aL + u^-1*aR
+			bls.MulModFr(&t1, &aL[i], &challenge)
+			bls.MulModFr(&t2, &aR[i], &inverse)
+			bls.AddModFr(&a[i], &t1, &t2)
+			// b' = u^-1*bL + u*bR
+			bls.MulModFr(&t1, &bL[i], &inverse)
+			bls.MulModFr(&t2, &bR[i], &challenge)
+			bls.AddModFr(&b[i], &t1, &t2)
+			// G' = u^-1*GL + u*GR
+			var p1, p2 bls.G1Point
+			bls.MulG1(&p1, &gL[i], &inverse)
+			bls.MulG1(&p2, &gR[i], &challenge)
+			bls.AddG1(&g[i], &p1, &p2)
+		}
+	}
+	bls.CopyFr(&proof.A, &a[0])
+	return proof, nil
+}
+
+// Verify checks an opening of commitment at x to y, like CheckProofSingle.
+func (s *IPASettings) Verify(commitment *bls.G1Point, proof *IPAProof, x *bls.Fr, y *bls.Fr) bool {
+	rounds := 0
+	for n := s.Width; n > 1; n /= 2 {
+		rounds++
+	}
+	if len(proof.L) != rounds || len(proof.R) != rounds {
+		return false
+	}
+
+	transcript, u := s.bindU(commitment, x, y)
+
+	// P = C + y*U, folded with every round's L and R
+	var p, term bls.G1Point
+	bls.MulG1(&term, &u, y)
+	bls.AddG1(&p, commitment, &term)
+
+	challenges := make([]bls.Fr, rounds)
+	inverses := make([]bls.Fr, rounds)
+	for j := 0; j < rounds; j++ {
+		transcript, challenges[j] = nextChallenge(transcript, &proof.L[j], &proof.R[j])
+		bls.InvModFr(&inverses[j], &challenges[j])
+
+		var square, inverseSquare bls.Fr
+		bls.MulModFr(&square, &challenges[j], &challenges[j])
+		bls.MulModFr(&inverseSquare, &inverses[j], &inverses[j])
+		bls.MulG1(&term, &proof.L[j], &square)
+		bls.AddG1(&p, &p, &term)
+		bls.MulG1(&term, &proof.R[j], &inverseSquare)
+		bls.AddG1(&p, &p, &term)
+	}
+
+	// the folded generator and evaluation vector are <s, G> and <s, b>, where s_i multiplies
+	// u_j for every round j in which index i fell in the right half, and u_j^-1 otherwise
+	scalars := make([]bls.Fr, s.Width)
+	for i := range scalars {
+		bls.CopyFr(&scalars[i], &bls.ONE)
+		for j := 0; j < rounds; j++ {
+			if i&(s.Width>>(j+1)) != 0 {
+				bls.MulModFr(&scalars[i], &scalars[i], &challenges[j])
+			} else {
+				bls.MulModFr(&scalars[i], &scalars[i], &inverses[j])
+			}
+		}
+	}
+	g := bls.LinCombG1(s.G, scalars)
+	var b bls.Fr
+	innerProduct(&b, scalars, powers(x, s.Width))
+
+	// expect P = a*G + a*b*U
+	var ab bls.Fr
+	bls.MulModFr(&ab, &proof.A, &b)
+	var expected bls.G1Point
+	bls.MulG1(&expected, g, &proof.A)
+	bls.MulG1(&term, &u, &ab)
+	bls.AddG1(&expected, &expected, &term)
+	return bls.EqualG1(&p, &expected)
+}
+
+// bindU starts the transcript with the statement and derives the point that carries the
+// evaluation, so a prover cannot pick y after seeing the challenges.
+func (s *IPASettings) bindU(commitment *bls.G1Point, x *bls.Fr, y *bls.Fr) ([]byte, bls.G1Point) {
+	transcript := append([]byte(nil), bls.ToCompressedG1(commitment)...)
+	xBytes, yBytes := bls.FrTo32(x), bls.FrTo32(y)
+	transcript = append(transcript, xBytes[:]...)
+	transcript = append(transcript, yBytes[:]...)
+	w := hashToFr(ipaDomain, transcript)
+
+	var u bls.G1Point
+	bls.MulG1(&u, &s.U, w)
+	wBytes := bls.FrTo32(w)
+	return wBytes[:], u
+}
+
+func nextChallenge(transcript []byte, l *bls.G1Point, r *bls.G1Point) ([]byte, bls.Fr) {
+	msg := append(append([]byte(nil), transcript...), bls.ToCompressedG1(l)...)
+	msg = append(msg, bls.ToCompressedG1(r)...)
+	challenge := hashToFr(ipaDomain, msg)
+	next := bls.FrTo32(challenge)
+	return next[:], *challenge
+}
+
+func powers(x *bls.Fr, n int) []bls.Fr {
+	out := make([]bls.Fr, n)
+	bls.CopyFr(&out[0], &bls.ONE)
+	for i := 1; i < n; i++ {
+		bls.MulModFr(&out[i], &out[i-1], x)
+	}
+	return out
+}
+
+func innerProduct(dst *bls.Fr, a []bls.Fr, b []bls.Fr) {
+	bls.CopyFr(dst, &bls.ZERO)
+	for i := range a {
+		var term bls.Fr
+		bls.MulModFr(&term, &a[i], &b[i])
+		bls.AddModFr(dst, dst, &term)
+	}
+}
@@ -0,0 +1,64 @@
+package types
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// Position labels replace the public evaluation targets 1..n of a route. Label i+1 is derived
+// from label i with an HMAC keyed by the route key, so anyone without the key sees unrelated
+// field elements and cannot tell how many hops came before. The controller keeps the key and
+// gives each hop only its own label and its predecessor's, which is enough to check that the
+// proof it received comes from its direct predecessor; whoever holds the key can walk the labels
+// from the first one and find every position.
+
+func NewRouteKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func FirstLabel(routeKey []byte) *bls.Fr {
+	return hashToFr(routeKey, []byte("first"))
+}
+
+func NextLabel(routeKey []byte, label *bls.Fr) *bls.Fr {
+	data := bls.FrTo32(label)
+	return hashToFr(routeKey, append([]byte("next"), data[:]...))
+}
+
+// Labels returns the first n labels of a route.
+func Labels(routeKey []byte, n int) []bls.Fr {
+	labels := make([]bls.Fr, n)
+	if n == 0 {
+		return labels
+	}
+	bls.CopyFr(&labels[0], FirstLabel(routeKey))
+	for i := 1; i < n; i++ {
+		bls.CopyFr(&labels[i], NextLabel(routeKey, &labels[i-1]))
+	}
+	return labels
+}
+
+// hashToFr reduces 512 bits of HMAC output modulo the field order, so the bias is negligible.
+func hashToFr(key []byte, msg []byte) *bls.Fr {
+	wide := make([]byte, 0, 64)
+	for _, suffix := range []byte{0, 1} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(msg)
+		mac.Write([]byte{suffix})
+		wide = mac.Sum(wide)
+	}
+	modulus, _ := new(big.Int).SetString(bls.ModulusStr, 10)
+	value := new(big.Int).Mod(new(big.Int).SetBytes(wide), modulus)
+
+	out := new(bls.Fr)
+	bls.SetFr(out, value.String())
+	return out
+}
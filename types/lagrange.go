@@ -0,0 +1,428 @@
+package types
+
+import (
+	"fmt"
+
+	gozkg "github.com/protolambda/go-kzg"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// LagrangeSettings commits routes in evaluation form: hop k of a route is stored as the value
+// secret_k at a slot of the domain {1, w, w^2, ...}, and the commitment is sum_k secret_k*[L_k(s)].
+// Changing the value of one slot then moves the commitment by delta*[L_slot(s)], a single G1
+// multiplication and addition, instead of re-interpolating the whole route.
+//
+// The opening of every hop moves with the commitment, so a change reaches every hop on the route,
+// but each opening is shifted in place with two G1 multiplications rather than recomputed, see
+// LagrangeRoute.
+type LagrangeSettings struct {
+	*gozkg.KZGSettings
+	Width      int
+	LagrangeG1 []bls.G1Point // [L_k(s)] for every slot k
+}
+
+// NewLagrangeSettings prepares a domain of 2^scale slots on top of the testing setup.
+func NewLagrangeSettings(scale uint8) (*LagrangeSettings, error) {
+	width := 1 << scale
+	fs := gozkg.NewFFTSettings(scale)
+	s1, s2 := gozkg.GenerateTestingSetup("1927409816240961209460912649124", uint64(width+1))
+	ks := gozkg.NewKZGSettings(fs, s1, s2)
+
+	lagrangeG1, err := fs.FFTG1(ks.SecretG1[:width], true)
+	if err != nil {
+		return nil, err
+	}
+	return &LagrangeSettings{KZGSettings: ks, Width: width, LagrangeG1: lagrangeG1}, nil
+}
+
+// Point returns the domain point w^slot.
+func (ls *LagrangeSettings) Point(slot int) *bls.Fr {
+	point, _ := SlotPoint(ls.KZGSettings, ls.Width, slot)
+	return point
+}
+
+// SlotPoint returns the point of a slot in a domain of width slots, using the roots of unity of
+// ks. Nodes use it to find where a hop is opened without holding the Lagrange basis.
+func SlotPoint(ks *gozkg.KZGSettings, width int, slot int) (*bls.Fr, error) {
+	if width <= 0 || int(ks.MaxWidth)%width != 0 {
+		return nil, fmt.Errorf("no domain of %v slots in settings of width %v", width, ks.MaxWidth)
+	}
+	if slot < 0 || slot >= width {
+		return nil, fmt.Errorf("slot %v is outside the domain of %v slots", slot, width)
+	}
+	return &ks.ExpandedRootsOfUnity[slot*(int(ks.MaxWidth)/width)], nil
+}
+
+// LagrangeRoute is the controller's view of a route committed in evaluation form.
+// Hops occupy increasing slots with gaps between them, so a hop can be inserted without moving
+// the others; unused slots hold zero. Proofs holds the opening of every hop and is kept up to
+// date by Insert, Remove and Replace.
+type LagrangeRoute struct {
+	settings   *LagrangeSettings
+	Slots      []int
+	Secrets    []uint64
+	Values     []bls.Fr
+	Commitment *bls.G1Point
+	Proofs     []*bls.G1Point
+}
+
+// LagrangeOpening is what a hop needs to prove its position: its slot, the slot of its
+// predecessor (-1 for the first hop) and its opening proof.
+type LagrangeOpening struct {
+	Slot         int
+	PreviousSlot int
+	Secret       uint64
+	Proof        *bls.G1Point
+}
+
+// CommitRoute spreads the hops evenly over the domain and commits to them in one linear combination.
+func (ls *LagrangeSettings) CommitRoute(secrets []uint64) (*LagrangeRoute, error) {
+	if len(secrets) == 0 || len(secrets) > ls.Width {
+		return nil, fmt.Errorf("a route needs 1 to %v hops, got %v", ls.Width, len(secrets))
+	}
+	return ls.CommitSlots(ls.SpreadSlots(len(secrets)), secrets)
+}
+
+// SpreadSlots returns n slots spread evenly over the domain, the layout CommitRoute uses.
+func (ls *LagrangeSettings) SpreadSlots(n int) []int {
+	gap := ls.Width / max(n, 1)
+	slots := make([]int, n)
+	for i := range slots {
+		slots[i] = i * gap
+	}
+	return slots
+}
+
+// CommitSlots commits hops at the given increasing slots from scratch, and opens every hop.
+func (ls *LagrangeSettings) CommitSlots(slots []int, secrets []uint64) (*LagrangeRoute, error) {
+	if len(slots) != len(secrets) {
+		return nil, fmt.Errorf("%v slots for %v hops", len(slots), len(secrets))
+	}
+	if err := checkUniqueSecrets(secrets); err != nil {
+		return nil, err
+	}
+	r := &LagrangeRoute{
+		settings: ls,
+		Slots:    append([]int(nil), slots...),
+		Secrets:  append([]uint64(nil), secrets...),
+		Values:   make([]bls.Fr, ls.Width),
+		Proofs:   make([]*bls.G1Point, len(slots)),
+	}
+	for i, slot := range slots {
+		if slot < 0 || slot >= ls.Width || (i > 0 && slot <= slots[i-1]) {
+			return nil, fmt.Errorf("slots must be increasing and within the domain")
+		}
+		bls.AsFr(&r.Values[slot], secrets[i])
+	}
+	r.Commitment = gozkg.CommitToEvalPoly(ls.LagrangeG1, r.Values)
+
+	polynomial, err := r.Polynomial()
+	if err != nil {
+		return nil, err
+	}
+	for i, slot := range r.Slots {
+		r.Proofs[i] = ComputeProofAt(ls.KZGSettings, polynomial, ls.Point(slot))
+	}
+	return r, nil
+}
+
+// Polynomial returns the coefficients of the route, for nodes that evaluate it themselves.
+func (r *LagrangeRoute) Polynomial() ([]bls.Fr, error) {
+	return r.settings.FFT(r.Values, true)
+}
+
+// set moves the value of one slot, updates the commitment with a single G1 operation, and shifts
+// the opening of every hop by delta times the quotient of L_slot at its slot:
+//
+//	(L_j(X) - L_j(w^i)) / (X - w^i) = (L_j(X) - w^(j-i) L_i(X)) / (w^j - w^i)   for i != j
+//
+// which needs only [L_i(s)] and [L_j(s)]. The quotient at the slot itself is computed once.
+func (r *LagrangeRoute) set(slot int, secret uint64) error {
+	var value, delta bls.Fr
+	bls.AsFr(&value, secret)
+	bls.SubModFr(&delta, &value, &r.Values[slot])
+	bls.CopyFr(&r.Values[slot], &value)
+
+	var shift, commitment bls.G1Point
+	bls.MulG1(&shift, &r.settings.LagrangeG1[slot], &delta)
+	bls.AddG1(&commitment, r.Commitment, &shift)
+	r.Commitment = &commitment
+
+	wj := r.settings.Point(slot)
+	for i, hop := range r.Slots {
+		if r.Proofs[i] == nil {
+			continue
+		}
+		var proof bls.G1Point
+		if hop == slot {
+			quotient, err := r.settings.diagonalQuotient(slot)
+			if err != nil {
+				return err
+			}
+			bls.MulG1(&shift, quotient, &delta)
+			bls.AddG1(&proof, r.Proofs[i], &shift)
+			r.Proofs[i] = &proof
+			continue
+		}
+		wi := r.settings.Point(hop)
+		var denominator, a, ratio, b bls.Fr
+		bls.SubModFr(&denominator, wj, wi)
+		bls.DivModFr(&a, &delta, &denominator) // delta / (w^j - w^i)
+		bls.DivModFr(&ratio, wj, wi)
+		bls.MulModFr(&b, &ratio, &a) // delta * w^(j-i) / (w^j - w^i)
+
+		var fromJ, fromI bls.G1Point
+		bls.MulG1(&fromJ, &r.settings.LagrangeG1[slot], &a)
+		bls.MulG1(&fromI, &r.settings.LagrangeG1[hop], &b)
+		bls.AddG1(&proof, r.Proofs[i], &fromJ)
+		bls.SubG1(&proof, &proof, &fromI)
+		r.Proofs[i] = &proof
+	}
+	return nil
+}
+
+// diagonalQuotient returns [(L_slot(X) - 1) / (X - w^slot)].
+func (ls *LagrangeSettings) diagonalQuotient(slot int) (*bls.G1Point, error) {
+	unit := make([]bls.Fr, ls.Width)
+	bls.CopyFr(&unit[slot], &bls.ONE)
+	basis, err := ls.FFT(unit, true)
+	if err != nil {
+		return nil, err
+	}
+	return ComputeProofAt(ls.KZGSettings, basis, ls.Point(slot)), nil
+}
+
+// Insert places a new hop before hop pos (pos == len appends) in a free slot between its
+// neighbours. The new hop is opened from scratch, every other hop's opening is shifted.
+func (r *LagrangeRoute) Insert(pos int, secret uint64) error {
+	if pos < 0 || pos > len(r.Slots) {
+		return fmt.Errorf("position %v out of range", pos)
+	}
+	if err := checkUniqueSecrets(append(append([]uint64(nil), r.Secrets...), secret)); err != nil {
+		return err
+	}
+
+	low, high := -1, r.settings.Width
+	if pos > 0 {
+		low = r.Slots[pos-1]
+	}
+	if pos < len(r.Slots) {
+		high = r.Slots[pos]
+	}
+	if high-low < 2 {
+		return fmt.Errorf("no free slot between hop %v and hop %v, the route must be re-committed", pos-1, pos)
+	}
+	slot := low + (high-low)/2
+
+	r.Slots = append(r.Slots[:pos], append([]int{slot}, r.Slots[pos:]...)...)
+	r.Secrets = append(r.Secrets[:pos], append([]uint64{secret}, r.Secrets[pos:]...)...)
+	r.Proofs = append(r.Proofs[:pos], append([]*bls.G1Point{nil}, r.Proofs[pos:]...)...)
+	if err := r.set(slot, secret); err != nil {
+		return err
+	}
+
+	polynomial, err := r.Polynomial()
+	if err != nil {
+		return err
+	}
+	r.Proofs[pos] = ComputeProofAt(r.settings.KZGSettings, polynomial, r.settings.Point(slot))
+	return nil
+}
+
+// Remove clears the slot of hop pos and shifts the openings of the remaining hops.
+func (r *LagrangeRoute) Remove(pos int) error {
+	if pos < 0 || pos >= len(r.Slots) {
+		return fmt.Errorf("position %v out of range", pos)
+	}
+	slot := r.Slots[pos]
+	r.Slots = append(r.Slots[:pos], r.Slots[pos+1:]...)
+	r.Secrets = append(r.Secrets[:pos], r.Secrets[pos+1:]...)
+	r.Proofs = append(r.Proofs[:pos], r.Proofs[pos+1:]...)
+	return r.set(slot, 0)
+}
+
+// Replace puts another node at hop pos and shifts the opening of every hop, its own included.
+func (r *LagrangeRoute) Replace(pos int, secret uint64) error {
+	if pos < 0 || pos >= len(r.Slots) {
+		return fmt.Errorf("position %v out of range", pos)
+	}
+	secrets := append([]uint64(nil), r.Secrets...)
+	secrets[pos] = secret
+	if err := checkUniqueSecrets(secrets); err != nil {
+		return err
+	}
+	r.Secrets[pos] = secret
+	return r.set(r.Slots[pos], secret)
+}
+
+// Clone copies the route, so it can be updated while the original stays committed.
+func (r *LagrangeRoute) Clone() *LagrangeRoute {
+	return &LagrangeRoute{
+		settings:   r.settings,
+		Slots:      append([]int(nil), r.Slots...),
+		Secrets:    append([]uint64(nil), r.Secrets...),
+		Values:     append([]bls.Fr(nil), r.Values...),
+		Commitment: r.Commitment,
+		Proofs:     append([]*bls.G1Point(nil), r.Proofs...),
+	}
+}
+
+// Openings returns the opening of every hop against the current commitment.
+func (r *LagrangeRoute) Openings() []LagrangeOpening {
+	openings := make([]LagrangeOpening, len(r.Slots))
+	for i, slot := range r.Slots {
+		openings[i] = LagrangeOpening{
+			Slot:         slot,
+			PreviousSlot: -1,
+			Secret:       r.Secrets[i],
+			Proof:        r.Proofs[i],
+		}
+		if i > 0 {
+			openings[i].PreviousSlot = r.Slots[i-1]
+		}
+	}
+	return openings
+}
+
+// Verify checks that the hop at slot carries the given secret.
+func (ls *LagrangeSettings) Verify(commitment *bls.G1Point, slot int, secret uint64, proof *bls.G1Point) bool {
+	if slot < 0 || slot >= ls.Width {
+		return false
+	}
+	var y bls.Fr
+	bls.AsFr(&y, secret)
+	return ls.CheckProofSingle(commitment, proof, ls.Point(slot), &y)
+}
+
+// setupLagrange commits the route in evaluation form, at c.Slots or spread evenly.
+func (c *Controller) setupLagrange(nodesPrivateData []uint32) (*gozkg.KZGSettings, []bls.Fr, error) {
+	if c.PaddedDegree > 0 || c.RouteKey != nil {
+		return nil, nil, fmt.Errorf("routes in Lagrange form cannot be padded or hide their positions")
+	}
+	if len(nodesPrivateData) > c.Lagrange.Width {
+		return nil, nil, fmt.Errorf("%v nodes do not fit in a domain of %v slots", len(nodesPrivateData), c.Lagrange.Width)
+	}
+	secrets := make([]uint64, len(nodesPrivateData))
+	for i, data := range nodesPrivateData {
+		secrets[i] = uint64(data)
+	}
+	slots := c.Slots
+	if slots == nil {
+		slots = c.Lagrange.SpreadSlots(len(secrets))
+	}
+	route, err := c.Lagrange.CommitSlots(slots, secrets)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.Route = route
+	return c.updated()
+}
+
+// updated refreshes the coefficients and slots of the controller after its Lagrange route changed.
+func (c *Controller) updated() (*gozkg.KZGSettings, []bls.Fr, error) {
+	polynomial, err := c.Route.Polynomial()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.Polynomial = polynomial
+	c.KzgSettings = c.Lagrange.KZGSettings
+	c.Slots = c.Route.Slots
+	return c.KzgSettings, polynomial, nil
+}
+
+// Insert adds a hop before hop pos of a route set up in Lagrange form, without re-interpolating it.
+func (c *Controller) Insert(pos int, data uint32) error {
+	if c.Route == nil {
+		return fmt.Errorf("the route is not committed in Lagrange form")
+	}
+	if err := c.Route.Insert(pos, uint64(data)); err != nil {
+		return err
+	}
+	_, _, err := c.updated()
+	return err
+}
+
+// Remove drops hop pos of a route set up in Lagrange form.
+func (c *Controller) Remove(pos int) error {
+	if c.Route == nil {
+		return fmt.Errorf("the route is not committed in Lagrange form")
+	}
+	if err := c.Route.Remove(pos); err != nil {
+		return err
+	}
+	_, _, err := c.updated()
+	return err
+}
+
+// Replace puts another node at hop pos of a route set up in Lagrange form.
+func (c *Controller) Replace(pos int, data uint32) error {
+	if c.Route == nil {
+		return fmt.Errorf("the route is not committed in Lagrange form")
+	}
+	if err := c.Route.Replace(pos, uint64(data)); err != nil {
+		return err
+	}
+	_, _, err := c.updated()
+	return err
+}
+
+// Update moves a route set up in Lagrange form to private data that differs from it by one
+// inserted, removed or replaced hop. Any other change needs a fresh Setup.
+func (c *Controller) Update(nodesPrivateData []uint32) error {
+	if c.Route == nil {
+		return fmt.Errorf("the route is not committed in Lagrange form")
+	}
+	old := c.Route.Secrets
+	prefix := 0
+	for prefix < min(len(old), len(nodesPrivateData)) && old[prefix] == uint64(nodesPrivateData[prefix]) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < min(len(old), len(nodesPrivateData))-prefix && old[len(old)-1-suffix] == uint64(nodesPrivateData[len(nodesPrivateData)-1-suffix]) {
+		suffix++
+	}
+
+	switch {
+	case len(nodesPrivateData) == len(old) && prefix == len(old):
+		return nil
+	case len(nodesPrivateData) == len(old)+1 && prefix+suffix == len(old):
+		return c.Insert(prefix, nodesPrivateData[prefix])
+	case len(nodesPrivateData) == len(old)-1 && prefix+suffix == len(nodesPrivateData):
+		return c.Remove(prefix)
+	case len(nodesPrivateData) == len(old) && prefix+suffix == len(old)-1:
+		return c.Replace(prefix, nodesPrivateData[prefix])
+	}
+	return fmt.Errorf("the route changed by more than one hop")
+}
+
+func checkUniqueSecrets(secrets []uint64) error {
+	used := make(map[uint64]bool)
+	for _, secret := range secrets {
+		if secret == 0 {
+			return fmt.Errorf("secret 0 is reserved for empty slots")
+		}
+		if used[secret] {
+			return fmt.Errorf("private data must be unique for each node")
+		}
+		used[secret] = true
+	}
+	return nil
+}
+
+// ComputeProofAt is ComputeProofSingle for an arbitrary field element z.
+func ComputeProofAt(ks *gozkg.KZGSettings, polynomial []bls.Fr, z *bls.Fr) *bls.G1Point {
+	if len(polynomial) < 2 {
+		proof := bls.ZeroG1
+		return &proof
+	}
+
+	// synthetic division by (X - z); the remainder P(z) is dropped
+	quotient := make([]bls.Fr, len(polynomial)-1)
+	bls.CopyFr(&quotient[len(quotient)-1], &polynomial[len(polynomial)-1])
+	for i := len(quotient) - 1; i > 0; i-- {
+		var tmp bls.Fr
+		bls.MulModFr(&tmp, &quotient[i], z)
+		bls.AddModFr(&quotient[i-1], &polynomial[i], &tmp)
+	}
+	return bls.LinCombG1(ks.SecretG1[:len(quotient)], quotient)
+}
@@ -0,0 +1,126 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// checkAgainstSetup compares a controller updated in place with a fresh Setup of the same hops.
+func checkAgainstSetup(t *testing.T, name string, settings *LagrangeSettings, c *Controller) {
+	t.Helper()
+	data := make([]uint32, len(c.Route.Secrets))
+	for i, secret := range c.Route.Secrets {
+		data[i] = uint32(secret)
+	}
+	fresh := Controller{Lagrange: settings, Slots: append([]int(nil), c.Slots...)}
+	if _, _, err := fresh.Setup(data); err != nil {
+		t.Fatalf("%v: fresh setup: %v", name, err)
+	}
+	if !bls.EqualG1(c.Commit(), fresh.Commit()) {
+		t.Fatalf("%v: incremental commitment differs from a fresh Setup", name)
+	}
+	if !bls.EqualG1(c.Commit(), c.KzgSettings.CommitToPoly(c.Polynomial)) {
+		t.Fatalf("%v: commitment does not match the coefficients", name)
+	}
+	openings, freshOpenings := c.Route.Openings(), fresh.Route.Openings()
+	for i, opening := range openings {
+		if opening.Slot != freshOpenings[i].Slot || opening.PreviousSlot != freshOpenings[i].PreviousSlot {
+			t.Errorf("%v: hop %v at slot %v after %v, fresh Setup has %v after %v", name, i, opening.Slot, opening.PreviousSlot, freshOpenings[i].Slot, freshOpenings[i].PreviousSlot)
+		}
+		if !bls.EqualG1(opening.Proof, freshOpenings[i].Proof) {
+			t.Errorf("%v: opening of hop %v differs from a fresh Setup", name, i)
+		}
+		if !settings.Verify(c.Commit(), opening.Slot, opening.Secret, opening.Proof) {
+			t.Errorf("%v: opening of hop %v does not verify", name, i)
+		}
+		if settings.Verify(c.Commit(), opening.Slot, opening.Secret+1, opening.Proof) {
+			t.Errorf("%v: opening of hop %v verifies a wrong secret", name, i)
+		}
+	}
+}
+
+func TestLagrangeUpdatesMatchSetup(t *testing.T) {
+	settings, err := NewLagrangeSettings(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Controller{Lagrange: settings}
+	if _, _, err := c.Setup([]uint32{11, 22, 33, 44}); err != nil {
+		t.Fatal(err)
+	}
+	checkAgainstSetup(t, "setup", settings, &c)
+
+	updates := []struct {
+		name  string
+		apply func() error
+	}{
+		{"insert", func() error { return c.Insert(2, 55) }},
+		{"insert after first", func() error { return c.Insert(1, 66) }},
+		{"append", func() error { return c.Insert(len(c.Slots), 77) }},
+		{"remove", func() error { return c.Remove(1) }},
+		{"replace", func() error { return c.Replace(2, 88) }},
+		{"replace last", func() error { return c.Replace(len(c.Slots)-1, 99) }},
+	}
+	for _, update := range updates {
+		if err := update.apply(); err != nil {
+			t.Fatalf("%v: %v", update.name, err)
+		}
+		checkAgainstSetup(t, update.name, settings, &c)
+	}
+
+	if err := c.Replace(0, 22); err == nil {
+		t.Error("replace accepted private data used by another hop")
+	}
+	if err := c.Remove(len(c.Slots)); err == nil {
+		t.Error("remove accepted a position past the route")
+	}
+}
+
+func TestLagrangeInsertNeedsFreeSlot(t *testing.T) {
+	settings, err := NewLagrangeSettings(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Controller{Lagrange: settings}
+	if _, _, err := c.Setup([]uint32{1, 2, 3, 4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Insert(1, 5); err == nil {
+		t.Error("insert into a full domain succeeded")
+	}
+}
+
+func TestLagrangeUpdateFindsOneHopChanges(t *testing.T) {
+	settings, err := NewLagrangeSettings(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		data []uint32
+		ok   bool
+	}{
+		{"unchanged", []uint32{1, 2, 3}, true},
+		{"insert", []uint32{1, 4, 2, 3}, true},
+		{"append", []uint32{1, 2, 3, 4}, true},
+		{"remove", []uint32{1, 3}, true},
+		{"replace", []uint32{1, 4, 3}, true},
+		{"two hops", []uint32{4, 2, 5}, false},
+		{"swap", []uint32{1, 3, 2}, false},
+	}
+	for _, test := range tests {
+		c := Controller{Lagrange: settings}
+		if _, _, err := c.Setup([]uint32{1, 2, 3}); err != nil {
+			t.Fatal(err)
+		}
+		err := c.Update(test.data)
+		if (err == nil) != test.ok {
+			t.Errorf("%v: got %v", test.name, err)
+			continue
+		}
+		if err == nil {
+			checkAgainstSetup(t, test.name, settings, &c)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package types
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// The controller appends every commitment it publishes to a Merkle tree, hashed as in RFC 6962,
+// and signs the root. A node checks that its commitment is included under the signed root, and
+// nodes and auditors compare roots: two parties shown different commitments for the same flow
+// hold tree heads that are not consistent with each other.
+
+const treeHeadDomain = "KZG-DEMO-TREE-HEAD-V1"
+
+// LogLeaf encodes a published commitment as a leaf of the transparency log.
+func LogLeaf(flowID string, epoch uint64, version uint64, commitment *bls.G1Point) []byte {
+	leaf := binary.BigEndian.AppendUint32(nil, uint32(len(flowID)))
+	leaf = append(leaf, flowID...)
+	leaf = binary.BigEndian.AppendUint64(leaf, epoch)
+	leaf = binary.BigEndian.AppendUint64(leaf, version)
+	return append(leaf, bls.ToCompressedG1(commitment)...)
+}
+
+func LeafHash(leaf []byte) []byte {
+	h := sha256.Sum256(append([]byte{0}, leaf...))
+	return h[:]
+}
+
+func nodeHash(left []byte, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// splitPoint returns the largest power of two smaller than n.
+func splitPoint(n uint64) uint64 {
+	return 1 << (bits.Len64(n-1) - 1)
+}
+
+// RootHash computes the root of a tree over leaf hashes.
+func RootHash(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		h := sha256.Sum256(nil)
+		return h[:]
+	case 1:
+		return leaves[0]
+	}
+	k := splitPoint(uint64(len(leaves)))
+	return nodeHash(RootHash(leaves[:k]), RootHash(leaves[k:]))
+}
+
+// InclusionProof shows that the leaf at Index is part of the tree of TreeSize leaves.
+type InclusionProof struct {
+	Index    uint64
+	TreeSize uint64
+	Hashes   [][]byte
+}
+
+// ProveInclusion computes the audit path of leaf index in a tree over leaf hashes.
+func ProveInclusion(leaves [][]byte, index uint64) (*InclusionProof, error) {
+	if index >= uint64(len(leaves)) {
+		return nil, fmt.Errorf("leaf %v is not in a tree of %v leaves", index, len(leaves))
+	}
+	return &InclusionProof{Index: index, TreeSize: uint64(len(leaves)), Hashes: auditPath(leaves, index)}, nil
+}
+
+func auditPath(leaves [][]byte, index uint64) [][]byte {
+	n := uint64(len(leaves))
+	if n <= 1 {
+		return nil
+	}
+	k := splitPoint(n)
+	if index < k {
+		return append(auditPath(leaves[:k], index), RootHash(leaves[k:]))
+	}
+	return append(auditPath(leaves[k:], index-k), RootHash(leaves[:k]))
+}
+
+// VerifyInclusion checks a proof that leafHash is included under root.
+func VerifyInclusion(proof *InclusionProof, leafHash []byte, root []byte) bool {
+	if proof == nil || proof.Index >= proof.TreeSize {
+		return false
+	}
+	fn, sn := proof.Index, proof.TreeSize-1
+	r := leafHash
+	for _, p := range proof.Hashes {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(r, root)
+}
+
+// ProveConsistency shows that the tree of the first `first` leaves is a prefix of the tree over
+// all leaves, i.e., that the log was only appended to.
+func ProveConsistency(leaves [][]byte, first uint64) ([][]byte, error) {
+	if first == 0 || first > uint64(len(leaves)) {
+		return nil, fmt.Errorf("no consistency proof from %v to %v leaves", first, len(leaves))
+	}
+	return subProof(leaves, first, true), nil
+}
+
+func subProof(leaves [][]byte, m uint64, complete bool) [][]byte {
+	n := uint64(len(leaves))
+	if m == n {
+		if complete {
+			return nil
+		}
+		return [][]byte{RootHash(leaves)}
+	}
+	k := splitPoint(n)
+	if m <= k {
+		return append(subProof(leaves[:k], m, complete), RootHash(leaves[k:]))
+	}
+	return append(subProof(leaves[k:], m-k, false), RootHash(leaves[:k]))
+}
+
+// VerifyConsistency checks that the tree of size first with firstRoot is a prefix of the tree of
+// size second with secondRoot.
+func VerifyConsistency(first uint64, second uint64, firstRoot []byte, secondRoot []byte, proof [][]byte) bool {
+	switch {
+	case first > second:
+		return false
+	case first == second:
+		return len(proof) == 0 && bytes.Equal(firstRoot, secondRoot)
+	case first == 0:
+		return len(proof) == 0
+	case len(proof) == 0:
+		return false
+	}
+
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = nodeHash(c, fr)
+			sr = nodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = nodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(fr, firstRoot) && bytes.Equal(sr, secondRoot)
+}
+
+// TreeHead is the controller's signed statement of the log's size and root.
+type TreeHead struct {
+	Size      uint64
+	Root      []byte
+	Signature []byte
+}
+
+func (t *TreeHead) digest() []byte {
+	h := sha256.New()
+	h.Write([]byte(treeHeadDomain))
+	h.Write(binary.BigEndian.AppendUint64(nil, t.Size))
+	h.Write(t.Root)
+	return h.Sum(nil)
+}
+
+func (t *TreeHead) Sign(key ed25519.PrivateKey) {
+	t.Signature = ed25519.Sign(key, t.digest())
+}
+
+// Verify checks the controller's signature on the tree head.
+func (t *TreeHead) Verify(controllerKey ed25519.PublicKey) bool {
+	return t != nil && len(t.Root) == sha256.Size && len(controllerKey) == ed25519.PublicKeySize &&
+		ed25519.Verify(controllerKey, t.digest(), t.Signature)
+}
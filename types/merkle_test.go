@@ -0,0 +1,240 @@
+package types
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Leaves and hashes of the certificate-transparency reference test data for RFC 6962, which
+// RFC 9162 hashes the same way.
+var merkleLeaves = []string{
+	"", "00", "10", "2021", "3031", "40414243", "5051525354555657", "606162636465666768696a6b6c6d6e6f",
+}
+
+var merkleRoots = []string{
+	"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+	"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+	"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+	"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+	"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+	"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+	"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+}
+
+func fromHex(t *testing.T, hashes ...string) [][]byte {
+	t.Helper()
+	out := make([][]byte, len(hashes))
+	for i, h := range hashes {
+		var err error
+		if out[i], err = hex.DecodeString(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out
+}
+
+func merkleLeafHashes(t *testing.T, n int) [][]byte {
+	t.Helper()
+	leaves := fromHex(t, merkleLeaves[:n]...)
+	for i := range leaves {
+		leaves[i] = LeafHash(leaves[i])
+	}
+	return leaves
+}
+
+func TestRootHash(t *testing.T) {
+	if got := hex.EncodeToString(RootHash(nil)); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("empty tree: got %v", got)
+	}
+	for n := 1; n <= len(merkleLeaves); n++ {
+		if got := hex.EncodeToString(RootHash(merkleLeafHashes(t, n))); got != merkleRoots[n-1] {
+			t.Errorf("size %v: got %v, want %v", n, got, merkleRoots[n-1])
+		}
+	}
+}
+
+func TestInclusion(t *testing.T) {
+	tests := []struct {
+		index, size uint64
+		path        []string
+	}{
+		{0, 1, nil},
+		{0, 2, []string{"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7"}},
+		{1, 2, []string{"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d"}},
+		{2, 3, []string{"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125"}},
+		{1, 5, []string{
+			"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		}},
+		{6, 7, []string{
+			"0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+		{0, 8, []string{
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+		}},
+		{5, 8, []string{
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+	}
+	for _, test := range tests {
+		leaves := merkleLeafHashes(t, int(test.size))
+		root := fromHex(t, merkleRoots[test.size-1])[0]
+		proof, err := ProveInclusion(leaves, test.index)
+		if err != nil {
+			t.Fatalf("leaf %v of %v: %v", test.index, test.size, err)
+		}
+		want := fromHex(t, test.path...)
+		if len(proof.Hashes) != len(want) {
+			t.Errorf("leaf %v of %v: path of %v hashes, want %v", test.index, test.size, len(proof.Hashes), len(want))
+			continue
+		}
+		for i := range want {
+			if !bytes.Equal(proof.Hashes[i], want[i]) {
+				t.Errorf("leaf %v of %v: hash %v is %x, want %x", test.index, test.size, i, proof.Hashes[i], want[i])
+			}
+		}
+		if !VerifyInclusion(proof, leaves[test.index], root) {
+			t.Errorf("leaf %v of %v: proof refused", test.index, test.size)
+		}
+
+		// the root does not commit to the size, so a path can fit trees of several sizes; agents
+		// take the size from the signed tree head
+		other := LeafHash([]byte("other"))
+		type badProof struct {
+			name  string
+			proof *InclusionProof
+			leaf  []byte
+		}
+		bad := []badProof{
+			{"another leaf", proof, other},
+			{"another index", &InclusionProof{Index: (test.index + 1) % test.size, TreeSize: test.size, Hashes: proof.Hashes}, leaves[test.index]},
+			{"index past the end", &InclusionProof{Index: test.size, TreeSize: test.size, Hashes: proof.Hashes}, leaves[test.index]},
+			{"extra hash", &InclusionProof{Index: test.index, TreeSize: test.size, Hashes: append(append([][]byte(nil), proof.Hashes...), other)}, leaves[test.index]},
+		}
+		if len(proof.Hashes) > 0 {
+			bad = append(bad, badProof{"truncated path", &InclusionProof{Index: test.index, TreeSize: test.size, Hashes: proof.Hashes[:len(proof.Hashes)-1]}, leaves[test.index]})
+		}
+		for _, b := range bad {
+			if test.size == 1 && b.name == "another index" {
+				continue // a tree of one leaf has one index
+			}
+			if VerifyInclusion(b.proof, b.leaf, root) {
+				t.Errorf("leaf %v of %v: %v verified", test.index, test.size, b.name)
+			}
+		}
+	}
+}
+
+func TestConsistency(t *testing.T) {
+	tests := []struct {
+		first, second uint64
+		proof         []string
+	}{
+		{1, 1, nil},
+		{1, 2, []string{"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7"}},
+		{2, 5, []string{
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"bc1a0643b12e4d2d7c77918f44e0f4f79a838b6cf9ec5b5c283e1f4d88599e6b",
+		}},
+		{4, 7, []string{"837dbb152e9b079010717e84e865da4ebc0fa198a806d59d31bf15accef22d0e"}},
+		{1, 8, []string{
+			"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+			"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+			"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+		}},
+		{6, 8, []string{
+			"0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a",
+			"ca854ea128ed050b41b35ffc1b87b8eb2bde461e9e3b5596ece6b9d5975a0ae0",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+		{7, 8, []string{
+			"b08693ec2e721597130641e8211e7eedccb4c26413963eee6c1e2ed16ffb1a5f",
+			"46f6ffadd3d06a09ff3c5860d2755c8b9819db7df44251788c7d8e3180de8eb1",
+			"0ebc5d3437fbe2db158b9f126a1d118e308181031d0a949f8dededebc558ef6a",
+			"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		}},
+	}
+	for _, test := range tests {
+		leaves := merkleLeafHashes(t, int(test.second))
+		firstRoot := fromHex(t, merkleRoots[test.first-1])[0]
+		secondRoot := fromHex(t, merkleRoots[test.second-1])[0]
+		proof, err := ProveConsistency(leaves, test.first)
+		if err != nil {
+			t.Fatalf("%v to %v: %v", test.first, test.second, err)
+		}
+		want := fromHex(t, test.proof...)
+		if len(proof) != len(want) {
+			t.Errorf("%v to %v: proof of %v hashes, want %v", test.first, test.second, len(proof), len(want))
+			continue
+		}
+		for i := range want {
+			if !bytes.Equal(proof[i], want[i]) {
+				t.Errorf("%v to %v: hash %v is %x, want %x", test.first, test.second, i, proof[i], want[i])
+			}
+		}
+		if !VerifyConsistency(test.first, test.second, firstRoot, secondRoot, proof) {
+			t.Errorf("%v to %v: proof refused", test.first, test.second)
+		}
+		if test.first == test.second {
+			continue
+		}
+
+		tampered := append([][]byte(nil), proof...)
+		tampered[len(tampered)-1] = LeafHash([]byte("other"))
+		otherRoot := LeafHash([]byte("other"))
+		bad := []struct {
+			name                  string
+			first, second         uint64
+			firstRoot, secondRoot []byte
+			proof                 [][]byte
+		}{
+			{"tampered hash", test.first, test.second, firstRoot, secondRoot, tampered},
+			{"forked first root", test.first, test.second, otherRoot, secondRoot, proof},
+			{"forked second root", test.first, test.second, firstRoot, otherRoot, proof},
+			{"sizes swapped", test.second, test.first, secondRoot, firstRoot, proof},
+			{"no proof", test.first, test.second, firstRoot, secondRoot, nil},
+			{"truncated proof", test.first, test.second, firstRoot, secondRoot, proof[:len(proof)-1]},
+			{"extra hash", test.first, test.second, firstRoot, secondRoot, append(append([][]byte(nil), proof...), otherRoot)},
+		}
+		for _, b := range bad {
+			if VerifyConsistency(b.first, b.second, b.firstRoot, b.secondRoot, b.proof) {
+				t.Errorf("%v to %v: %v verified", test.first, test.second, b.name)
+			}
+		}
+	}
+
+	if _, err := ProveConsistency(merkleLeafHashes(t, 3), 0); err == nil {
+		t.Error("proved consistency from the empty tree")
+	}
+	if _, err := ProveConsistency(merkleLeafHashes(t, 3), 4); err == nil {
+		t.Error("proved consistency with a larger tree")
+	}
+}
+
+// Every proof the log serves for the vector leaves must verify, not only the published ones.
+func TestMerkleProofsRoundTrip(t *testing.T) {
+	for n := 1; n <= len(merkleLeaves); n++ {
+		leaves := merkleLeafHashes(t, n)
+		root := RootHash(leaves)
+		for i := 0; i < n; i++ {
+			proof, err := ProveInclusion(leaves, uint64(i))
+			if err != nil || !VerifyInclusion(proof, leaves[i], root) {
+				t.Errorf("leaf %v of %v: %v", i, n, err)
+			}
+		}
+		for m := 1; m <= n; m++ {
+			proof, err := ProveConsistency(leaves, uint64(m))
+			if err != nil || !VerifyConsistency(uint64(m), uint64(n), RootHash(leaves[:m]), root, proof) {
+				t.Errorf("%v to %v: %v", m, n, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package types
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"example.com/kzg-demo/keystore"
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// SetupParams carries the public KZG setup points from the controller to the nodes.
+type SetupParams struct {
+	SecretG1 []bls.G1Point
+	SecretG2 []bls.G2Point
+}
+
+// FlowParams is what a node needs to prove and verify hops of one flow.
+// When the flow hides hop positions, Route and Position are left out and the node gets the route
+// key and its own label instead.
+type FlowParams struct {
+	FlowID        string
+	Version       uint64
+	Route         []string
+	Position      int      // y value proven by this node, starts from 1
+	Previous      string   // previous hop, empty for the first one
+	Visit         int      // earlier visits of this node on the route; a node gets one FlowParams per visit
+	Polynomial    []string // decimal coefficients
+	Commitment    *bls.G1Point
+	Label         string          `json:",omitempty"` // decimal position label proven by this node
+	PreviousLabel string          `json:",omitempty"` // label proven by the previous hop, empty for the first one
+	Signature     []byte          // controller's signature over the commitment, see SignParams
+	Inclusion     *InclusionProof // the commitment is in the transparency log under NodeParams.TreeHead
+	Policy        string          `json:",omitempty"` // what verifiers do on failure, see package policy
+
+	// Width is set if the route is committed in Lagrange form, see LagrangeSettings: the node
+	// then gets no polynomial, but its opening at Slot, and checks its predecessor at PreviousSlot.
+	Width        int          `json:",omitempty"`
+	Slot         int          `json:",omitempty"`
+	PreviousSlot int          `json:",omitempty"`
+	Opening      *bls.G1Point `json:",omitempty"`
+}
+
+// EpochParams holds a node's secret and flows for one epoch.
+// Verifiers accept the epoch from NotBefore until NotAfter (zero while it has no successor).
+type EpochParams struct {
+	Epoch     uint64
+	NotBefore time.Time
+	NotAfter  time.Time
+	Secret    uint64
+	Flows     []FlowParams
+}
+
+// Active reports whether proofs of this epoch are acceptable at t.
+func (e *EpochParams) Active(t time.Time) bool {
+	return !t.Before(e.NotBefore) && (e.NotAfter.IsZero() || t.Before(e.NotAfter))
+}
+
+// NodeParams is the secret-bound parameter bundle downloaded by a node agent.
+type NodeParams struct {
+	Node     string
+	Setup    SetupParams
+	Epochs   []EpochParams
+	Revoked  []string  // nodes whose proofs must be refused
+	TreeHead *TreeHead // signed head of the controller's transparency log
+	HopKeys  []HopKey  // keys the nodes sign chain links with, see Proof.Bind
+}
+
+// HopKey is the public key a node signs its chain links with, vouched for by the controller.
+type HopKey struct {
+	Node      string
+	Key       []byte // Ed25519 public key
+	Signature []byte // controller's signature, see SignHopKey
+}
+
+func (p NodeParams) String() string {
+	return fmt.Sprintf("NodeParams{Node: %v, Secrets: %v, Epochs: %v}", p.Node, keystore.Redacted, len(p.Epochs))
+}
+
+func (p NodeParams) GoString() string {
+	return p.String()
+}
+
+// Proof is the proof-of-transit data a hop hands to the next one.
+type Proof struct {
+	FlowID    string
+	Epoch     uint64
+	Version   uint64
+	Node      string
+	X         string // decimal bls.Fr
+	Y         string // decimal bls.Fr
+	Proof     *bls.G1Point
+	Seq       uint64 `json:",omitempty"` // packet number in the flow, set by the ingress, see package replay
+	Prev      []byte `json:",omitempty"` // Chain of the proof this hop received, see Bind
+	Chain     []byte `json:",omitempty"` // binds this proof to Prev and the packet
+	Signature []byte `json:",omitempty"` // the proving node's signature over Chain with its hop key
+}
+
+func PolynomialToStrings(polynomial []bls.Fr) []string {
+	coeffs := make([]string, len(polynomial))
+	for i := range polynomial {
+		coeffs[i] = polynomial[i].String()
+	}
+	return coeffs
+}
+
+func PolynomialFromStrings(coeffs []string) ([]bls.Fr, error) {
+	polynomial := make([]bls.Fr, len(coeffs))
+	for i, coeff := range coeffs {
+		if err := FrFromString(&polynomial[i], coeff); err != nil {
+			return nil, fmt.Errorf("coefficient %v: %w", i, err)
+		}
+	}
+	return polynomial, nil
+}
+
+// FrFromString parses a decimal field element, rejecting values outside of the field.
+func FrFromString(dst *bls.Fr, v string) error {
+	value, ok := new(big.Int).SetString(v, 10)
+	if !ok {
+		return fmt.Errorf("invalid field element %q", v)
+	}
+	modulus, _ := new(big.Int).SetString(bls.ModulusStr, 10)
+	if value.Sign() < 0 || value.Cmp(modulus) >= 0 {
+		return fmt.Errorf("field element %q out of range", v)
+	}
+	bls.SetFr(dst, v)
+	return nil
+}
@@ -0,0 +1,96 @@
+package types
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/protolambda/go-kzg/bls"
+)
+
+// The controller signs every commitment it publishes together with the flow, epoch, version and
+// a hash of the setup it was computed with, so a node can tell that its parameters come from the
+// legitimate controller and were not swapped for another route's or another setup's.
+
+const paramsDomain = "KZG-DEMO-PARAMS-V1"
+
+// SetupHash identifies a setup by its points.
+func SetupHash(secretG1 []bls.G1Point, secretG2 []bls.G2Point) [32]byte {
+	h := sha256.New()
+	for i := range secretG1 {
+		h.Write(bls.ToCompressedG1(&secretG1[i]))
+	}
+	for i := range secretG2 {
+		h.Write(bls.ToCompressedG2(&secretG2[i]))
+	}
+	var out [32]byte
+	h.Sum(out[:0])
+	return out
+}
+
+// ParamsDigest is the message the controller signs for a commitment.
+func ParamsDigest(flowID string, epoch uint64, version uint64, commitment *bls.G1Point, setupHash [32]byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(paramsDomain))
+	h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(flowID))))
+	h.Write([]byte(flowID))
+	h.Write(binary.BigEndian.AppendUint64(nil, epoch))
+	h.Write(binary.BigEndian.AppendUint64(nil, version))
+	h.Write(bls.ToCompressedG1(commitment))
+	h.Write(setupHash[:])
+	return h.Sum(nil)
+}
+
+func SignParams(key ed25519.PrivateKey, flowID string, epoch uint64, version uint64, commitment *bls.G1Point, setupHash [32]byte) []byte {
+	return ed25519.Sign(key, ParamsDigest(flowID, epoch, version, commitment, setupHash))
+}
+
+// VerifyParams reports whether signature is the controller's signature over the parameters.
+// Missing keys, signatures or commitments never verify.
+func VerifyParams(controllerKey ed25519.PublicKey, signature []byte, flowID string, epoch uint64, version uint64, commitment *bls.G1Point, setupHash [32]byte) bool {
+	if len(controllerKey) != ed25519.PublicKeySize || len(signature) != ed25519.SignatureSize || commitment == nil {
+		return false
+	}
+	return ed25519.Verify(controllerKey, ParamsDigest(flowID, epoch, version, commitment, setupHash), signature)
+}
+
+// Sign attaches the controller's signature to the public parameters of a route.
+func (p *PublicStorage) Sign(key ed25519.PrivateKey, flowID string, epoch uint64, version uint64) {
+	p.Signature = SignParams(key, flowID, epoch, version, p.PolynomialCommitment,
+		SetupHash(p.KzgSettings.SecretG1, p.KzgSettings.SecretG2))
+}
+
+// Verify checks the controller's signature on the public parameters of a route.
+func (p *PublicStorage) Verify(controllerKey ed25519.PublicKey, flowID string, epoch uint64, version uint64) bool {
+	return VerifyParams(controllerKey, p.Signature, flowID, epoch, version, p.PolynomialCommitment,
+		SetupHash(p.KzgSettings.SecretG1, p.KzgSettings.SecretG2))
+}
+
+// The controller also vouches for the hop key of every node, which the node generates and keeps
+// to itself; verifiers check chain links against the key of the node the route commits, so the
+// binding between a key and a node name must come from the controller too.
+
+const hopKeyDomain = "KZG-DEMO-HOP-KEY-V1"
+
+// HopKeyDigest is the message the controller signs for the hop key of a node.
+func HopKeyDigest(node string, hopKey ed25519.PublicKey) []byte {
+	h := sha256.New()
+	h.Write([]byte(hopKeyDomain))
+	h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(node))))
+	h.Write([]byte(node))
+	h.Write(hopKey)
+	return h.Sum(nil)
+}
+
+func SignHopKey(key ed25519.PrivateKey, node string, hopKey ed25519.PublicKey) HopKey {
+	return HopKey{Node: node, Key: hopKey, Signature: ed25519.Sign(key, HopKeyDigest(node, hopKey))}
+}
+
+// Verify reports whether the hop key is signed by the controller. Missing keys or signatures
+// never verify.
+func (k *HopKey) Verify(controllerKey ed25519.PublicKey) bool {
+	if len(controllerKey) != ed25519.PublicKeySize || len(k.Key) != ed25519.PublicKeySize || len(k.Signature) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(controllerKey, HopKeyDigest(k.Node, k.Key), k.Signature)
+}
@@ -0,0 +1,72 @@
+package types
+
+import (
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/protolambda/go-kzg/bls"
+)
+
+func TestVerifyParams(t *testing.T) {
+	c := Controller{}
+	if _, _, err := c.Setup([]uint32{98765, 4321, 1111}); err != nil {
+		t.Fatal(err)
+	}
+	other := Controller{}
+	if _, _, err := other.Setup([]uint32{98765, 4321, 2468}); err != nil {
+		t.Fatal(err)
+	}
+	public, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublic, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commitment := c.Commit()
+	setupHash := SetupHash(c.KzgSettings.SecretG1, c.KzgSettings.SecretG2)
+	otherSetup := NewKzgSettings(32)
+	signature := SignParams(key, "f", 3, 7, commitment, setupHash)
+
+	tests := []struct {
+		name       string
+		key        ed25519.PublicKey
+		signature  []byte
+		flowID     string
+		epoch      uint64
+		version    uint64
+		commitment *bls.G1Point
+		setupHash  [32]byte
+		want       bool
+	}{
+		{"signed parameters", public, signature, "f", 3, 7, commitment, setupHash, true},
+		{"wrong key", otherPublic, signature, "f", 3, 7, commitment, setupHash, false},
+		{"wrong flow", public, signature, "g", 3, 7, commitment, setupHash, false},
+		{"wrong epoch", public, signature, "f", 4, 7, commitment, setupHash, false},
+		{"wrong version", public, signature, "f", 3, 6, commitment, setupHash, false},
+		{"another route's commitment", public, signature, "f", 3, 7, other.Commit(), setupHash, false},
+		{"another setup", public, signature, "f", 3, 7, commitment, SetupHash(otherSetup.SecretG1, otherSetup.SecretG2), false},
+		{"truncated signature", public, signature[:ed25519.SignatureSize-1], "f", 3, 7, commitment, setupHash, false},
+		{"no signature", public, nil, "f", 3, 7, commitment, setupHash, false},
+		{"no key", nil, signature, "f", 3, 7, commitment, setupHash, false},
+		{"no commitment", public, signature, "f", 3, 7, nil, setupHash, false},
+	}
+	for _, test := range tests {
+		got := VerifyParams(test.key, test.signature, test.flowID, test.epoch, test.version, test.commitment, test.setupHash)
+		if got != test.want {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	storage := PublicStorage{PolynomialCommitment: commitment, KzgSettings: c.KzgSettings}
+	storage.Sign(key, "f", 3, 7)
+	if !storage.Verify(public, "f", 3, 7) {
+		t.Error("signed storage refused")
+	}
+	storage.PolynomialCommitment = other.Commit()
+	if storage.Verify(public, "f", 3, 7) {
+		t.Error("storage verified with a swapped commitment")
+	}
+}
@@ -1,6 +1,9 @@
 package types
 
 import (
+	"crypto/rand"
+	"example.com/kzg-demo/keystore"
+	"example.com/kzg-demo/utils"
 	"fmt"
 	interpolation "github.com/SadPencil/go-lagrange-interpolation"
 	"github.com/SadPencil/go-lagrange-interpolation/field"
@@ -12,6 +15,34 @@ import (
 type Controller struct {
 	Polynomial  []bls.Fr
 	KzgSettings *gozkg.KZGSettings
+
+	// PaddedDegree, if non-zero, pads the route with random dummy points so the polynomial always
+	// has this degree, hiding the number of hops. Real hops verify as before.
+	PaddedDegree int
+
+	// RouteKey, if set, replaces the evaluation targets 1..n with pseudorandom position labels
+	// derived from it, hiding the hop indices. See Labels.
+	RouteKey []byte
+
+	// Lagrange, if set, commits the route in evaluation form instead of interpolating it: hop i
+	// is the value of its private data at slot Slots[i] of the domain, see LagrangeSettings.
+	// Insert, Remove and Replace then update the commitment and every opening incrementally.
+	Lagrange *LagrangeSettings
+	// Slots pins the slot of every hop in Lagrange form; Setup spreads the hops evenly if nil.
+	Slots []int
+	// Route is the route committed in Lagrange form, with the opening of every hop.
+	Route *LagrangeRoute
+}
+
+// Position returns the evaluation target of hop i, counted from 0: i+1, or its position label
+// if the controller has a route key.
+func (c *Controller) Position(i int) *bls.Fr {
+	if c.RouteKey != nil {
+		return &Labels(c.RouteKey, i+1)[i]
+	}
+	y := new(bls.Fr)
+	bls.AsFr(y, uint64(i+1)) // starts from 1
+	return y
 }
 
 func (c *Controller) Setup(nodesPrivateData []uint32) (ks *gozkg.KZGSettings, polynomial []bls.Fr, err error) {
@@ -22,13 +53,39 @@ func (c *Controller) Setup(nodesPrivateData []uint32) (ks *gozkg.KZGSettings, po
 	if !success {
 		return nil, nil, fmt.Errorf("failed to parse modulus string")
 	}
+	if !utils.IsUnique(nodesPrivateData) {
+		return nil, nil, fmt.Errorf("private data must be unique for each node and visit")
+	}
+	if c.Lagrange != nil {
+		return c.setupLagrange(nodesPrivateData)
+	}
+
+	ys := make([]*big.Int, len(nodesPrivateData))
+	for i := range ys {
+		ys[i] = big.NewInt(int64(i + 1)) // starts from 1
+	}
+	if c.RouteKey != nil {
+		for i, label := range Labels(c.RouteKey, len(ys)) {
+			ys[i], _ = new(big.Int).SetString(label.String(), 10)
+		}
+	}
+
 	points := make([]*interpolation.XYPoint, 0)
 	for i := 0; i < len(nodesPrivateData); i++ {
 		points = append(points, &interpolation.XYPoint{
 			X: &field.Field{Modulus: modulus, Value: big.NewInt(int64(nodesPrivateData[i]))},
-			Y: &field.Field{Modulus: modulus, Value: big.NewInt(int64(i + 1))}}, // starts from 1
+			Y: &field.Field{Modulus: modulus, Value: ys[i]}},
 		)
 	}
+	if c.PaddedDegree > 0 {
+		if len(points) > c.PaddedDegree+1 {
+			return nil, nil, fmt.Errorf("%v nodes do not fit in a polynomial of degree %v", len(points), c.PaddedDegree)
+		}
+		points, err = padPoints(points, c.PaddedDegree+1, modulus)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 	interpolatingPolynomial, err := interpolation.LagrangeInterpolation(points)
 	if err != nil {
 		return nil, nil, err
@@ -39,24 +96,65 @@ func (c *Controller) Setup(nodesPrivateData []uint32) (ks *gozkg.KZGSettings, po
 		return nil, nil, fmt.Errorf("the polynomial degree is too low. Try using random private data")
 	}
 
-	polynomial = make([]bls.Fr, len(interpolatingPolynomial.Coefficients))
+	// a padded polynomial always has PaddedDegree+1 coefficients, even if the leading ones vanish
+	polynomial = make([]bls.Fr, max(len(interpolatingPolynomial.Coefficients), c.PaddedDegree+1))
 	for i := 0; i < len(interpolatingPolynomial.Coefficients); i++ {
 		bls.SetFr(&polynomial[i], interpolatingPolynomial.Coefficients[i].Value.String())
 	}
 
-	// 16 = 2^4
-	fs := gozkg.NewFFTSettings(4)
-	// should be no less than 2^4+1 points
-	// also, should be no less than polynomial degree + 1
-	s1, s2 := gozkg.GenerateTestingSetup("1927409816240961209460912649124", max(uint64(len(polynomial)), 16+1))
-	ks = gozkg.NewKZGSettings(fs, s1, s2)
+	ks = NewKzgSettings(len(polynomial))
 
 	c.Polynomial = polynomial
 	c.KzgSettings = ks
 	return ks, polynomial, nil
 }
 
+// padPoints adds dummy points with random coordinates until there are n points.
+func padPoints(points []*interpolation.XYPoint, n int, modulus *big.Int) ([]*interpolation.XYPoint, error) {
+	used := make(map[string]bool)
+	for _, point := range points {
+		used[point.X.Value.String()] = true
+	}
+	for len(points) < n {
+		x, err := rand.Int(rand.Reader, modulus)
+		if err != nil {
+			return nil, err
+		}
+		y, err := rand.Int(rand.Reader, modulus)
+		if err != nil {
+			return nil, err
+		}
+		if used[x.String()] {
+			continue
+		}
+		used[x.String()] = true
+		points = append(points, &interpolation.XYPoint{
+			X: &field.Field{Modulus: modulus, Value: x},
+			Y: &field.Field{Modulus: modulus, Value: y},
+		})
+	}
+	return points, nil
+}
+
+// NewKzgSettings generates the testing setup for polynomials with up to n coefficients.
+func NewKzgSettings(n int) *gozkg.KZGSettings {
+	// should be no less than 2^4+1 points
+	// also, should be no less than polynomial degree + 1
+	s1, s2 := gozkg.GenerateTestingSetup("1927409816240961209460912649124", max(uint64(n), 16+1))
+	return KzgSettingsFromSetup(s1, s2)
+}
+
+// KzgSettingsFromSetup rebuilds the settings from setup points distributed by the controller.
+func KzgSettingsFromSetup(s1 []bls.G1Point, s2 []bls.G2Point) *gozkg.KZGSettings {
+	// 16 = 2^4
+	fs := gozkg.NewFFTSettings(4)
+	return gozkg.NewKZGSettings(fs, s1, s2)
+}
+
 func (c *Controller) Commit() *bls.G1Point {
+	if c.Route != nil {
+		return c.Route.Commitment
+	}
 	commitment := c.KzgSettings.CommitToPoly(c.Polynomial)
 	return commitment
 }
@@ -64,6 +162,7 @@ func (c *Controller) Commit() *bls.G1Point {
 type PublicStorage struct {
 	PolynomialCommitment *bls.G1Point
 	KzgSettings          *gozkg.KZGSettings
+	Signature            []byte // controller's signature, see Sign
 }
 
 type Node struct {
@@ -71,3 +170,12 @@ type Node struct {
 	SecretFr   *bls.Fr
 	Polynomial []bls.Fr
 }
+
+// String keeps the secret and the polynomial out of logs.
+func (n Node) String() string {
+	return fmt.Sprintf("Node{Secret: %v, Polynomial: %v coefficients}", keystore.Redacted, len(n.Polynomial))
+}
+
+func (n Node) GoString() string {
+	return n.String()
+}
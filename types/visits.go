@@ -0,0 +1,40 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// A route may pass through the same node more than once (loops, hairpins). Every visit is a
+// separate point of the polynomial, so it needs its own x: the first visit uses the node secret,
+// later ones a secret derived from it and the visit counter. Only the node and the controller can
+// derive them, and they stay in the uint32 range of the demo secrets.
+
+// VisitSecret returns the secret of a node's visit-th pass over a route, counted from 0.
+func VisitSecret(secret uint64, visit int) uint64 {
+	if visit == 0 {
+		return secret
+	}
+	var data [16]byte
+	binary.LittleEndian.PutUint64(data[:8], secret)
+	binary.LittleEndian.PutUint64(data[8:], uint64(visit))
+	for {
+		digest := sha256.Sum256(data[:])
+		derived := uint64(binary.LittleEndian.Uint32(digest[:4]) & 0x7fffffff)
+		if derived != 0 && derived != secret {
+			return derived
+		}
+		copy(data[:], digest[:16])
+	}
+}
+
+// Visits counts, for every hop of a route, how many times the same node appeared before it.
+func Visits[T comparable](route []T) []int {
+	seen := make(map[T]int)
+	visits := make([]int, len(route))
+	for i, hop := range route {
+		visits[i] = seen[hop]
+		seen[hop]++
+	}
+	return visits
+}
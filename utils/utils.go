@@ -1,6 +1,10 @@
 package utils
 
-import "time"
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
 
 func IsUnique(nums []uint32) bool {
 	freq := make(map[uint32]int)
@@ -21,3 +25,33 @@ func IsUnique(nums []uint32) bool {
 func DurationDivideBy(duration time.Duration, divisor int) time.Duration {
 	return time.Duration(duration.Nanoseconds() / int64(divisor))
 }
+
+// WriteFileAtomic writes data to a temporary file in the same directory and renames it over path,
+// so readers never observe a partially written file.
+func WriteFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}